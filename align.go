@@ -0,0 +1,130 @@
+package imagediff
+
+import (
+	"image"
+	"log"
+	"math"
+	"sync"
+)
+
+// DefaultMaxShift bounds the alignment search when Options.MaxShift is zero.
+const DefaultMaxShift = 16
+
+// estimateOffset finds the translation of right relative to left, within
+// maxShift pixels in each direction, that minimizes the mean absolute
+// luminance difference over the overlap. Content at (x, y) in left is found
+// at (x, y) + offset in right. The search runs coarse to fine on an image
+// pyramid so large shifts stay cheap.
+func estimateOffset(left, right *lumaImage, maxShift int) image.Point {
+	pyramid1, pyramid2 := []*lumaImage{left}, []*lumaImage{right}
+	for shift := maxShift; shift > 2; shift /= 2 {
+		l1, l2 := pyramid1[len(pyramid1)-1], pyramid2[len(pyramid2)-1]
+		if min(l1.w, l1.h, l2.w, l2.h) < 64 {
+			break
+		}
+		pyramid1 = append(pyramid1, l1.downsample())
+		pyramid2 = append(pyramid2, l2.downsample())
+	}
+
+	top := len(pyramid1) - 1
+	radius := (maxShift + 1<<top - 1) >> top // Ceiling of maxShift / 2^top
+	best := searchOffset(pyramid1[top], pyramid2[top], image.Point{}, radius, radius)
+	for level := top - 1; level >= 0; level-- {
+		// Refine the doubled estimate from the coarser level by one pixel
+		best = searchOffset(pyramid1[level], pyramid2[level], best.Mul(2), 1, maxShift>>level)
+	}
+	return best
+}
+
+// searchOffset evaluates every offset within radius of center, clamped to
+// limit, and returns the one with the lowest alignment error. Ties keep
+// center.
+func searchOffset(left, right *lumaImage, center image.Point, radius, limit int) image.Point {
+	best := center
+	bestErr := alignmentError(left, right, center)
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			p := center.Add(image.Pt(dx, dy))
+			if p == center || abs(p.X) > limit || abs(p.Y) > limit {
+				continue
+			}
+			if e := alignmentError(left, right, p); e < bestErr {
+				best, bestErr = p, e
+			}
+		}
+	}
+	return best
+}
+
+// alignmentError returns the mean absolute luminance difference between left
+// and right shifted by offset. Offsets leaving less than half of the smaller
+// image in either dimension are rejected with +Inf.
+func alignmentError(left, right *lumaImage, offset image.Point) float64 {
+	overlap := alignedOverlap(image.Pt(left.w, left.h), image.Pt(right.w, right.h), offset)
+	if overlap.Empty() || overlap.Dx() < min(left.w, right.w)/2 || overlap.Dy() < min(left.h, right.h)/2 {
+		return math.Inf(1)
+	}
+
+	var mu sync.Mutex
+	var sum float64
+	forEachChunk(overlap, func(c Chunk) {
+		var chunkSum float64
+		for y := c.startY; y < c.endY; y++ {
+			for x := c.startX; x < c.endX; x++ {
+				chunkSum += math.Abs(left.pix[y*left.w+x] - right.pix[(y+offset.Y)*right.w+x+offset.X])
+			}
+		}
+		mu.Lock()
+		sum += chunkSum
+		mu.Unlock()
+	})
+	return sum / float64(overlap.Dx()*overlap.Dy())
+}
+
+// alignedOverlap returns the region of a left image of size1, in coordinates
+// relative to its origin, that overlaps a right image of size2 shifted by
+// offset.
+func alignedOverlap(size1, size2, offset image.Point) image.Rectangle {
+	overlap := image.Rectangle{
+		Min: image.Pt(max(0, -offset.X), max(0, -offset.Y)),
+		Max: image.Pt(min(size1.X, size2.X-offset.X), min(size1.Y, size2.Y-offset.Y)),
+	}
+	if overlap.Empty() {
+		return image.Rectangle{}
+	}
+	return overlap
+}
+
+// compareAligned estimates the offset between left and right and compares
+// the aligned overlap.
+func compareAligned(left, right image.Image, opts Options) (*Result, error) {
+	if opts.Verbose {
+		log.Printf("Estimating alignment within %d pixels", opts.MaxShift)
+	}
+	offset := estimateOffset(newLumaImage(left), newLumaImage(right), opts.MaxShift)
+
+	size1, size2 := left.Bounds().Size(), right.Bounds().Size()
+	overlap := alignedOverlap(size1, size2, offset)
+	if overlap.Empty() {
+		return nil, ErrSizeMismatch
+	}
+	if opts.Verbose {
+		log.Printf("Estimated offset %v, comparing %v overlap", offset, overlap.Size())
+	}
+
+	leftOverlap := overlap.Add(left.Bounds().Min)
+	rightOverlap := overlap.Add(right.Bounds().Min).Add(offset)
+	res, err := compareSameSize(cropImage(left, leftOverlap), cropImage(right, rightOverlap), opts)
+	if err != nil {
+		return nil, err
+	}
+	res.Offset = offset
+	return res, nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
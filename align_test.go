@@ -0,0 +1,89 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand/v2"
+	"testing"
+)
+
+// Helper function to create a non-repeating image of random gray rectangles
+func createRandomRectsImage(width, height int) *image.RGBA {
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{128, 128, 128, 255}), image.Point{}, draw.Src)
+	for range 200 {
+		x, y := rng.IntN(width), rng.IntN(height)
+		r := image.Rect(x, y, x+4+rng.IntN(30), y+4+rng.IntN(30))
+		v := uint8(rng.IntN(256))
+		draw.Draw(img, r, image.NewUniform(color.RGBA{v, v, v, 255}), image.Point{}, draw.Src)
+	}
+	return img
+}
+
+func TestCompareAligned(t *testing.T) {
+	canvas := createRandomRectsImage(240, 240)
+	left := canvas.SubImage(image.Rect(40, 40, 200, 200))
+
+	tests := []struct {
+		name   string
+		offset image.Point
+	}{
+		{name: "No Shift", offset: image.Pt(0, 0)},
+		{name: "Small Shift", offset: image.Pt(7, -3)},
+		{name: "Large Shift", offset: image.Pt(-12, 15)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Content at (x, y) in left appears at (x, y) + offset in right
+			right := canvas.SubImage(image.Rect(40, 40, 200, 200).Sub(tt.offset))
+
+			res, err := Compare(left, right, Options{Align: true})
+			if err != nil {
+				t.Fatalf("%s: Compare: %v", tt.name, err)
+			}
+			if res.Offset != tt.offset {
+				t.Errorf("%s: Offset got %v, want %v", tt.name, res.Offset, tt.offset)
+			}
+			if res.DiffCount != 0 {
+				t.Errorf("%s: DiffCount got %d, want 0 after alignment", tt.name, res.DiffCount)
+			}
+			wantSize := image.Pt(160-abs(tt.offset.X), 160-abs(tt.offset.Y))
+			if res.Image.Bounds().Size() != wantSize {
+				t.Errorf("%s: diff size got %v, want %v", tt.name, res.Image.Bounds().Size(), wantSize)
+			}
+
+			if tt.offset != (image.Point{}) {
+				unaligned, _ := Compare(left, right, Options{})
+				if unaligned.DiffCount == 0 {
+					t.Errorf("%s: expected differences without alignment", tt.name)
+				}
+			}
+		})
+	}
+}
+
+func TestAlignedOverlap(t *testing.T) {
+	tests := []struct {
+		name   string
+		size1  image.Point
+		size2  image.Point
+		offset image.Point
+		want   image.Rectangle
+	}{
+		{name: "Same Size", size1: image.Pt(10, 10), size2: image.Pt(10, 10), offset: image.Pt(0, 0), want: image.Rect(0, 0, 10, 10)},
+		{name: "Positive Offset", size1: image.Pt(10, 10), size2: image.Pt(10, 10), offset: image.Pt(3, 2), want: image.Rect(0, 0, 7, 8)},
+		{name: "Negative Offset", size1: image.Pt(10, 10), size2: image.Pt(10, 10), offset: image.Pt(-3, -2), want: image.Rect(3, 2, 10, 10)},
+		{name: "Disjoint", size1: image.Pt(10, 10), size2: image.Pt(10, 10), offset: image.Pt(12, 0), want: image.Rectangle{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := alignedOverlap(tt.size1, tt.size2, tt.offset); got != tt.want {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
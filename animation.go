@@ -0,0 +1,432 @@
+package imagediff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"log"
+	"slices"
+	"time"
+)
+
+var errAPNGFormat = errors.New("imagediff: invalid animated PNG")
+
+// maxAnimationPixels bounds the pixels of all decoded frames together, so
+// that a corrupt or hostile animation cannot trigger a huge allocation.
+const maxAnimationPixels = 1 << 27
+
+// Animation is a decoded animated image. Each frame is complete, with the
+// partial frames of the file composed onto the canvas as the file specifies,
+// so that frames can be compared independently.
+type Animation struct {
+	Frames []image.Image   // Frames in display order, all of the canvas size
+	Delays []time.Duration // Time each frame is shown, one per frame
+	Plays  int             // Number of times the animation is played, 0 for endlessly
+}
+
+// DecodeAnimation decodes all frames of an animated GIF or PNG (APNG) and
+// returns the format name like image.Decode. Still images, including PNGs
+// without animation and single-frame GIFs, and images of any other registered
+// format decode to a single frame, exactly as image.Decode returns it.
+func DecodeAnimation(r io.Reader) (*Animation, string, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(pngSignature))
+	switch {
+	case bytes.HasPrefix(magic, []byte("GIF8")):
+		a, err := decodeGIFAnimation(br)
+		return a, "gif", err
+	case string(magic) == pngSignature:
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, "", err
+		}
+		a, err := decodeAPNG(data)
+		return a, "png", err
+	}
+	img, format, err := image.Decode(br)
+	if err != nil {
+		return nil, "", err
+	}
+	return &Animation{Frames: []image.Image{img}, Delays: []time.Duration{0}}, format, nil
+}
+
+// delay returns the delay of frame i, zero if not set.
+func (a *Animation) delay(i int) time.Duration {
+	if i < len(a.Delays) {
+		return a.Delays[i]
+	}
+	return 0
+}
+
+// Frame disposal after a frame is shown, as in GIF and APNG.
+const (
+	disposeNone       = iota // Leave the frame on the canvas
+	disposeBackground        // Clear the frame area to transparent
+	disposePrevious          // Restore the canvas as it was before the frame
+)
+
+// canvas composes partial frames into complete ones. The canvas has 16 bits
+// per channel, so that it holds the values returned by the RGBA method of
+// any frame exactly.
+type canvas struct {
+	img    *image.RGBA64
+	frames []image.Image
+}
+
+// add draws src into r with op, appends the resulting canvas as a frame and
+// then disposes of the frame area.
+func (c *canvas) add(src image.Image, r image.Rectangle, op draw.Op, dispose int) error {
+	b := c.img.Bounds()
+	if int64(len(c.frames)+1)*int64(b.Dx())*int64(b.Dy()) > maxAnimationPixels {
+		return errors.New("imagediff: animation too large")
+	}
+	var saved *image.RGBA64
+	if dispose == disposePrevious {
+		saved = cloneRGBA64(c.img)
+	}
+	draw.Draw(c.img, r, src, src.Bounds().Min, op)
+	c.frames = append(c.frames, cloneRGBA64(c.img))
+	switch dispose {
+	case disposeBackground:
+		draw.Draw(c.img, r, image.Transparent, image.Point{}, draw.Src)
+	case disposePrevious:
+		c.img = saved
+	}
+	return nil
+}
+
+func cloneRGBA64(img *image.RGBA64) *image.RGBA64 {
+	c := *img
+	c.Pix = slices.Clone(img.Pix)
+	return &c
+}
+
+// decodeGIFAnimation decodes all frames of a GIF. A single frame is returned
+// as decoded, like gif.Decode does.
+func decodeGIFAnimation(r io.Reader) (*Animation, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	a := &Animation{}
+	// LoopCount counts the repetitions after the first play, -1 for none
+	switch {
+	case g.LoopCount < 0:
+		a.Plays = 1
+	case g.LoopCount > 0:
+		a.Plays = g.LoopCount + 1
+	}
+	for _, d := range g.Delay {
+		a.Delays = append(a.Delays, time.Duration(d)*10*time.Millisecond)
+	}
+	if len(g.Image) == 1 {
+		a.Frames = []image.Image{g.Image[0]}
+		return a, nil
+	}
+
+	c := &canvas{img: image.NewRGBA64(image.Rect(0, 0, g.Config.Width, g.Config.Height))}
+	for i, frame := range g.Image {
+		dispose := disposeNone
+		switch g.Disposal[i] {
+		case gif.DisposalBackground:
+			dispose = disposeBackground
+		case gif.DisposalPrevious:
+			dispose = disposePrevious
+		}
+		if err := c.add(frame, frame.Bounds(), draw.Over, dispose); err != nil {
+			return nil, err
+		}
+	}
+	a.Frames = c.frames
+	return a, nil
+}
+
+// apngFrame holds a frame control (fcTL) chunk and the image data that
+// follows it.
+type apngFrame struct {
+	bounds  image.Rectangle
+	delay   time.Duration
+	dispose int
+	op      draw.Op
+	data    []byte
+}
+
+// decodeAPNG decodes the PNG file in data, with all its frames if it is
+// animated. The default image is only a frame if a frame control chunk
+// precedes it, as the APNG specification requires.
+func decodeAPNG(data []byte) (*Animation, error) {
+	var (
+		ihdr     []byte
+		palette  [][]byte // PLTE and tRNS chunks, needed to decode each frame
+		animated bool
+		a        = &Animation{}
+		c        *canvas
+		frame    *apngFrame
+		seq      uint32
+	)
+	// flush decodes the pending frame and composes it onto the canvas
+	flush := func() error {
+		if frame == nil {
+			return nil
+		}
+		img, err := decodeAPNGFrame(ihdr, palette, frame)
+		if err != nil {
+			return err
+		}
+		dispose := frame.dispose
+		if len(c.frames) == 0 && dispose == disposePrevious {
+			dispose = disposeBackground
+		}
+		if err := c.add(img, frame.bounds, frame.op, dispose); err != nil {
+			return err
+		}
+		a.Delays = append(a.Delays, frame.delay)
+		frame = nil
+		return nil
+	}
+	// nextSeq checks the sequence number starting the data of fcTL and fdAT
+	nextSeq := func(chunk []byte) error {
+		if binary.BigEndian.Uint32(chunk) != seq {
+			return fmt.Errorf("%w: out-of-order sequence number", errAPNGFormat)
+		}
+		seq++
+		return nil
+	}
+
+	for rest := data[len(pngSignature):]; ; {
+		if len(rest) < 12 {
+			return nil, fmt.Errorf("%w: truncated", errAPNGFormat)
+		}
+		n := binary.BigEndian.Uint32(rest)
+		if uint64(n) > uint64(len(rest)-12) {
+			return nil, fmt.Errorf("%w: truncated", errAPNGFormat)
+		}
+		name, chunk := string(rest[4:8]), rest[8:][:n]
+		if crc32.ChecksumIEEE(rest[4:8+n]) != binary.BigEndian.Uint32(rest[8+n:]) {
+			return nil, fmt.Errorf("%w: checksum mismatch in %s chunk", errAPNGFormat, name)
+		}
+		raw := rest[:12+n]
+		rest = rest[12+n:]
+
+		switch name {
+		case "IHDR":
+			if len(chunk) != 13 {
+				return nil, fmt.Errorf("%w: bad IHDR chunk", errAPNGFormat)
+			}
+			ihdr = chunk
+		case "PLTE", "tRNS":
+			palette = append(palette, raw)
+		case "acTL":
+			if ihdr == nil || len(chunk) != 8 {
+				return nil, fmt.Errorf("%w: bad acTL chunk", errAPNGFormat)
+			}
+			animated = true
+			a.Plays = int(binary.BigEndian.Uint32(chunk[4:]))
+			width, height := binary.BigEndian.Uint32(ihdr), binary.BigEndian.Uint32(ihdr[4:])
+			if uint64(width)*uint64(height) > maxAnimationPixels {
+				return nil, errors.New("imagediff: animation too large")
+			}
+			c = &canvas{img: image.NewRGBA64(image.Rect(0, 0, int(width), int(height)))}
+		case "fcTL":
+			if !animated || len(chunk) != 26 {
+				return nil, fmt.Errorf("%w: bad fcTL chunk", errAPNGFormat)
+			}
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if err := nextSeq(chunk); err != nil {
+				return nil, err
+			}
+			var err error
+			if frame, err = parseFCTL(chunk, c.img.Bounds()); err != nil {
+				return nil, err
+			}
+		case "IDAT":
+			if !animated {
+				// A still PNG: let the standard decoder handle it
+				img, err := png.Decode(bytes.NewReader(data))
+				if err != nil {
+					return nil, err
+				}
+				return &Animation{Frames: []image.Image{img}, Delays: []time.Duration{0}}, nil
+			}
+			// The default image is the first frame only if its fcTL precedes it
+			if frame != nil && seq == 1 {
+				frame.data = append(frame.data, chunk...)
+			}
+		case "fdAT":
+			if frame == nil || len(chunk) < 4 {
+				return nil, fmt.Errorf("%w: fdAT chunk without fcTL", errAPNGFormat)
+			}
+			if err := nextSeq(chunk); err != nil {
+				return nil, err
+			}
+			frame.data = append(frame.data, chunk[4:]...)
+		case "IEND":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if c == nil || len(c.frames) == 0 {
+				return nil, fmt.Errorf("%w: no frames", errAPNGFormat)
+			}
+			a.Frames = c.frames
+			return a, nil
+		}
+	}
+}
+
+// parseFCTL parses the data of an fcTL chunk for a canvas of the given
+// bounds.
+func parseFCTL(chunk []byte, bounds image.Rectangle) (*apngFrame, error) {
+	u32 := func(i int) int { return int(binary.BigEndian.Uint32(chunk[i:])) }
+	width, height, x, y := u32(4), u32(8), u32(12), u32(16)
+	r := image.Rect(x, y, x+width, y+height)
+	if width <= 0 || height <= 0 || x < 0 || y < 0 || !r.In(bounds) {
+		return nil, fmt.Errorf("%w: frame %v outside the canvas %v", errAPNGFormat, r, bounds)
+	}
+	num, den := time.Duration(binary.BigEndian.Uint16(chunk[20:])), time.Duration(binary.BigEndian.Uint16(chunk[22:]))
+	if den == 0 {
+		den = 100 // As specified: hundredths of a second
+	}
+	f := &apngFrame{bounds: r, delay: num * time.Second / den, op: draw.Src}
+	switch chunk[24] {
+	case 1:
+		f.dispose = disposeBackground
+	case 2:
+		f.dispose = disposePrevious
+	}
+	if chunk[25] == 1 {
+		f.op = draw.Over
+	}
+	return f, nil
+}
+
+// decodeAPNGFrame decodes the image data of frame as a PNG of the frame size,
+// sharing the header and palette of the animation.
+func decodeAPNGFrame(ihdr []byte, palette [][]byte, frame *apngFrame) (image.Image, error) {
+	var buf bytes.Buffer
+	e := &apngEncoder{w: &buf}
+	e.write([]byte(pngSignature))
+	header := slices.Clone(ihdr)
+	binary.BigEndian.PutUint32(header, uint32(frame.bounds.Dx()))
+	binary.BigEndian.PutUint32(header[4:], uint32(frame.bounds.Dy()))
+	e.chunk("IHDR", header)
+	for _, raw := range palette {
+		e.write(raw)
+	}
+	e.chunk("IDAT", frame.data)
+	e.chunk("IEND", nil)
+	img, err := png.Decode(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("%w: frame: %v", errAPNGFormat, err)
+	}
+	return img, nil
+}
+
+// AnimationResult holds the frame-by-frame comparison of two animations.
+type AnimationResult struct {
+	Frames          []*Result  // Comparison of each frame present in both animations
+	Left            *Animation // Left animation as decoded
+	Right           *Animation // Right animation as decoded
+	DelayMismatches []int      // Indexes of compared frames shown for different times
+	DiffFrames      int        // Number of compared frames with differing pixels
+	DiffCount       int64      // Differing pixels over all compared frames
+	DiffPercent     float64    // DiffCount as a percentage of the pixels compared in all frames
+	Worst           int        // Index of the frame with the most differing pixels
+}
+
+// CompareAnimations compares left and right frame by frame with opts, up to
+// the shorter of the two, and records the frames whose delays differ.
+func CompareAnimations(left, right *Animation, opts Options) (*AnimationResult, error) {
+	if len(left.Frames) == 0 || len(right.Frames) == 0 {
+		return nil, errNoFrames
+	}
+	r := &AnimationResult{Left: left, Right: right}
+	var compared int64
+	for i := range min(len(left.Frames), len(right.Frames)) {
+		if opts.Verbose {
+			log.Printf("Comparing frame %d", i)
+		}
+		fr, err := Compare(left.Frames[i], right.Frames[i], opts)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		r.Frames = append(r.Frames, fr)
+		b := fr.Image.Bounds()
+		compared += int64(b.Dx())*int64(b.Dy()) - fr.Ignored
+		r.DiffCount += fr.DiffCount
+		if fr.DiffCount > 0 {
+			r.DiffFrames++
+		}
+		if fr.DiffCount > r.Frames[r.Worst].DiffCount {
+			r.Worst = i
+		}
+		if left.delay(i) != right.delay(i) {
+			r.DelayMismatches = append(r.DelayMismatches, i)
+		}
+	}
+	if compared > 0 {
+		r.DiffPercent = float64(r.DiffCount) * 100 / float64(compared)
+	}
+	return r, nil
+}
+
+// FrameCountMismatch reports whether the animations have different numbers
+// of frames.
+func (r *AnimationResult) FrameCountMismatch() bool {
+	return len(r.Left.Frames) != len(r.Right.Frames)
+}
+
+// TimingMismatch reports whether the animations have different numbers of
+// frames or show a compared frame for different times.
+func (r *AnimationResult) TimingMismatch() bool {
+	return r.FrameCountMismatch() || len(r.DelayMismatches) > 0
+}
+
+// Exceeds reports whether the difference of any compared frame is beyond t.
+// Frame counts and delays are not considered; see TimingMismatch.
+func (r *AnimationResult) Exceeds(t Threshold) bool {
+	for _, fr := range r.Frames {
+		if fr.Exceeds(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// DiffAnimation returns the difference images of the compared frames, or
+// their composites (see Result.Composite) if composite is set, as an
+// animation with the delays and play count of the left animation.
+func (r *AnimationResult) DiffAnimation(composite bool) *Animation {
+	a := &Animation{Plays: r.Left.Plays}
+	for i, fr := range r.Frames {
+		var img image.Image = fr.Image
+		if composite {
+			img = fr.Composite()
+		}
+		a.Frames = append(a.Frames, img)
+		a.Delays = append(a.Delays, r.Left.delay(i))
+	}
+	return a
+}
+
+// EncodeAPNG writes a as an animated PNG with its delays and play count.
+// Frames are stored losslessly as 8-bit RGBA and must have the same size.
+func (a *Animation) EncodeAPNG(w io.Writer) error {
+	return encodeAPNG(w, a.Frames, a.Delays, a.Plays)
+}
+
+// EncodeGIF writes a as an animated GIF with its delays, rounded to
+// hundredths of a second, and play count. The palette is chosen as by
+// EncodeGIF.
+func (a *Animation) EncodeGIF(w io.Writer) error {
+	return encodeGIF(w, a.Frames, a.Delays, a.Plays)
+}
@@ -0,0 +1,437 @@
+package imagediff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+// testFrame is a partial APNG frame
+type testFrame struct {
+	img     *image.NRGBA // Drawn at its bounds
+	delay   uint16       // Hundredths of a second
+	dispose uint8
+	blend   uint8
+}
+
+// apngData encodes an animated PNG of the given size by hand. If still is
+// set, the default image is not part of the animation.
+func apngData(t *testing.T, size image.Point, still image.Image, frames []testFrame) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	e := &apngEncoder{w: &buf}
+	e.write([]byte(pngSignature))
+	e.chunk("IHDR", []byte{0, 0, 0, byte(size.X), 0, 0, 0, byte(size.Y), 8, 6, 0, 0, 0})
+	e.chunk("acTL", binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, uint32(len(frames))), 0))
+	var seq uint32
+	if still != nil {
+		data, err := compressFrame(still)
+		if err != nil {
+			t.Fatalf("compressFrame: %v", err)
+		}
+		e.chunk("IDAT", data)
+	}
+	for i, f := range frames {
+		b := f.img.Bounds()
+		fctl := binary.BigEndian.AppendUint32(nil, seq)
+		for _, v := range []int{b.Dx(), b.Dy(), b.Min.X, b.Min.Y} {
+			fctl = binary.BigEndian.AppendUint32(fctl, uint32(v))
+		}
+		fctl = binary.BigEndian.AppendUint16(fctl, f.delay)
+		fctl = binary.BigEndian.AppendUint16(fctl, 0)
+		e.chunk("fcTL", append(fctl, f.dispose, f.blend))
+		seq++
+
+		data, err := compressFrame(f.img)
+		if err != nil {
+			t.Fatalf("compressFrame: %v", err)
+		}
+		if i == 0 && still == nil {
+			e.chunk("IDAT", data)
+			continue
+		}
+		e.chunk("fdAT", append(binary.BigEndian.AppendUint32(nil, seq), data...))
+		seq++
+	}
+	e.chunk("IEND", nil)
+	if e.err != nil {
+		t.Fatalf("writing APNG: %v", e.err)
+	}
+	return buf.Bytes()
+}
+
+// filled returns an NRGBA image of bounds r filled with c
+func filled(r image.Rectangle, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// rgba64 returns c as compared: 16-bit premultiplied
+func rgba64(c color.Color) color.RGBA64 {
+	return color.RGBA64Model.Convert(c).(color.RGBA64)
+}
+
+func TestDecodeAnimation(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	blue := color.NRGBA{0, 0, 255, 255}
+	green := color.NRGBA{0, 255, 0, 255}
+	white := color.NRGBA{255, 255, 255, 255}
+	pal := color.Palette{color.Transparent, red, blue, green, white}
+	paletted := func(r image.Rectangle, index uint8) *image.Paletted {
+		p := image.NewPaletted(r, pal)
+		for i := range p.Pix {
+			p.Pix[i] = index
+		}
+		return p
+	}
+	encodeGIF := func(g *gif.GIF) []byte {
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, g); err != nil {
+			t.Fatalf("gif.EncodeAll: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	var stillPNG bytes.Buffer
+	if err := png.Encode(&stillPNG, filled(image.Rect(0, 0, 3, 2), red)); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	var roundTrip bytes.Buffer
+	if err := EncodeAPNG(&roundTrip, []image.Image{filled(image.Rect(0, 0, 3, 2), red), filled(image.Rect(0, 0, 3, 2), blue)}, 250*time.Millisecond); err != nil {
+		t.Fatalf("EncodeAPNG: %v", err)
+	}
+
+	type pixel struct {
+		frame, x, y int
+		want        color.Color
+	}
+	tests := []struct {
+		name       string
+		data       []byte
+		wantFormat string
+		wantDelays []time.Duration
+		wantPlays  int
+		pixels     []pixel
+	}{
+		{
+			name: "GIF Disposal",
+			data: encodeGIF(&gif.GIF{
+				Image: []*image.Paletted{
+					paletted(image.Rect(0, 0, 4, 4), 1),
+					paletted(image.Rect(0, 0, 2, 2), 2),
+					paletted(image.Rect(2, 2, 4, 4), 3),
+					paletted(image.Rect(3, 3, 4, 4), 4),
+				},
+				Delay:     []int{10, 20, 30, 40},
+				Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalNone},
+				LoopCount: 2,
+				Config:    image.Config{ColorModel: pal, Width: 4, Height: 4},
+			}),
+			wantFormat: "gif",
+			wantDelays: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 400 * time.Millisecond},
+			wantPlays:  3,
+			pixels: []pixel{
+				{1, 0, 0, blue},
+				{1, 3, 3, red},
+				{2, 0, 0, color.Transparent}, // Cleared after frame 1
+				{2, 3, 3, green},
+				{3, 2, 2, red}, // Frame 2 undone
+				{3, 3, 3, white},
+			},
+		},
+		{
+			name: "Single Frame GIF",
+			data: encodeGIF(&gif.GIF{
+				Image:     []*image.Paletted{paletted(image.Rect(0, 0, 2, 2), 2)},
+				Delay:     []int{0},
+				LoopCount: -1,
+			}),
+			wantFormat: "gif",
+			wantDelays: []time.Duration{0},
+			wantPlays:  1,
+			pixels:     []pixel{{0, 1, 1, blue}},
+		},
+		{
+			name:       "APNG Round Trip",
+			data:       roundTrip.Bytes(),
+			wantFormat: "png",
+			wantDelays: []time.Duration{250 * time.Millisecond, 250 * time.Millisecond},
+			pixels:     []pixel{{0, 2, 1, red}, {1, 2, 1, blue}},
+		},
+		{
+			name: "APNG Partial Frames",
+			data: apngData(t, image.Pt(3, 3), filled(image.Rect(0, 0, 3, 3), white), []testFrame{
+				{img: filled(image.Rect(0, 0, 3, 3), red), delay: 5},
+				{img: filled(image.Rect(1, 1, 3, 3), color.NRGBA{0, 0, 255, 128}), delay: 10, dispose: 2, blend: 1},
+				{img: filled(image.Rect(0, 0, 1, 1), green), delay: 15},
+			}),
+			wantFormat: "png",
+			wantDelays: []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 150 * time.Millisecond},
+			pixels: []pixel{
+				{0, 1, 1, red}, // The default image is not a frame
+				{1, 0, 0, red},
+				{1, 2, 2, color.RGBA{127, 0, 128, 255}},
+				{2, 2, 2, red}, // Frame 1 undone
+				{2, 0, 0, green},
+			},
+		},
+		{
+			name:       "Still PNG",
+			data:       stillPNG.Bytes(),
+			wantFormat: "png",
+			wantDelays: []time.Duration{0},
+			pixels:     []pixel{{0, 2, 1, red}},
+		},
+		{
+			name:       "Other Formats",
+			data:       []byte("P2\n2 1\n255\n0 255\n"),
+			wantFormat: "pgm",
+			wantDelays: []time.Duration{0},
+			pixels:     []pixel{{0, 1, 0, color.Gray{255}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, format, err := DecodeAnimation(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("%s: DecodeAnimation: %v", tt.name, err)
+			}
+			if format != tt.wantFormat {
+				t.Errorf("%s: format got %q, want %q", tt.name, format, tt.wantFormat)
+			}
+			if len(a.Frames) != len(tt.wantDelays) || len(a.Delays) != len(tt.wantDelays) {
+				t.Fatalf("%s: got %d frames and %d delays, want %d", tt.name, len(a.Frames), len(a.Delays), len(tt.wantDelays))
+			}
+			for i, d := range a.Delays {
+				if d != tt.wantDelays[i] {
+					t.Errorf("%s: frame %d delay got %v, want %v", tt.name, i, d, tt.wantDelays[i])
+				}
+			}
+			if a.Plays != tt.wantPlays {
+				t.Errorf("%s: plays got %d, want %d", tt.name, a.Plays, tt.wantPlays)
+			}
+			for _, p := range tt.pixels {
+				if got := rgba64(a.Frames[p.frame].At(p.x, p.y)); got != rgba64(p.want) {
+					t.Errorf("%s: frame %d pixel (%d, %d) got %v, want %v", tt.name, p.frame, p.x, p.y, got, rgba64(p.want))
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeAnimationErrors(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	valid := apngData(t, image.Pt(2, 2), nil, []testFrame{
+		{img: filled(image.Rect(0, 0, 2, 2), red)},
+		{img: filled(image.Rect(1, 1, 2, 2), red)},
+	})
+	corrupt := func(f func(b []byte)) []byte {
+		b := bytes.Clone(valid)
+		f(b)
+		return b
+	}
+	// Offsets in valid: signature, IHDR, acTL, then the first fcTL
+	fctl := len(pngSignature) + 25 + 20
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"Checksum Mismatch", corrupt(func(b []byte) { b[len(b)-20]++ })},
+		{"Truncated", valid[:len(valid)-20]},
+		{"Sequence Out Of Order", corrupt(func(b []byte) {
+			binary.BigEndian.PutUint32(b[fctl+8:], 5)
+			binary.BigEndian.PutUint32(b[fctl+8+26:], crc32.ChecksumIEEE(b[fctl+4:fctl+8+26]))
+		})},
+		{"Frame Outside Canvas", apngData(t, image.Pt(2, 2), nil, []testFrame{
+			{img: filled(image.Rect(0, 0, 2, 2), red)},
+			{img: filled(image.Rect(1, 1, 3, 3), red)},
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := DecodeAnimation(bytes.NewReader(tt.data)); !errors.Is(err, errAPNGFormat) {
+				t.Errorf("%s: got error %v, want %v", tt.name, err, errAPNGFormat)
+			}
+		})
+	}
+}
+
+func TestCompareAnimations(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	changed := createTestImage(4, 4, gray).(*image.RGBA)
+	changed.Set(1, 1, color.RGBA{0, 0, 0, 255})
+	changed.Set(2, 2, color.RGBA{0, 0, 0, 255})
+	ms := time.Millisecond
+	left := &Animation{
+		Frames: []image.Image{createTestImage(4, 4, gray), createTestImage(4, 4, gray), createTestImage(4, 4, gray)},
+		Delays: []time.Duration{100 * ms, 100 * ms, 200 * ms},
+		Plays:  2,
+	}
+
+	tests := []struct {
+		name           string
+		right          *Animation
+		wantDiffFrames int
+		wantDiffCount  int64
+		wantWorst      int
+		wantDelays     []int
+		wantTiming     bool
+		wantExceeds    bool
+	}{
+		{
+			name:  "Identical",
+			right: left,
+		},
+		{
+			name: "Frame Differs",
+			right: &Animation{
+				Frames: []image.Image{createTestImage(4, 4, gray), changed, createTestImage(4, 4, gray)},
+				Delays: []time.Duration{100 * ms, 100 * ms, 200 * ms},
+			},
+			wantDiffFrames: 1,
+			wantDiffCount:  2,
+			wantWorst:      1,
+			wantExceeds:    true,
+		},
+		{
+			name: "Frame Count And Delays Differ",
+			right: &Animation{
+				Frames: []image.Image{createTestImage(4, 4, gray), createTestImage(4, 4, gray)},
+				Delays: []time.Duration{100 * ms, 150 * ms},
+			},
+			wantDelays: []int{1},
+			wantTiming: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := CompareAnimations(left, tt.right, Options{})
+			if err != nil {
+				t.Fatalf("%s: CompareAnimations: %v", tt.name, err)
+			}
+			if want := min(len(left.Frames), len(tt.right.Frames)); len(r.Frames) != want {
+				t.Errorf("%s: compared %d frames, want %d", tt.name, len(r.Frames), want)
+			}
+			if r.DiffFrames != tt.wantDiffFrames || r.DiffCount != tt.wantDiffCount || r.Worst != tt.wantWorst {
+				t.Errorf("%s: got %d differing frames, %d pixels, worst frame %d, want %d, %d, %d",
+					tt.name, r.DiffFrames, r.DiffCount, r.Worst, tt.wantDiffFrames, tt.wantDiffCount, tt.wantWorst)
+			}
+			if wantPercent := float64(tt.wantDiffCount) * 100 / float64(16*len(r.Frames)); r.DiffPercent != wantPercent {
+				t.Errorf("%s: DiffPercent got %v, want %v", tt.name, r.DiffPercent, wantPercent)
+			}
+			if len(r.DelayMismatches) != len(tt.wantDelays) || (len(tt.wantDelays) > 0 && r.DelayMismatches[0] != tt.wantDelays[0]) {
+				t.Errorf("%s: DelayMismatches got %v, want %v", tt.name, r.DelayMismatches, tt.wantDelays)
+			}
+			if r.FrameCountMismatch() != (len(left.Frames) != len(tt.right.Frames)) {
+				t.Errorf("%s: FrameCountMismatch got %v", tt.name, r.FrameCountMismatch())
+			}
+			if got := r.TimingMismatch(); got != tt.wantTiming {
+				t.Errorf("%s: TimingMismatch got %v, want %v", tt.name, got, tt.wantTiming)
+			}
+			// Identical pixels are within any threshold, whatever the timing
+			if got := r.Exceeds(Threshold{}); got != tt.wantExceeds {
+				t.Errorf("%s: Exceeds got %v, want %v", tt.name, got, tt.wantExceeds)
+			}
+			if got := r.Exceeds(Threshold{Percent: 100, IsPercent: true}); got {
+				t.Errorf("%s: Exceeds(100%%) got %v, want false", tt.name, got)
+			}
+		})
+	}
+
+	if _, err := CompareAnimations(left, &Animation{}, Options{}); err == nil {
+		t.Error("CompareAnimations without frames: got no error")
+	}
+	if _, err := CompareAnimations(left, &Animation{Frames: []image.Image{createTestImage(2, 2, gray)}}, Options{}); !errors.Is(err, ErrSizeMismatch) {
+		t.Errorf("CompareAnimations with frames of different sizes: got error %v, want %v", err, ErrSizeMismatch)
+	}
+}
+
+func TestDiffAnimation(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	changed := createTestImage(4, 4, gray).(*image.RGBA)
+	changed.Set(1, 1, color.RGBA{0, 0, 0, 255})
+	left := &Animation{
+		Frames: []image.Image{createTestImage(4, 4, gray), createTestImage(4, 4, gray)},
+		Delays: []time.Duration{100 * time.Millisecond, 300 * time.Millisecond},
+		Plays:  2,
+	}
+	right := &Animation{Frames: []image.Image{createTestImage(4, 4, gray), changed}}
+	r, err := CompareAnimations(left, right, Options{})
+	if err != nil {
+		t.Fatalf("CompareAnimations: %v", err)
+	}
+
+	for _, composite := range []bool{false, true} {
+		diff := r.DiffAnimation(composite)
+		wantWidth := 4
+		if composite {
+			wantWidth = r.Frames[0].Composite().Bounds().Dx()
+		}
+		if len(diff.Frames) != 2 || diff.Frames[1].Bounds().Dx() != wantWidth {
+			t.Fatalf("composite %v: got %d frames of width %d, want 2 of width %d", composite, len(diff.Frames), diff.Frames[1].Bounds().Dx(), wantWidth)
+		}
+
+		var apng, gifData bytes.Buffer
+		if err := diff.EncodeAPNG(&apng); err != nil {
+			t.Fatalf("composite %v: EncodeAPNG: %v", composite, err)
+		}
+		if err := diff.EncodeGIF(&gifData); err != nil {
+			t.Fatalf("composite %v: EncodeGIF: %v", composite, err)
+		}
+		for _, data := range [][]byte{apng.Bytes(), gifData.Bytes()} {
+			a, format, err := DecodeAnimation(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("composite %v: DecodeAnimation: %v", composite, err)
+			}
+			if len(a.Frames) != 2 || a.Delays[0] != left.Delays[0] || a.Delays[1] != left.Delays[1] || a.Plays != left.Plays {
+				t.Errorf("composite %v, %s: got %d frames, delays %v, %d plays, want the timing of the left animation", composite, format, len(a.Frames), a.Delays, a.Plays)
+			}
+			if got := rgba64(a.Frames[1].At(1, 1)); !composite && got != rgba64(r.Frames[1].Image.At(1, 1)) {
+				t.Errorf("composite %v, %s: differing pixel got %v, want the difference image", composite, format, got)
+			}
+		}
+	}
+}
+
+func TestEncodeAnimationPlays(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	for _, plays := range []int{0, 1, 2, 5} {
+		a := &Animation{
+			Frames: []image.Image{createTestImage(2, 2, gray), createTestImage(2, 2, color.White)},
+			Delays: []time.Duration{100 * time.Millisecond, 100 * time.Millisecond},
+			Plays:  plays,
+		}
+		var apng, gifData bytes.Buffer
+		if err := a.EncodeAPNG(&apng); err != nil {
+			t.Fatalf("plays %d: EncodeAPNG: %v", plays, err)
+		}
+		if err := a.EncodeGIF(&gifData); err != nil {
+			t.Fatalf("plays %d: EncodeGIF: %v", plays, err)
+		}
+		for _, data := range [][]byte{apng.Bytes(), gifData.Bytes()} {
+			got, format, err := DecodeAnimation(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("plays %d: DecodeAnimation: %v", plays, err)
+			}
+			if got.Plays != plays {
+				t.Errorf("plays %d, %s: round trip got %d plays", plays, format, got.Plays)
+			}
+		}
+	}
+}
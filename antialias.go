@@ -0,0 +1,100 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+)
+
+// AntiAliasColor marks anti-aliased pixels in the difference image when
+// Options.DetectAntiAliasing is set.
+var AntiAliasColor = color.RGBA{255, 255, 0, 255}
+
+// isAntiAliased reports whether the pixel at (x, y), relative to the origin
+// of img, looks like an anti-aliased edge pixel. It uses the neighbor
+// heuristic from pixelmatch (after Vysniauskas, "Anti-aliased Pixel and
+// Intensity Slope Detector", 2009): the pixel must have both a darker and a
+// brighter neighbor, at most two equal neighbors, and the darkest or
+// brightest neighbor must sit in a flat region in both img and other. other
+// is indexed relative to its own origin.
+func isAntiAliased(img, other image.Image, x, y int) bool {
+	size := img.Bounds().Size()
+	x0, y0 := max(x-1, 0), max(y-1, 0)
+	x2, y2 := min(x+1, size.X-1), min(y+1, size.Y-1)
+
+	zeroes := 0
+	if x == x0 || x == x2 || y == y0 || y == y2 {
+		zeroes = 1 // Pixels on the border have fewer neighbors
+	}
+
+	center := blendedLuma(img, x, y)
+	var minDelta, maxDelta float64
+	var darkest, brightest image.Point
+	for ny := y0; ny <= y2; ny++ {
+		for nx := x0; nx <= x2; nx++ {
+			if nx == x && ny == y {
+				continue
+			}
+			delta := blendedLuma(img, nx, ny) - center
+			switch {
+			case delta == 0:
+				zeroes++
+				if zeroes > 2 {
+					return false // Too many equal neighbors for an edge
+				}
+			case delta < minDelta:
+				minDelta = delta
+				darkest = image.Pt(nx, ny)
+			case delta > maxDelta:
+				maxDelta = delta
+				brightest = image.Pt(nx, ny)
+			}
+		}
+	}
+
+	// Anti-aliasing needs both a darker and a brighter neighbor
+	if minDelta == 0 || maxDelta == 0 {
+		return false
+	}
+
+	return (hasManySiblings(img, darkest) && hasManySiblings(other, darkest)) ||
+		(hasManySiblings(img, brightest) && hasManySiblings(other, brightest))
+}
+
+// hasManySiblings reports whether the pixel at p, relative to the origin of
+// img, has at least three neighbors of exactly the same color.
+func hasManySiblings(img image.Image, p image.Point) bool {
+	origin, size := img.Bounds().Min, img.Bounds().Size()
+	x0, y0 := max(p.X-1, 0), max(p.Y-1, 0)
+	x2, y2 := min(p.X+1, size.X-1), min(p.Y+1, size.Y-1)
+
+	zeroes := 0
+	if p.X == x0 || p.X == x2 || p.Y == y0 || p.Y == y2 {
+		zeroes = 1
+	}
+
+	r, g, b, a := img.At(origin.X+p.X, origin.Y+p.Y).RGBA()
+	for ny := y0; ny <= y2; ny++ {
+		for nx := x0; nx <= x2; nx++ {
+			if nx == p.X && ny == p.Y {
+				continue
+			}
+			nr, ng, nb, na := img.At(origin.X+nx, origin.Y+ny).RGBA()
+			if nr == r && ng == g && nb == b && na == a {
+				zeroes++
+			}
+			if zeroes > 2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// blendedLuma returns the luma of the pixel at (x, y), relative to the origin
+// of img, composited over white, in 8-bit units.
+func blendedLuma(img image.Image, x, y int) float64 {
+	origin := img.Bounds().Min
+	r, g, b, a := img.At(origin.X+x, origin.Y+y).RGBA() // Alpha-premultiplied
+	bg := float64(0xffff - a)
+	return (0.29889531*(float64(r)+bg) + 0.58662247*(float64(g)+bg) + 0.11448223*(float64(b)+bg)) / 257
+}
@@ -0,0 +1,84 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// Helper function to create a black/white vertical edge with an anti-aliased
+// gray column at x=5 and an optional isolated red pixel in the black area
+func createEdgeImage(edgeGray uint8, withSpot bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for y := range 10 {
+		for x := range 10 {
+			switch {
+			case x < 5:
+				img.Set(x, y, color.RGBA{0, 0, 0, 255})
+			case x == 5:
+				img.Set(x, y, color.RGBA{edgeGray, edgeGray, edgeGray, 255})
+			default:
+				img.Set(x, y, color.RGBA{255, 255, 255, 255})
+			}
+		}
+	}
+	if withSpot {
+		img.Set(2, 5, color.RGBA{255, 0, 0, 255})
+	}
+	return img
+}
+
+func TestIsAntiAliased(t *testing.T) {
+	edge1 := createEdgeImage(128, false)
+	edge2 := createEdgeImage(100, true)
+	tests := []struct {
+		name string
+		x, y int
+		want bool
+	}{
+		{name: "Edge Pixel", x: 5, y: 5, want: true},
+		{name: "Edge Pixel On Border", x: 5, y: 0, want: true},
+		{name: "Isolated Spot", x: 2, y: 5, want: false},
+		{name: "Flat Region", x: 8, y: 8, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := isAntiAliased(edge1, edge2, tt.x, tt.y) || isAntiAliased(edge2, edge1, tt.x, tt.y)
+			if got != tt.want {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareAntiAliasing(t *testing.T) {
+	edge1 := createEdgeImage(128, false)
+	edge2 := createEdgeImage(100, true)
+	tests := []struct {
+		name            string
+		detect          bool
+		wantDiffCount   int64
+		wantAntiAliased int64
+		wantEdgePixel   color.RGBA
+	}{
+		{name: "Detection Off", detect: false, wantDiffCount: 11, wantAntiAliased: 0, wantEdgePixel: color.RGBA{56, 56, 56, 255}},
+		{name: "Detection On", detect: true, wantDiffCount: 1, wantAntiAliased: 10, wantEdgePixel: AntiAliasColor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Compare(edge1, edge2, Options{DetectAntiAliasing: tt.detect})
+			if err != nil {
+				t.Fatalf("%s: Compare: %v", tt.name, err)
+			}
+			if res.DiffCount != tt.wantDiffCount || res.AntiAliased != tt.wantAntiAliased {
+				t.Errorf("%s: got DiffCount %d AntiAliased %d, want %d %d",
+					tt.name, res.DiffCount, res.AntiAliased, tt.wantDiffCount, tt.wantAntiAliased)
+			}
+			if gotPixel := res.Image.At(5, 3).(color.RGBA); gotPixel != tt.wantEdgePixel {
+				t.Errorf("%s: edge pixel got %v, want %v", tt.name, gotPixel, tt.wantEdgePixel)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package imagediff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"io"
+	"math"
+	"time"
+)
+
+// pngSignature starts every PNG file.
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// EncodeAPNG writes frames as an endlessly looping animated PNG showing each
+// frame for delay, rounded to milliseconds. Frames are stored losslessly as
+// 8-bit RGBA and must have the same size. Viewers without APNG support show
+// the first frame.
+func EncodeAPNG(w io.Writer, frames []image.Image, delay time.Duration) error {
+	delays := make([]time.Duration, len(frames))
+	for i := range delays {
+		delays[i] = delay
+	}
+	return encodeAPNG(w, frames, delays, 0)
+}
+
+// encodeAPNG writes frames as an animated PNG showing frame i for delays[i]
+// and played plays times, 0 for endlessly.
+func encodeAPNG(w io.Writer, frames []image.Image, delays []time.Duration, plays int) error {
+	if len(frames) == 0 {
+		return errNoFrames
+	}
+	size := frames[0].Bounds().Size()
+	for _, f := range frames[1:] {
+		if f.Bounds().Size() != size {
+			return errors.New("imagediff: animation frames differ in size")
+		}
+	}
+
+	e := &apngEncoder{w: w}
+	e.write([]byte(pngSignature))
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(size.X))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(size.Y))
+	ihdr[8] = 8  // Bit depth
+	ihdr[9] = 6  // Color type: truecolor with alpha
+	ihdr[10] = 0 // Compression method
+	ihdr[11] = 0 // Filter method
+	ihdr[12] = 0 // No interlacing
+	e.chunk("IHDR", ihdr)
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], uint32(len(frames)))
+	binary.BigEndian.PutUint32(actl[4:], uint32(max(plays, 0)))
+	e.chunk("acTL", actl)
+
+	var seq uint32
+	for i, f := range frames {
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(size.X))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(size.Y))
+		binary.BigEndian.PutUint32(fctl[12:], 0) // X offset
+		binary.BigEndian.PutUint32(fctl[16:], 0) // Y offset
+		var delayMs uint16
+		if i < len(delays) {
+			delayMs = uint16(min(max(delays[i].Milliseconds(), 0), math.MaxUint16))
+		}
+		binary.BigEndian.PutUint16(fctl[20:], delayMs)
+		binary.BigEndian.PutUint16(fctl[22:], 1000)
+		fctl[24] = 0 // Dispose: none
+		fctl[25] = 0 // Blend: source, replacing the previous frame
+		e.chunk("fcTL", fctl)
+		seq++
+
+		data, err := compressFrame(f)
+		if err != nil {
+			return err
+		}
+		// The first frame is the default image, readable by any PNG decoder
+		if i == 0 {
+			e.chunk("IDAT", data)
+			continue
+		}
+		fdat := make([]byte, 4+len(data))
+		binary.BigEndian.PutUint32(fdat, seq)
+		copy(fdat[4:], data)
+		e.chunk("fdAT", fdat)
+		seq++
+	}
+	e.chunk("IEND", nil)
+	return e.err
+}
+
+// apngEncoder writes PNG chunks, keeping the first error.
+type apngEncoder struct {
+	w   io.Writer
+	err error
+}
+
+func (e *apngEncoder) write(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+// chunk writes a PNG chunk: length, type, data and the CRC of type and data.
+func (e *apngEncoder) chunk(name string, data []byte) {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], name)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	e.write(header)
+	e.write(data)
+	e.write(binary.BigEndian.AppendUint32(nil, crc.Sum32()))
+}
+
+// compressFrame returns the zlib-compressed scanlines of img as 8-bit
+// non-premultiplied RGBA, each filtered with the PNG Sub filter.
+func compressFrame(img image.Image) ([]byte, error) {
+	b := img.Bounds()
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		nrgba = image.NewNRGBA(b)
+		draw.Draw(nrgba, b, img, b.Min, draw.Src)
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	row := make([]byte, 1+4*b.Dx())
+	row[0] = 1 // Sub filter
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		pix := nrgba.Pix[nrgba.PixOffset(b.Min.X, y):][:4*b.Dx()]
+		for i := range pix {
+			if i < 4 {
+				row[1+i] = pix[i]
+			} else {
+				row[1+i] = pix[i] - pix[i-4]
+			}
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,113 @@
+package imagediff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+)
+
+// pngChunk is a chunk read back from an encoded PNG
+type pngChunk struct {
+	name string
+	data []byte
+}
+
+// readChunks splits an encoded PNG into chunks, verifying their CRCs
+func readChunks(t *testing.T, b []byte) []pngChunk {
+	t.Helper()
+	if !bytes.HasPrefix(b, []byte(pngSignature)) {
+		t.Fatalf("missing PNG signature")
+	}
+	b = b[len(pngSignature):]
+	var chunks []pngChunk
+	for len(b) > 0 {
+		if len(b) < 12 {
+			t.Fatalf("truncated chunk")
+		}
+		n := binary.BigEndian.Uint32(b)
+		c := pngChunk{name: string(b[4:8]), data: b[8 : 8+n]}
+		if got, want := binary.BigEndian.Uint32(b[8+n:]), crc32.ChecksumIEEE(b[4:8+n]); got != want {
+			t.Errorf("%s chunk CRC got %08x, want %08x", c.name, got, want)
+		}
+		chunks = append(chunks, c)
+		b = b[12+n:]
+	}
+	return chunks
+}
+
+func TestEncodeAPNG(t *testing.T) {
+	translucent := image.NewNRGBA(image.Rect(0, 0, 5, 3))
+	for i := range translucent.Pix {
+		translucent.Pix[i] = uint8(i * 7)
+	}
+	frames := []image.Image{
+		translucent,
+		createTestImage(5, 3, color.RGBA{200, 0, 0, 255}),
+		gradientImage(5, 3),
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeAPNG(&buf, frames, 250*time.Millisecond); err != nil {
+		t.Fatalf("EncodeAPNG: %v", err)
+	}
+
+	// The default image is the first frame, losslessly
+	img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("png.Decode: %v", err)
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if got, want := color.NRGBAModel.Convert(img.At(x, y)), translucent.NRGBAAt(x, y); got != want {
+				t.Fatalf("pixel (%d, %d) got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+
+	var names []string
+	var seqs []uint32
+	for _, c := range readChunks(t, buf.Bytes()) {
+		names = append(names, c.name)
+		switch c.name {
+		case "acTL":
+			if frames, plays := binary.BigEndian.Uint32(c.data), binary.BigEndian.Uint32(c.data[4:]); frames != 3 || plays != 0 {
+				t.Errorf("acTL got %d frames and %d plays, want 3 and 0", frames, plays)
+			}
+		case "fcTL":
+			seqs = append(seqs, binary.BigEndian.Uint32(c.data))
+			if num, den := binary.BigEndian.Uint16(c.data[20:]), binary.BigEndian.Uint16(c.data[22:]); num != 250 || den != 1000 {
+				t.Errorf("fcTL delay got %d/%d, want 250/1000", num, den)
+			}
+		case "fdAT":
+			seqs = append(seqs, binary.BigEndian.Uint32(c.data))
+		}
+	}
+	wantNames := []string{"IHDR", "acTL", "fcTL", "IDAT", "fcTL", "fdAT", "fcTL", "fdAT", "IEND"}
+	if len(names) != len(wantNames) {
+		t.Fatalf("got chunks %v, want %v", names, wantNames)
+	}
+	for i := range names {
+		if names[i] != wantNames[i] {
+			t.Fatalf("got chunks %v, want %v", names, wantNames)
+		}
+	}
+	for i, seq := range seqs {
+		if seq != uint32(i) {
+			t.Errorf("sequence numbers got %v, want 0, 1, 2, ...", seqs)
+			break
+		}
+	}
+
+	if err := EncodeAPNG(&bytes.Buffer{}, nil, time.Second); err == nil {
+		t.Error("EncodeAPNG without frames: got no error")
+	}
+	if err := EncodeAPNG(&bytes.Buffer{}, []image.Image{frames[0], createTestImage(4, 4, color.Black)}, time.Second); err == nil {
+		t.Error("EncodeAPNG with frames of different sizes: got no error")
+	}
+}
@@ -0,0 +1,110 @@
+package imagediff
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+)
+
+// errNoFrames is returned when encoding an animation without frames.
+var errNoFrames = errors.New("imagediff: animation has no frames")
+
+// BlinkFrames returns the frames of an animation alternating the compared left
+// and right images, followed by the difference image if withDiff is set.
+// The frames share the size of the largest image, with the images at the
+// top-left corner, and the input frames are tone mapped and marked like
+// Composite.
+func (r *Result) BlinkFrames(withDiff bool) []image.Image {
+	leftSize, rightSize, diffSize := r.Left.Bounds().Size(), r.Right.Bounds().Size(), r.Image.Bounds().Size()
+	canvas := image.Rect(0, 0, max(leftSize.X, rightSize.X, diffSize.X), max(leftSize.Y, rightSize.Y, diffSize.Y))
+	frame := func(img image.Image) *image.RGBA {
+		f := image.NewRGBA(canvas)
+		b := img.Bounds()
+		draw.Draw(f, b.Sub(b.Min), img, b.Min, draw.Src)
+		return f
+	}
+
+	left, right := frame(r.ToneMapped(r.Left)), frame(r.ToneMapped(r.Right))
+	r.markPanel(left, image.Rectangle{Max: leftSize})
+	r.markPanel(right, image.Rectangle{Max: rightSize})
+	frames := []image.Image{left, right}
+	if withDiff {
+		frames = append(frames, frame(r.Image))
+	}
+	return frames
+}
+
+// EncodeGIF writes frames as an endlessly looping animated GIF showing each
+// frame for delay, rounded to hundredths of a second. The frames must have
+// the same bounds.
+//
+// GIF frames are limited to 256 colors. If the frames use more, they are
+// mapped to a fixed palette without dithering, so that pixels that do not
+// change between frames do not flicker either; use EncodeAPNG for lossless
+// frames.
+func EncodeGIF(w io.Writer, frames []image.Image, delay time.Duration) error {
+	delays := make([]time.Duration, len(frames))
+	for i := range delays {
+		delays[i] = max(delay, 10*time.Millisecond)
+	}
+	return encodeGIF(w, frames, delays, 0)
+}
+
+// encodeGIF writes frames as an animated GIF showing frame i for delays[i]
+// and played plays times, 0 for endlessly.
+func encodeGIF(w io.Writer, frames []image.Image, delays []time.Duration, plays int) error {
+	if len(frames) == 0 {
+		return errNoFrames
+	}
+	pal := gifPalette(frames)
+	// LoopCount counts the repetitions after the first play: 0 loops
+	// endlessly and -1 plays once, without a loop extension
+	anim := &gif.GIF{}
+	switch {
+	case plays == 1:
+		anim.LoopCount = -1
+	case plays > 1:
+		anim.LoopCount = plays - 1
+	}
+	for i, f := range frames {
+		p := image.NewPaletted(f.Bounds(), pal)
+		draw.Draw(p, p.Bounds(), f, f.Bounds().Min, draw.Src)
+		var centiseconds int
+		if i < len(delays) {
+			centiseconds = int(delays[i].Round(10*time.Millisecond) / (10 * time.Millisecond))
+		}
+		anim.Image = append(anim.Image, p)
+		anim.Delay = append(anim.Delay, centiseconds)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// gifPalette returns the colors used by frames if there are at most 256 of
+// them, and palette.Plan9 otherwise.
+func gifPalette(frames []image.Image) color.Palette {
+	seen := make(map[color.RGBA]bool)
+	var pal color.Palette
+	for _, f := range frames {
+		b := f.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.RGBAModel.Convert(f.At(x, y)).(color.RGBA)
+				if seen[c] {
+					continue
+				}
+				if len(pal) == 256 {
+					return palette.Plan9
+				}
+				seen[c] = true
+				pal = append(pal, c)
+			}
+		}
+	}
+	return pal
+}
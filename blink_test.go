@@ -0,0 +1,172 @@
+package imagediff
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+	"time"
+)
+
+func TestBlinkFrames(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	changed := createTestImage(8, 8, gray).(*image.RGBA)
+	changed.Set(5, 5, color.RGBA{0, 0, 0, 255})
+	tests := []struct {
+		name     string
+		right    image.Image
+		opts     Options
+		withDiff bool
+		check    func(t *testing.T, frames []image.Image)
+	}{
+		{
+			name:  "Left And Right",
+			right: createTestImage(8, 8, color.RGBA{200, 100, 100, 255}),
+			check: func(t *testing.T, frames []image.Image) {
+				if got := frames[0].At(3, 3); got != gray {
+					t.Errorf("left frame pixel got %v, want %v", got, gray)
+				}
+				if got := frames[1].At(3, 3); got != (color.RGBA{200, 100, 100, 255}) {
+					t.Errorf("right frame pixel got %v, want the right image", got)
+				}
+			},
+		},
+		{
+			name:     "Difference Frame And Padding",
+			right:    createTestImage(8, 6, gray),
+			opts:     Options{SizePolicy: SizePolicyIntersect},
+			withDiff: true,
+			check: func(t *testing.T, frames []image.Image) {
+				if got := frames[1].At(3, 7); got != (color.RGBA{}) {
+					t.Errorf("right frame below the right image got %v, want transparent", got)
+				}
+				if got := frames[2].At(3, 3); got != (color.RGBA{0, 0, 0, 255}) {
+					t.Errorf("difference frame pixel got %v, want black", got)
+				}
+			},
+		},
+		{
+			name:  "Clusters And Ignored Pixels Marked",
+			right: changed,
+			opts: Options{
+				DrawClusters: true,
+				Ignore:       []image.Rectangle{image.Rect(0, 0, 2, 2)},
+			},
+			check: func(t *testing.T, frames []image.Image) {
+				for i, f := range frames[:2] {
+					if got := f.At(0, 0); got == gray {
+						t.Errorf("frame %d: ignored pixel not dimmed", i)
+					}
+					if got := f.At(4, 4); got != ClusterColor {
+						t.Errorf("frame %d: cluster outline got %v, want %v", i, got, ClusterColor)
+					}
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Compare(createTestImage(8, 8, gray), tt.right, tt.opts)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			frames := result.BlinkFrames(tt.withDiff)
+			wantFrames := 2
+			if tt.withDiff {
+				wantFrames = 3
+			}
+			if len(frames) != wantFrames {
+				t.Fatalf("%s: got %d frames, want %d", tt.name, len(frames), wantFrames)
+			}
+			for i, f := range frames {
+				if f.Bounds() != image.Rect(0, 0, 8, 8) {
+					t.Errorf("%s: frame %d bounds got %v, want 8x8", tt.name, i, f.Bounds())
+				}
+			}
+			tt.check(t, frames)
+		})
+	}
+}
+
+// gradientImage returns an image using more colors than a GIF palette holds
+func gradientImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.RGBA{uint8(x * 8), uint8(y * 8), 128, 255})
+		}
+	}
+	return img
+}
+
+func TestEncodeGIF(t *testing.T) {
+	changed := gradientImage(32, 32)
+	changed.Set(10, 10, color.RGBA{255, 0, 0, 255})
+	tests := []struct {
+		name      string
+		frames    []image.Image
+		delay     time.Duration
+		wantDelay int
+		exact     bool // Frames use at most 256 colors and round trip exactly
+	}{
+		{
+			name:      "Few Colors",
+			frames:    []image.Image{createTestImage(4, 4, color.RGBA{100, 100, 100, 255}), createTestImage(4, 4, color.RGBA{200, 0, 0, 255})},
+			delay:     500 * time.Millisecond,
+			wantDelay: 50,
+			exact:     true,
+		},
+		{
+			name:      "Many Colors",
+			frames:    []image.Image{gradientImage(32, 32), changed, gradientImage(32, 32)},
+			delay:     time.Millisecond,
+			wantDelay: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := EncodeGIF(&buf, tt.frames, tt.delay); err != nil {
+				t.Fatalf("%s: EncodeGIF: %v", tt.name, err)
+			}
+			anim, err := gif.DecodeAll(&buf)
+			if err != nil {
+				t.Fatalf("%s: DecodeAll: %v", tt.name, err)
+			}
+			if len(anim.Image) != len(tt.frames) || anim.LoopCount != 0 {
+				t.Fatalf("%s: got %d frames looping %d, want %d frames looping forever", tt.name, len(anim.Image), anim.LoopCount, len(tt.frames))
+			}
+			for i, d := range anim.Delay {
+				if d != tt.wantDelay {
+					t.Errorf("%s: frame %d delay got %d, want %d", tt.name, i, d, tt.wantDelay)
+				}
+			}
+			if tt.exact {
+				for i, f := range tt.frames {
+					want := color.RGBAModel.Convert(f.At(1, 1))
+					if got := color.RGBAModel.Convert(anim.Image[i].At(1, 1)); got != want {
+						t.Errorf("%s: frame %d pixel got %v, want %v", tt.name, i, got, want)
+					}
+				}
+				return
+			}
+			// Without dithering, pixels that do not change do not flicker
+			b := anim.Image[0].Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					same := anim.Image[0].ColorIndexAt(x, y) == anim.Image[1].ColorIndexAt(x, y)
+					if changedPixel := x == 10 && y == 10; !changedPixel && !same {
+						t.Fatalf("%s: unchanged pixel (%d, %d) differs between frames", tt.name, x, y)
+					}
+				}
+			}
+		})
+	}
+
+	if err := EncodeGIF(&bytes.Buffer{}, nil, time.Second); err == nil {
+		t.Error("EncodeGIF without frames: got no error")
+	}
+}
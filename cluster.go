@@ -0,0 +1,116 @@
+package imagediff
+
+import (
+	"cmp"
+	"image"
+	"image/color"
+	"image/draw"
+	"slices"
+)
+
+// ClusterColor outlines clusters of differing pixels when
+// Options.DrawClusters is set.
+var ClusterColor = color.RGBA{0, 255, 255, 255}
+
+// Cluster is a group of 8-connected differing pixels.
+type Cluster struct {
+	Bounds   image.Rectangle // Bounding box, in the coordinate space of the difference image
+	Area     int64           // Number of differing pixels
+	MaxError ChannelError    // Largest raw per-channel difference in 8-bit units
+}
+
+// findClusters labels the 8-connected components of the opaque pixels of
+// diffMask and returns them largest first. left and right are the compared
+// images, matched by their offset from their own origins.
+func findClusters(diffMask *image.Alpha, left, right image.Image) []Cluster {
+	bounds := diffMask.Bounds()
+	offset := right.Bounds().Min.Sub(left.Bounds().Min)
+	visited := make([]bool, bounds.Dx()*bounds.Dy())
+	index := func(p image.Point) int {
+		return (p.Y-bounds.Min.Y)*bounds.Dx() + p.X - bounds.Min.X
+	}
+
+	var clusters []Cluster
+	var stack []image.Point
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			start := image.Pt(x, y)
+			if visited[index(start)] || diffMask.AlphaAt(x, y).A == 0 {
+				continue
+			}
+
+			// Flood fill from the first unvisited differing pixel
+			var c Cluster
+			visited[index(start)] = true
+			stack = append(stack[:0], start)
+			for len(stack) > 0 {
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				c.Area++
+				c.Bounds = c.Bounds.Union(image.Rect(p.X, p.Y, p.X+1, p.Y+1))
+				c.MaxError = maxChannelError(c.MaxError, rawError(left, p, right, p.Add(offset)))
+
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						n := p.Add(image.Pt(dx, dy))
+						if !n.In(bounds) || visited[index(n)] || diffMask.AlphaAt(n.X, n.Y).A == 0 {
+							continue
+						}
+						visited[index(n)] = true
+						stack = append(stack, n)
+					}
+				}
+			}
+			clusters = append(clusters, c)
+		}
+	}
+
+	// Largest first; ties in reading order of the top-left corner
+	slices.SortStableFunc(clusters, func(a, b Cluster) int {
+		return cmp.Or(
+			cmp.Compare(b.Area, a.Area),
+			cmp.Compare(a.Bounds.Min.Y, b.Bounds.Min.Y),
+			cmp.Compare(a.Bounds.Min.X, b.Bounds.Min.X),
+		)
+	})
+	return clusters
+}
+
+// rawError returns the absolute per-channel difference in 8-bit units of
+// the pixel at p in left and the pixel at q in right, computed from their
+// levels like the per-channel errors of Compare, so that float values are
+// not clamped.
+func rawError(left image.Image, p image.Point, right image.Image, q image.Point) ChannelError {
+	r1, g1, b1, a1 := levels(left, p.X, p.Y)
+	r2, g2, b2, a2 := levels(right, q.X, q.Y)
+	return ChannelError{absDiff(r1, r2), absDiff(g1, g2), absDiff(b1, b2), absDiff(a1, a2)}
+}
+
+func maxChannelError(e, o ChannelError) ChannelError {
+	return ChannelError{max(e.R, o.R), max(e.G, o.G), max(e.B, o.B), max(e.A, o.A)}
+}
+
+// drawClusters outlines each cluster in ClusterColor, one pixel outside its
+// bounds where possible, after translating the bounds by offset. Nothing is
+// drawn outside clip.
+func drawClusters(img draw.Image, clip image.Rectangle, clusters []Cluster, offset image.Point) {
+	bounds := img.Bounds().Intersect(clip)
+	for _, c := range clusters {
+		r := c.Bounds.Add(offset).Inset(-1)
+		for x := r.Min.X; x < r.Max.X; x++ {
+			setIn(img, bounds, x, r.Min.Y)
+			setIn(img, bounds, x, r.Max.Y-1)
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			setIn(img, bounds, r.Min.X, y)
+			setIn(img, bounds, r.Max.X-1, y)
+		}
+	}
+}
+
+// setIn sets the pixel at (x, y) to ClusterColor if it lies within bounds.
+func setIn(img draw.Image, bounds image.Rectangle, x, y int) {
+	if image.Pt(x, y).In(bounds) {
+		img.Set(x, y, ClusterColor)
+	}
+}
@@ -0,0 +1,164 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFindClusters(t *testing.T) {
+	black := color.RGBA{0, 0, 0, 255}
+	tests := []struct {
+		name   string
+		pixels map[image.Point]color.RGBA // Pixels changed in the right image
+		want   []Cluster
+	}{
+		{
+			name: "No Differences",
+		},
+		{
+			name: "Diagonal Neighbors Connect",
+			pixels: map[image.Point]color.RGBA{
+				{2, 2}: {255, 0, 0, 255},
+				{3, 3}: {0, 100, 0, 255},
+				{4, 4}: {0, 0, 50, 255},
+			},
+			want: []Cluster{
+				{Bounds: image.Rect(2, 2, 5, 5), Area: 3, MaxError: ChannelError{255, 100, 50, 0}},
+			},
+		},
+		{
+			name: "Largest First",
+			pixels: map[image.Point]color.RGBA{
+				{0, 0}:   {10, 0, 0, 255},
+				{10, 10}: {20, 0, 0, 255},
+				{11, 10}: {20, 0, 0, 255},
+				{15, 0}:  {30, 0, 0, 255},
+				{15, 1}:  {30, 0, 0, 255},
+				{15, 2}:  {30, 0, 0, 255},
+			},
+			want: []Cluster{
+				{Bounds: image.Rect(15, 0, 16, 3), Area: 3, MaxError: ChannelError{R: 30}},
+				{Bounds: image.Rect(10, 10, 12, 11), Area: 2, MaxError: ChannelError{R: 20}},
+				{Bounds: image.Rect(0, 0, 1, 1), Area: 1, MaxError: ChannelError{R: 10}},
+			},
+		},
+		{
+			// The diagonal is found after the block, from its first pixel
+			// (9, 0), but its top-left corner comes first
+			name: "Ties In Reading Order",
+			pixels: map[image.Point]color.RGBA{
+				{3, 0}: {10, 0, 0, 255}, {4, 0}: {10, 0, 0, 255}, {5, 0}: {10, 0, 0, 255}, {6, 0}: {10, 0, 0, 255},
+				{3, 1}: {10, 0, 0, 255}, {4, 1}: {10, 0, 0, 255}, {5, 1}: {10, 0, 0, 255},
+				{3, 2}: {10, 0, 0, 255},
+				{9, 0}: {20, 0, 0, 255}, {8, 1}: {20, 0, 0, 255}, {7, 2}: {20, 0, 0, 255}, {6, 3}: {20, 0, 0, 255},
+				{5, 4}: {20, 0, 0, 255}, {4, 5}: {20, 0, 0, 255}, {3, 6}: {20, 0, 0, 255}, {2, 7}: {20, 0, 0, 255},
+			},
+			want: []Cluster{
+				{Bounds: image.Rect(2, 0, 10, 8), Area: 8, MaxError: ChannelError{R: 20}},
+				{Bounds: image.Rect(3, 0, 7, 3), Area: 8, MaxError: ChannelError{R: 10}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left := createTestImage(16, 16, black)
+			right := image.NewRGBA(image.Rect(0, 0, 16, 16))
+			for y := 0; y < 16; y++ {
+				for x := 0; x < 16; x++ {
+					right.Set(x, y, black)
+				}
+			}
+			for p, c := range tt.pixels {
+				right.Set(p.X, p.Y, c)
+			}
+
+			res, err := Compare(left, right, Options{Clusters: true})
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			if len(res.Clusters) != len(tt.want) {
+				t.Fatalf("%s: got %d clusters %v, want %d", tt.name, len(res.Clusters), res.Clusters, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := res.Clusters[i]
+				if got.Bounds != want.Bounds || got.Area != want.Area || got.MaxError != want.MaxError {
+					t.Errorf("%s: cluster %d got %+v, want %+v", tt.name, i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFindClustersFloat(t *testing.T) {
+	// Differences of float inputs exceed the 8-bit range and are not clamped
+	left := newTestFloatImage(4, 4, 0.5)
+	right := newTestFloatImage(4, 4, 0.5)
+	right.SetFloat(1, 1, 3, 0.5, 0.25, 1)
+	right.SetFloat(2, 1, 0.5, 0.5, 0.5, 1)
+	right.SetFloat(2, 2, 0.5, 0.5, 0.75, 1)
+
+	res, err := Compare(left, right, Options{Clusters: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Clusters) != 1 {
+		t.Fatalf("got %d clusters %v, want 1", len(res.Clusters), res.Clusters)
+	}
+	c := res.Clusters[0]
+	want := ChannelError{R: 2.5 * 255, B: 0.25 * 255}
+	if c.Bounds != image.Rect(1, 1, 3, 3) || c.Area != 2 || !approxEqual(c.MaxError.R, want.R, 1e-6) || !approxEqual(c.MaxError.B, want.B, 1e-6) || c.MaxError.G != 0 {
+		t.Errorf("got cluster %+v, want bounds (1,1)-(3,3), area 2, MaxError %+v", c, want)
+	}
+	if c.MaxError != res.MaxError {
+		t.Errorf("cluster MaxError %+v differs from Result.MaxError %+v", c.MaxError, res.MaxError)
+	}
+}
+
+func TestDrawClusters(t *testing.T) {
+	black := color.RGBA{0, 0, 0, 255}
+	left := createTestImage(8, 8, black)
+	right := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			right.Set(x, y, black)
+		}
+	}
+	right.Set(3, 3, color.RGBA{100, 0, 0, 255})
+	right.Set(0, 7, color.RGBA{100, 0, 0, 255})
+
+	res, err := Compare(left, right, Options{DrawClusters: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Options.Clusters || len(res.Clusters) != 2 {
+		t.Fatalf("got Clusters %v with %d clusters, want enabled with 2", res.Options.Clusters, len(res.Clusters))
+	}
+
+	// The outline surrounds the cluster, leaving the differing pixel visible
+	for _, p := range []image.Point{{2, 2}, {3, 2}, {4, 2}, {2, 3}, {4, 3}, {2, 4}, {3, 4}, {4, 4}} {
+		if got := res.Image.At(p.X, p.Y); got != ClusterColor {
+			t.Errorf("diff pixel %v got %v, want %v", p, got, ClusterColor)
+		}
+	}
+	if got, want := res.Image.At(3, 3), (color.RGBA{200, 0, 0, 255}); got != want {
+		t.Errorf("diff pixel (3, 3) got %v, want %v", got, want)
+	}
+	// Outlines at the image border are clipped
+	if got := res.Image.At(1, 6); got != ClusterColor {
+		t.Errorf("diff pixel (1, 6) got %v, want %v", got, ClusterColor)
+	}
+
+	// The composite outlines the clusters on all three panels without
+	// crossing into a neighboring panel
+	composite := res.Composite()
+	for _, x := range []int{2, 8 + 2, 16 + 2} {
+		if got := composite.At(x, 2); got != ClusterColor {
+			t.Errorf("composite pixel (%d, 2) got %v, want %v", x, got, ClusterColor)
+		}
+	}
+	if got := composite.At(15, 6); got == ClusterColor {
+		t.Errorf("composite pixel (15, 6) got %v, want no outline", got)
+	}
+}
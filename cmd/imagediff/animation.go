@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/erdichen/imagediff"
+)
+
+// isAnimated reports whether either input has several frames, so that the
+// pair is compared frame by frame
+func isAnimated(left, right *imagediff.Animation) bool {
+	return len(left.Frames) > 1 || len(right.Frames) > 1
+}
+
+// frameCount describes the number of frames of an animation for log
+// messages, empty for still images
+func frameCount(a *imagediff.Animation) string {
+	if len(a.Frames) == 1 {
+		return ""
+	}
+	return fmt.Sprintf(", %d frames", len(a.Frames))
+}
+
+// compareFrames compares two animations frame by frame into o and writes the
+// animated output image to output. o.Result is set to the frame with the
+// most differing pixels. Frame count and delay mismatches only exceed the
+// threshold with -strict-timing.
+func compareFrames(o pairOutcome, left, right *imagediff.Animation, output string, opts imagediff.Options, threshold imagediff.Threshold, outOpts outputOptions, start time.Time) pairOutcome {
+	if err := outOpts.checkAnimated(); err != nil {
+		o.Err = err
+		return o
+	}
+	compareStart := time.Now()
+	anim, err := imagediff.CompareAnimations(left, right, opts)
+	if err != nil {
+		o.Err = err
+		return o
+	}
+	o.Timing.Compare = time.Since(compareStart)
+	o.Animation = anim
+	o.Result = anim.Frames[anim.Worst]
+	o.Exceeded = anim.Exceeds(threshold) || (*strictTimingPtr && anim.TimingMismatch())
+
+	writeStart := time.Now()
+	if err := writeAnimationOutput(output, anim, outOpts); err != nil {
+		o.Err = err
+		return o
+	}
+	o.Output = output
+	o.Timing.Write = time.Since(writeStart)
+	o.Timing.Total = time.Since(start)
+	return o
+}
+
+// checkAnimated returns an error if o selects an output that cannot show
+// the frames of animations
+func (o outputOptions) checkAnimated() error {
+	switch {
+	case o.Blink != blinkNone:
+		return errors.New("-blink cannot be used with animated inputs")
+	case o.Netpbm != "":
+		return fmt.Errorf("-output-format %s cannot hold animations; use png", o.Netpbm)
+	}
+	return nil
+}
+
+// encodeAnimationOutput encodes the difference image of each compared frame
+// of r, or its composite with -include-inputs, as an animated PNG with the
+// timing of the left animation
+func encodeAnimationOutput(w io.Writer, r *imagediff.AnimationResult, o outputOptions) error {
+	if err := o.checkAnimated(); err != nil {
+		return err
+	}
+	if r.Frames[0].Options.Verbose {
+		log.Printf("Creating difference animation of %d frames as APNG", len(r.Frames))
+	}
+	a := r.DiffAnimation(o.Composite)
+	for i, f := range a.Frames {
+		a.Frames[i] = o.withLegend(r.Frames[i], f)
+	}
+	return a.EncodeAPNG(w)
+}
+
+// writeAnimationOutput writes the output animation of r to path, creating
+// parent directories
+func writeAnimationOutput(path string, r *imagediff.AnimationResult, o outputOptions) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return writeFile(path, func(w io.Writer) error {
+		return encodeAnimationOutput(w, r, o)
+	})
+}
+
+// printFrames prints the frame count and delay mismatches of r and the
+// differing frames
+func printFrames(w io.Writer, r *imagediff.AnimationResult) {
+	if r.FrameCountMismatch() {
+		fmt.Fprintf(w, "Frame count differs: left %d, right %d; compared the first %d\n", len(r.Left.Frames), len(r.Right.Frames), len(r.Frames))
+	}
+	for _, i := range r.DelayMismatches {
+		fmt.Fprintf(w, "Frame %d delay differs: left %v, right %v\n", i, r.Left.Delays[i], r.Right.Delays[i])
+	}
+	for i, f := range r.Frames {
+		if f.DiffCount > 0 {
+			fmt.Fprintf(w, "Frame %d: %.2f%% %d differing pixels\n", i, f.DiffPercent, f.DiffCount)
+		}
+	}
+}
+
+// animationMain compares the animations decoded from -left and -right frame
+// by frame and returns the exit status
+func animationMain(left, right *imagediff.Animation, leftInfo, rightInfo inputInfo, opts imagediff.Options, outOpts outputOptions, threshold imagediff.Threshold, report reportFormat, out io.Writer, start time.Time) int {
+	decodeTime := time.Since(start)
+	outputFile := *outputPtr
+	if outputFile == "" {
+		tmpFile, err := os.CreateTemp("", "imagediff-*.png")
+		if err != nil {
+			if *verbosePtr {
+				log.Printf("Error creating temporary file: %v", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error creating temporary file: %v\n", err)
+			}
+			return exitError
+		}
+		tmpFile.Close()
+		outputFile = tmpFile.Name()
+		if *verbosePtr {
+			log.Printf("Created temporary output file: %s", outputFile)
+		}
+	}
+
+	o := pairOutcome{Name: *rightPtr, Left: leftInfo, Right: rightInfo, Timing: timing{Decode: decodeTime}}
+	o = compareFrames(o, left, right, outputFile, opts, threshold, outOpts, start)
+	if errors.Is(o.Err, imagediff.ErrSizeMismatch) {
+		log.Printf("Error: %v (use -size-policy to compare anyway)", o.Err)
+		return exitError
+	} else if o.Err != nil {
+		log.Printf("Error: %v", o.Err)
+		return exitError
+	}
+
+	anim := o.Animation
+	fmt.Fprintf(out, "Difference animation of %d frames successfully created: %s (%s)\n", len(anim.Frames), outputFile, diffSummary(o))
+	printFrames(out, anim)
+	if *metricsPtr {
+		fmt.Fprintf(out, "Metrics of frame %d, which differs most:\n", anim.Worst)
+		printMetrics(out, o.Result.Metrics)
+	}
+	if o.Exceeded && *failOnDiffPtr {
+		fmt.Fprintf(out, "Images differ beyond threshold %v\n", threshold)
+	}
+
+	if err := writePairReports([]pairOutcome{o}, threshold, start); err != nil {
+		if *verbosePtr {
+			log.Printf("Error: %v", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return exitError
+	}
+	if report == reportJSON {
+		if err := writeReport(*reportFilePtr, newPairJSONReport(o, threshold, *metricsPtr)); err != nil {
+			if *verbosePtr {
+				log.Printf("Error writing report: %v", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			}
+			return exitError
+		}
+	}
+
+	if !*headlessPtr {
+		if err := viewOutput(outputFile); err != nil {
+			if *verbosePtr {
+				log.Printf("Error opening image: %v", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error opening image: %v\n", err)
+			}
+			return exitError
+		}
+	}
+
+	if o.Exceeded && *failOnDiffPtr {
+		return exitDiff
+	}
+	return 0
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erdichen/imagediff"
+)
+
+// solidAnimation returns an animation of 4x4 frames of the given colors,
+// each shown for delay
+func solidAnimation(delay time.Duration, colors ...color.Color) *imagediff.Animation {
+	a := &imagediff.Animation{}
+	for _, c := range colors {
+		a.Frames = append(a.Frames, solidImage(4, 4, c))
+		a.Delays = append(a.Delays, delay)
+	}
+	return a
+}
+
+func TestCompareFrames(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	red := color.RGBA{200, 100, 100, 255}
+	left := solidAnimation(100*time.Millisecond, gray, gray, gray)
+	right := solidAnimation(100*time.Millisecond, gray, red)
+	right.Delays[0] = 200 * time.Millisecond
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		outOpts outputOptions
+		opts    imagediff.Options
+		wantErr string
+		width   int // Of the output frames
+		height  int
+	}{
+		{name: "Difference", width: 4, height: 4},
+		{
+			name:    "Composite With Legend",
+			outOpts: outputOptions{Composite: true, Legend: true},
+			opts:    imagediff.Options{DiffMode: imagediff.DiffModeHeatmap},
+			width:   160,
+			height:  36,
+		},
+		{name: "Blink", outOpts: outputOptions{Blink: blinkGIF}, wantErr: "-blink cannot be used with animated inputs"},
+		{name: "Netpbm", outOpts: outputOptions{Netpbm: imagediff.NetpbmPPM}, wantErr: "-output-format ppm cannot hold animations"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(dir, tt.name, "diff.png")
+			o := pairOutcome{Name: "anim.gif"}
+			o = compareFrames(o, left, right, output, tt.opts, imagediff.Threshold{}, tt.outOpts, time.Now())
+			if tt.wantErr != "" {
+				if o.Err == nil || !strings.HasPrefix(o.Err.Error(), tt.wantErr) {
+					t.Errorf("%s: got error %v, want %q", tt.name, o.Err, tt.wantErr)
+				}
+				return
+			}
+			if o.Err != nil {
+				t.Fatalf("%s: compareFrames: %v", tt.name, o.Err)
+			}
+			if o.Animation == nil || o.Result != o.Animation.Frames[1] || !o.Exceeded {
+				t.Errorf("%s: got result %p of %v, exceeded %v, want the differing frame 1, exceeded", tt.name, o.Result, o.Animation, o.Exceeded)
+			}
+
+			f, err := os.Open(o.Output)
+			if err != nil {
+				t.Fatalf("%s: output not written: %v", tt.name, err)
+			}
+			defer f.Close()
+			a, format, err := imagediff.DecodeAnimation(f)
+			if err != nil {
+				t.Fatalf("%s: DecodeAnimation: %v", tt.name, err)
+			}
+			if format != "png" || len(a.Frames) != 2 || a.Delays[1] != 100*time.Millisecond {
+				t.Errorf("%s: got %s of %d frames, delays %v, want an APNG of 2 frames with the left delays", tt.name, format, len(a.Frames), a.Delays)
+			}
+			if b := a.Frames[0].Bounds(); b != image.Rect(0, 0, tt.width, tt.height) {
+				t.Errorf("%s: frame bounds got %v, want %dx%d", tt.name, b, tt.width, tt.height)
+			}
+		})
+	}
+
+	o := compareFrames(pairOutcome{Name: "anim.gif"}, left, right, filepath.Join(dir, "report.png"), imagediff.Options{}, imagediff.Threshold{}, outputOptions{}, time.Now())
+	if o.Err != nil {
+		t.Fatalf("compareFrames: %v", o.Err)
+	}
+	if got, want := diffSummary(o), "1 of 2 frames differ, 50.00% 16 differing pixels, frame count 3 vs 2, 1 frame delays differ"; got != want {
+		t.Errorf("diffSummary got %q, want %q", got, want)
+	}
+	var buf bytes.Buffer
+	printFrames(&buf, o.Animation)
+	for _, want := range []string{
+		"Frame count differs: left 3, right 2; compared the first 2\n",
+		"Frame 0 delay differs: left 100ms, right 200ms\n",
+		"Frame 1: 100.00% 16 differing pixels\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("printFrames output %q lacks %q", buf.String(), want)
+		}
+	}
+
+	buf.Reset()
+	if err := writeJSONReport(&buf, newPairJSONReport(o, imagediff.Threshold{}, false)); err != nil {
+		t.Fatalf("writeJSONReport: %v", err)
+	}
+	var doc struct {
+		DiffCount int64 `json:"diffCount"`
+		Exceeded  bool  `json:"exceeded"`
+		Animation struct {
+			Shown           int   `json:"shown"`
+			DiffFrames      int   `json:"diffFrames"`
+			DelayMismatches []int `json:"delayMismatches"`
+			Frames          []struct {
+				DiffCount    int64   `json:"diffCount"`
+				LeftDelayMs  float64 `json:"leftDelayMs"`
+				RightDelayMs float64 `json:"rightDelayMs"`
+				Exceeded     bool    `json:"exceeded"`
+			} `json:"frames"`
+		} `json:"animation"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	a := doc.Animation
+	if doc.DiffCount != 16 || !doc.Exceeded || a.Shown != 1 || a.DiffFrames != 1 || len(a.DelayMismatches) != 1 || len(a.Frames) != 2 {
+		t.Fatalf("got report %+v, want frame 1 shown with 16 differing pixels, exceeded", doc)
+	}
+	if f := a.Frames[0]; f.DiffCount != 0 || f.LeftDelayMs != 100 || f.RightDelayMs != 200 || f.Exceeded {
+		t.Errorf("frame 0 got %+v, want no differences and delays of 100 and 200 ms", f)
+	}
+	if !a.Frames[1].Exceeded {
+		t.Errorf("frame 1 got %+v, want exceeded", a.Frames[1])
+	}
+}
+
+func TestCompareFramesTiming(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	left := solidAnimation(100*time.Millisecond, gray, gray, gray)
+	retimed := solidAnimation(100*time.Millisecond, gray, gray, gray)
+	retimed.Delays[1] = 300 * time.Millisecond
+	shorter := solidAnimation(100*time.Millisecond, gray, gray)
+	dir := t.TempDir()
+	defer func(strict bool) { *strictTimingPtr = strict }(*strictTimingPtr)
+
+	tests := []struct {
+		name   string
+		right  *imagediff.Animation
+		strict bool
+		want   bool
+	}{
+		{name: "Retimed", right: retimed},
+		{name: "Retimed Strict", right: retimed, strict: true, want: true},
+		{name: "Fewer Frames", right: shorter},
+		{name: "Fewer Frames Strict", right: shorter, strict: true, want: true},
+		{name: "Identical Strict", right: left, strict: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*strictTimingPtr = tt.strict
+			// The pixels are identical, so the largest threshold only fails
+			// timing differences with -strict-timing
+			threshold := imagediff.Threshold{Percent: 100, IsPercent: true}
+			o := compareFrames(pairOutcome{Name: "anim.gif"}, left, tt.right, filepath.Join(dir, tt.name+".png"), imagediff.Options{}, threshold, outputOptions{}, time.Now())
+			if o.Err != nil {
+				t.Fatalf("%s: compareFrames: %v", tt.name, o.Err)
+			}
+			if o.Exceeded != tt.want {
+				t.Errorf("%s: Exceeded got %v, want %v", tt.name, o.Exceeded, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/erdichen/imagediff"
+)
+
+// imageExtensions lists the file extensions compared in batch mode
+var imageExtensions = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".gif":  true,
+	".bmp":  true,
+	".tif":  true,
+	".tiff": true,
+	".webp": true,
+	".pbm":  true,
+	".pgm":  true,
+	".ppm":  true,
+	".pnm":  true,
+	".pam":  true,
+	".pfm":  true,
+	".hdr":  true,
+	".exr":  true,
+}
+
+// errMissing reports an image present in only one of the batch directories
+var errMissing = errors.New("missing")
+
+// pairOutcome is the outcome of comparing one pair of images
+type pairOutcome struct {
+	Name      string // Path relative to the batch directories, or the right image path
+	Left      inputInfo
+	Right     inputInfo
+	Output    string                     // Path of the written difference image
+	Result    *imagediff.Result          // Nil if Err is set; for animations, the frame with the most differing pixels
+	Animation *imagediff.AnimationResult // Frame-by-frame comparison, set if either input is animated
+	Exceeded  bool                       // Result, or for animations Animation, exceeds the threshold
+	Err       error
+	Timing    timing
+}
+
+// isDir reports whether path names a directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// listImages returns the image files below dir as slash-separated relative
+// paths
+func listImages(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !imageExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// batchPairs returns the sorted union of the image paths in both directories
+func batchPairs(leftDir, rightDir string) ([]string, error) {
+	leftFiles, err := listImages(leftDir)
+	if err != nil {
+		return nil, err
+	}
+	rightFiles, err := listImages(rightDir)
+	if err != nil {
+		return nil, err
+	}
+	names := append(leftFiles, rightFiles...)
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
+
+// decodeInput decodes all frames of an image file and describes it
+func decodeInput(path string) (*imagediff.Animation, inputInfo, error) {
+	info := inputInfo{Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, info, err
+	}
+	defer f.Close()
+	anim, format, err := imagediff.DecodeAnimation(f)
+	if err != nil {
+		return nil, info, err
+	}
+	b := anim.Frames[0].Bounds()
+	info.Format = format
+	info.Width, info.Height = b.Dx(), b.Dy()
+	info.Frames = len(anim.Frames)
+	return anim, info, nil
+}
+
+// comparePair compares two image files and writes the output image selected
+// by outOpts to output
+func comparePair(name, leftPath, rightPath, output string, opts imagediff.Options, threshold imagediff.Threshold, outOpts outputOptions) pairOutcome {
+	start := time.Now()
+	o := pairOutcome{Name: name, Left: inputInfo{Path: leftPath}, Right: inputInfo{Path: rightPath}}
+	anim1, left, err1 := decodeInput(leftPath)
+	anim2, right, err2 := decodeInput(rightPath)
+	o.Left, o.Right = left, right
+	if err := errors.Join(err1, err2); err != nil {
+		o.Err = err
+		return o
+	}
+	o.Timing.Decode = time.Since(start)
+	if opts.Verbose {
+		log.Printf("Decoded %s: left %s (%dx%d%s), right %s (%dx%d%s)", name,
+			left.Format, left.Width, left.Height, frameCount(anim1), right.Format, right.Width, right.Height, frameCount(anim2))
+	}
+	if isAnimated(anim1, anim2) {
+		return compareFrames(o, anim1, anim2, output, opts, threshold, outOpts, start)
+	}
+
+	compareStart := time.Now()
+	result, err := imagediff.Compare(anim1.Frames[0], anim2.Frames[0], opts)
+	if err != nil {
+		o.Err = err
+		return o
+	}
+	o.Timing.Compare = time.Since(compareStart)
+	o.Result = result
+	o.Exceeded = result.Exceeds(threshold)
+
+	writeStart := time.Now()
+	if err := writeOutput(output, result, outOpts); err != nil {
+		o.Err = err
+		return o
+	}
+	o.Output = output
+	o.Timing.Write = time.Since(writeStart)
+	o.Timing.Total = time.Since(start)
+	return o
+}
+
+// runBatch compares every image in leftDir with the image at the same
+// relative path in rightDir, writing the output images below outputDir.
+// Images present in only one directory are reported as errors.
+func runBatch(leftDir, rightDir, outputDir string, opts imagediff.Options, threshold imagediff.Threshold, outOpts outputOptions, out io.Writer) ([]pairOutcome, error) {
+	names, err := batchPairs(leftDir, rightDir)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Verbose {
+		log.Printf("Comparing %d images from %s and %s into %s", len(names), leftDir, rightDir, outputDir)
+	}
+
+	outcomes := make([]pairOutcome, 0, len(names))
+	for _, name := range names {
+		leftPath := filepath.Join(leftDir, filepath.FromSlash(name))
+		rightPath := filepath.Join(rightDir, filepath.FromSlash(name))
+		// Keep the input extension, so that x.png and x.jpg do not share x.png
+		output := filepath.Join(outputDir, filepath.FromSlash(name+outOpts.ext()))
+
+		var o pairOutcome
+		switch {
+		case !fileExists(leftPath):
+			o = pairOutcome{Name: name, Left: inputInfo{Path: leftPath}, Right: inputInfo{Path: rightPath}, Err: fmt.Errorf("left image %w", errMissing)}
+		case !fileExists(rightPath):
+			o = pairOutcome{Name: name, Left: inputInfo{Path: leftPath}, Right: inputInfo{Path: rightPath}, Err: fmt.Errorf("right image %w", errMissing)}
+		default:
+			o = comparePair(name, leftPath, rightPath, output, opts, threshold, outOpts)
+		}
+		outcomes = append(outcomes, o)
+
+		switch {
+		case o.Err != nil:
+			fmt.Fprintf(out, "ERROR %s: %v\n", name, o.Err)
+		case o.Exceeded:
+			fmt.Fprintf(out, "FAIL  %s (%s): %s\n", name, diffSummary(o), o.Output)
+		default:
+			fmt.Fprintf(out, "PASS  %s (%s)\n", name, diffSummary(o))
+		}
+	}
+	return outcomes, nil
+}
+
+// fileExists reports whether path names an existing file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// summarize counts the failed and errored outcomes
+func summarize(outcomes []pairOutcome) (failures, errs int) {
+	for _, o := range outcomes {
+		if o.Err != nil {
+			errs++
+		} else if o.Exceeded {
+			failures++
+		}
+	}
+	return failures, errs
+}
+
+// writePairReports writes the -junit, -sarif and -html reports, if requested
+func writePairReports(outcomes []pairOutcome, threshold imagediff.Threshold, start time.Time) error {
+	if *junitPtr != "" {
+		elapsed := time.Since(start)
+		if err := writeFile(*junitPtr, func(w io.Writer) error {
+			return writeJUnit(w, outcomes, threshold, start, elapsed)
+		}); err != nil {
+			return fmt.Errorf("writing JUnit report: %w", err)
+		}
+	}
+	if *sarifPtr != "" {
+		if err := writeFile(*sarifPtr, func(w io.Writer) error {
+			return writeSARIF(w, outcomes, threshold)
+		}); err != nil {
+			return fmt.Errorf("writing SARIF report: %w", err)
+		}
+	}
+	if *htmlPtr != "" {
+		if err := writeFile(*htmlPtr, func(w io.Writer) error {
+			return writeHTML(w, outcomes, threshold, *metricsPtr)
+		}); err != nil {
+			return fmt.Errorf("writing HTML report: %w", err)
+		}
+	}
+	return nil
+}
+
+// batchMain compares the directories given by -left and -right and returns
+// the exit status
+func batchMain(opts imagediff.Options, outOpts outputOptions, threshold imagediff.Threshold, report reportFormat, out io.Writer, start time.Time) int {
+	outputDir := *outputDirPtr
+	if outputDir == "" {
+		dir, err := os.MkdirTemp("", "imagediff-*")
+		if err != nil {
+			if *verbosePtr {
+				log.Printf("Error creating temporary directory: %v", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error creating temporary directory: %v\n", err)
+			}
+			return exitError
+		}
+		outputDir = dir
+	}
+
+	outcomes, err := runBatch(*leftPtr, *rightPtr, outputDir, opts, threshold, outOpts, out)
+	if err != nil {
+		if *verbosePtr {
+			log.Printf("Error listing images: %v", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error listing images: %v\n", err)
+		}
+		return exitError
+	}
+	failures, errs := summarize(outcomes)
+	fmt.Fprintf(out, "%d image pairs, %d differ beyond threshold %v, %d errors; difference images in %s\n",
+		len(outcomes), failures, threshold, errs, outputDir)
+
+	if err := writePairReports(outcomes, threshold, start); err != nil {
+		if *verbosePtr {
+			log.Printf("Error: %v", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return exitError
+	}
+	if report == reportJSON {
+		if err := writeReport(*reportFilePtr, newBatchJSONReport(outcomes, threshold, *metricsPtr)); err != nil {
+			if *verbosePtr {
+				log.Printf("Error writing report: %v", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			}
+			return exitError
+		}
+	}
+
+	switch {
+	case errs > 0:
+		return exitError
+	case failures > 0 && *failOnDiffPtr:
+		return exitDiff
+	}
+	return 0
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/erdichen/imagediff"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// writeTestPNG writes a solid w x h image to dir/name
+func writeTestPNG(t *testing.T, dir, name string, w, h int, c color.Color) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(path, func(f io.Writer) error { return png.Encode(f, solidImage(w, h, c)) }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeInput(t *testing.T) {
+	img := solidImage(3, 2, color.RGBA{100, 150, 200, 255})
+	// A 1x1 transparent lossless WebP; the standard library has no encoder
+	webpData, err := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// writeString returns an encoder writing data as it is
+	writeString := func(data string) func(w io.Writer) error {
+		return func(w io.Writer) error { _, err := io.WriteString(w, data); return err }
+	}
+
+	tests := []struct {
+		name   string
+		encode func(w io.Writer) error
+		format string
+		width  int
+	}{
+		{"image.png", func(w io.Writer) error { return png.Encode(w, img) }, "png", 3},
+		{"image.jpg", func(w io.Writer) error { return jpeg.Encode(w, img, nil) }, "jpeg", 3},
+		{"image.gif", func(w io.Writer) error { return gif.Encode(w, img, nil) }, "gif", 3},
+		{"image.bmp", func(w io.Writer) error { return bmp.Encode(w, img) }, "bmp", 3},
+		{"image.tiff", func(w io.Writer) error { return tiff.Encode(w, img, nil) }, "tiff", 3},
+		{"image.webp", func(w io.Writer) error { _, err := w.Write(webpData); return err }, "webp", 1},
+		{"image.pfm", writeString("Pf 2 1 -1\n\x00\x00\x80\x3f\x00\x00\x00\x40"), "pfm", 2},
+		{"image.hdr", writeString("#?RADIANCE\n\n-Y 1 +X 1\n\x80\x40\x00\x81"), "hdr", 1},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := writeFile(path, tt.encode); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !imageExtensions[filepath.Ext(tt.name)] {
+			t.Errorf("%s: extension not compared in batch mode", tt.name)
+		}
+		_, info, err := decodeInput(path)
+		if err != nil {
+			t.Errorf("%s: decodeInput: %v", tt.name, err)
+			continue
+		}
+		if info.Format != tt.format || info.Width != tt.width || info.Frames != 1 {
+			t.Errorf("%s: got format %q width %d, %d frames, want %q width %d, 1 frame", tt.name, info.Format, info.Width, info.Frames, tt.format, tt.width)
+		}
+	}
+
+	// All frames of animations are decoded
+	path := filepath.Join(dir, "animation.gif")
+	if err := writeFile(path, func(w io.Writer) error {
+		frame := image.NewPaletted(image.Rect(0, 0, 3, 2), color.Palette{color.Black, color.White})
+		return gif.EncodeAll(w, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if anim, info, err := decodeInput(path); err != nil || info.Frames != 2 || len(anim.Frames) != 2 {
+		t.Errorf("animation.gif: got %+v, %v, want 2 frames", info, err)
+	}
+
+	path = filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := decodeInput(path); !errors.Is(err, image.ErrFormat) {
+		t.Errorf("text file: got %v, want %v", err, image.ErrFormat)
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	red := color.RGBA{200, 100, 100, 255}
+	leftDir, rightDir, outputDir := t.TempDir(), t.TempDir(), t.TempDir()
+
+	writeTestPNG(t, leftDir, "same.png", 4, 4, gray)
+	writeTestPNG(t, rightDir, "same.png", 4, 4, gray)
+	writeTestPNG(t, leftDir, "same.jpg", 4, 4, gray) // PNG data, decoded by content
+	writeTestPNG(t, rightDir, "same.jpg", 4, 4, red)
+	writeTestPNG(t, leftDir, "sub/changed.png", 4, 4, gray)
+	writeTestPNG(t, rightDir, "sub/changed.png", 4, 4, red)
+	writeTestPNG(t, leftDir, "removed.png", 4, 4, gray)
+	writeTestPNG(t, rightDir, "added.png", 4, 4, gray)
+	writeTestPNG(t, leftDir, "size.png", 4, 4, gray)
+	writeTestPNG(t, rightDir, "size.png", 4, 6, gray)
+	if err := os.WriteFile(filepath.Join(rightDir, "notes.txt"), []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	outcomes, err := runBatch(leftDir, rightDir, outputDir, imagediff.Options{}, imagediff.Threshold{}, outputOptions{}, &out)
+	if err != nil {
+		t.Fatalf("runBatch: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		wantErr     error
+		wantErrText string
+		exceeded    bool
+	}{
+		{name: "added.png", wantErr: errMissing, wantErrText: "left image missing"},
+		{name: "removed.png", wantErr: errMissing, wantErrText: "right image missing"},
+		{name: "same.jpg", exceeded: true},
+		{name: "same.png"},
+		{name: "size.png", wantErr: imagediff.ErrSizeMismatch},
+		{name: "sub/changed.png", exceeded: true},
+	}
+	if len(outcomes) != len(tests) {
+		t.Fatalf("got %d outcomes, want %d: %v", len(outcomes), len(tests), outcomes)
+	}
+	for i, tt := range tests {
+		o := outcomes[i]
+		if o.Name != tt.name {
+			t.Errorf("outcome %d: got name %q, want %q", i, o.Name, tt.name)
+			continue
+		}
+		if !errors.Is(o.Err, tt.wantErr) || (tt.wantErr == nil) != (o.Err == nil) {
+			t.Errorf("%s: got error %v, want %v", tt.name, o.Err, tt.wantErr)
+		}
+		if tt.wantErrText != "" && (o.Err == nil || o.Err.Error() != tt.wantErrText) {
+			t.Errorf("%s: got error %v, want %q", tt.name, o.Err, tt.wantErrText)
+		}
+		if o.Exceeded != tt.exceeded {
+			t.Errorf("%s: Exceeded got %v, want %v", tt.name, o.Exceeded, tt.exceeded)
+		}
+		if o.Err == nil {
+			if _, err := os.Stat(o.Output); err != nil {
+				t.Errorf("%s: difference image not written: %v", tt.name, err)
+			}
+		}
+	}
+
+	if got, want := outcomes[2].Output, filepath.Join(outputDir, "same.jpg.png"); got != want {
+		t.Errorf("same.jpg: output got %s, want %s", got, want)
+	}
+	if got, want := outcomes[3].Output, filepath.Join(outputDir, "same.png.png"); got != want {
+		t.Errorf("same.png: output got %s, want %s", got, want)
+	}
+
+	if failures, errs := summarize(outcomes); failures != 2 || errs != 3 {
+		t.Errorf("summarize: got %d failures and %d errors, want 2 and 3", failures, errs)
+	}
+	if !strings.Contains(out.String(), "FAIL  sub/changed.png") || !strings.Contains(out.String(), "PASS  same.png") {
+		t.Errorf("unexpected batch output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/erdichen/imagediff"
+)
+
+// JUnit XML as understood by Jenkins, GitLab and most CI dashboards
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// absPath returns path made absolute where possible, so CI tools can resolve
+// attachments regardless of their working directory
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// diffSummary describes the difference in a compared pair
+func diffSummary(o pairOutcome) string {
+	a := o.Animation
+	if a == nil {
+		return fmt.Sprintf("%.2f%% %d differing pixels", o.Result.DiffPercent, o.Result.DiffCount)
+	}
+	s := fmt.Sprintf("%d of %d frames differ, %.2f%% %d differing pixels", a.DiffFrames, len(a.Frames), a.DiffPercent, a.DiffCount)
+	if a.FrameCountMismatch() {
+		s += fmt.Sprintf(", frame count %d vs %d", len(a.Left.Frames), len(a.Right.Frames))
+	}
+	if n := len(a.DelayMismatches); n > 0 {
+		s += fmt.Sprintf(", %d frame delays differ", n)
+	}
+	return s
+}
+
+// writeJUnit writes one test case per pair, failing those whose difference
+// exceeds threshold. The difference image is attached to each test case with
+// the [[ATTACHMENT|path]] convention.
+func writeJUnit(w io.Writer, outcomes []pairOutcome, threshold imagediff.Threshold, started time.Time, elapsed time.Duration) error {
+	failures, errs := summarize(outcomes)
+	suite := junitTestSuite{
+		Name:      "imagediff",
+		Tests:     len(outcomes),
+		Failures:  failures,
+		Errors:    errs,
+		Time:      seconds(elapsed),
+		Timestamp: started.UTC().Format("2006-01-02T15:04:05"),
+	}
+	for _, o := range outcomes {
+		tc := junitTestCase{Name: o.Name, ClassName: "imagediff", Time: seconds(o.Timing.Total)}
+		switch {
+		case o.Err != nil:
+			tc.Error = &junitMessage{Message: o.Err.Error(), Type: "ComparisonError", Text: o.Left.Path + "\n" + o.Right.Path}
+		case o.Exceeded:
+			tc.Failure = &junitMessage{
+				Message: fmt.Sprintf("%s, threshold %v", diffSummary(o), threshold),
+				Type:    "VisualDifference",
+				Text:    fmt.Sprintf("left: %s\nright: %s\ndiff: %s", o.Left.Path, o.Right.Path, o.Output),
+			}
+		}
+		if o.Output != "" {
+			tc.SystemOut = "[[ATTACHMENT|" + absPath(o.Output) + "]]"
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	doc := junitTestSuites{
+		Name:     "imagediff",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// SARIF 2.1.0, reduced to the properties used here
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string          `json:"ruleId"`
+	Level      string          `json:"level"`
+	Message    sarifMessage    `json:"message"`
+	Locations  []sarifLocation `json:"locations"`
+	Properties map[string]any  `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// SARIF rule identifiers
+const (
+	sarifRuleDiff  = "visual-difference"
+	sarifRuleError = "comparison-error"
+)
+
+// writeSARIF writes a SARIF log with one result per pair that exceeds
+// threshold or could not be compared, located at the right image.
+func writeSARIF(w io.Writer, outcomes []pairOutcome, threshold imagediff.Threshold) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "imagediff",
+			InformationURI: "https://github.com/erdichen/imagediff",
+			Rules: []sarifRule{
+				{ID: sarifRuleDiff, ShortDescription: sarifMessage{"Image differs beyond the threshold"}},
+				{ID: sarifRuleError, ShortDescription: sarifMessage{"Images could not be compared"}},
+			},
+		}},
+		Results: []sarifResult{}, // Encoded as [] rather than null when all pass
+	}
+	for _, o := range outcomes {
+		uri := o.Right.Path
+		if errors.Is(o.Err, errMissing) && !fileExists(uri) {
+			uri = o.Left.Path // Point at the image that exists
+		}
+		location := []sarifLocation{{sarifPhysicalLocation{sarifArtifactLocation{filepath.ToSlash(uri)}}}}
+		switch {
+		case o.Err != nil:
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    sarifRuleError,
+				Level:     "error",
+				Message:   sarifMessage{fmt.Sprintf("%s: %v", o.Name, o.Err)},
+				Locations: location,
+			})
+		case o.Exceeded:
+			props := map[string]any{
+				"left":        o.Left.Path,
+				"diffImage":   o.Output,
+				"diffCount":   o.Result.DiffCount,
+				"diffPercent": o.Result.DiffPercent,
+			}
+			if b := o.Result.DiffBounds; !b.Empty() {
+				props["diffBounds"] = rectJSON{X: b.Min.X, Y: b.Min.Y, Width: b.Dx(), Height: b.Dy()}
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:     sarifRuleDiff,
+				Level:      "error",
+				Message:    sarifMessage{fmt.Sprintf("%s differs from %s: %s, threshold %v", o.Name, o.Left.Path, diffSummary(o), threshold)},
+				Locations:  location,
+				Properties: props,
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+// writeFile creates filename and writes it with write
+func writeFile(filename string, write func(io.Writer) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erdichen/imagediff"
+)
+
+// testOutcomes returns a passing, a failing and an errored outcome
+func testOutcomes() []pairOutcome {
+	return []pairOutcome{
+		{
+			Name:   "same.png",
+			Left:   inputInfo{Path: "left/same.png"},
+			Right:  inputInfo{Path: "right/same.png"},
+			Output: "diff/same.png",
+			Result: &imagediff.Result{},
+		},
+		{
+			Name:     "changed.png",
+			Left:     inputInfo{Path: "left/changed.png"},
+			Right:    inputInfo{Path: "right/changed.png"},
+			Output:   "diff/changed.png",
+			Result:   &imagediff.Result{DiffCount: 12, DiffPercent: 0.5, DiffBounds: image.Rect(1, 2, 5, 8)},
+			Exceeded: true,
+		},
+		{
+			Name:  "broken.png",
+			Left:  inputInfo{Path: "left/broken.png"},
+			Right: inputInfo{Path: "right/broken.png"},
+			Err:   fmt.Errorf("right image %w", errMissing),
+		},
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJUnit(&buf, testOutcomes(), imagediff.Threshold{Count: 10}, time.Now(), time.Second); err != nil {
+		t.Fatalf("writeJUnit: %v", err)
+	}
+
+	var doc junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid XML %q: %v", buf.String(), err)
+	}
+	if doc.Tests != 3 || doc.Failures != 1 || doc.Errors != 1 {
+		t.Errorf("got tests %d failures %d errors %d, want 3, 1 and 1", doc.Tests, doc.Failures, doc.Errors)
+	}
+	if len(doc.Suites) != 1 || len(doc.Suites[0].Cases) != 3 {
+		t.Fatalf("got %v, want one suite with three test cases", doc.Suites)
+	}
+
+	cases := doc.Suites[0].Cases
+	if cases[0].Failure != nil || cases[0].Error != nil {
+		t.Errorf("%s: got failure %v error %v, want passing", cases[0].Name, cases[0].Failure, cases[0].Error)
+	}
+	if f := cases[1].Failure; f == nil || !strings.Contains(f.Message, "12 differing pixels") || !strings.Contains(f.Text, "diff/changed.png") {
+		t.Errorf("%s: got failure %+v, want the difference and the diff image path", cases[1].Name, f)
+	}
+	if !strings.HasPrefix(cases[1].SystemOut, "[[ATTACHMENT|") || !strings.HasSuffix(cases[1].SystemOut, "changed.png]]") {
+		t.Errorf("%s: got system-out %q, want an attachment", cases[1].Name, cases[1].SystemOut)
+	}
+	if e := cases[2].Error; e == nil || e.Message != "right image missing" {
+		t.Errorf("%s: got error %+v, want %q", cases[2].Name, e, "right image missing")
+	}
+	if cases[2].SystemOut != "" {
+		t.Errorf("%s: got system-out %q, want none without a diff image", cases[2].Name, cases[2].SystemOut)
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSARIF(&buf, testOutcomes(), imagediff.Threshold{Count: 10}); err != nil {
+		t.Fatalf("writeSARIF: %v", err)
+	}
+
+	var doc sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if doc.Version != "2.1.0" || len(doc.Runs) != 1 {
+		t.Fatalf("got version %q with %d runs, want 2.1.0 with one run", doc.Version, len(doc.Runs))
+	}
+
+	// Passing pairs produce no results
+	results := doc.Runs[0].Results
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if r := results[0]; r.RuleID != sarifRuleDiff || r.Locations[0].PhysicalLocation.ArtifactLocation.URI != "right/changed.png" {
+		t.Errorf("got result %+v, want %s at right/changed.png", r, sarifRuleDiff)
+	}
+	if got := results[0].Properties["diffImage"]; got != "diff/changed.png" {
+		t.Errorf("diffImage property got %v, want diff/changed.png", got)
+	}
+	if r := results[1]; r.RuleID != sarifRuleError || r.Level != "error" {
+		t.Errorf("got result %+v, want %s", r, sarifRuleError)
+	}
+
+	// All passing still encodes an empty results array
+	buf.Reset()
+	if err := writeSARIF(&buf, testOutcomes()[:1], imagediff.Threshold{}); err != nil {
+		t.Fatalf("writeSARIF: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"results": []`) {
+		t.Errorf("got %s, want an empty results array", buf.String())
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"html/template"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/erdichen/imagediff"
+)
+
+//go:embed report.html.tmpl
+var htmlTemplateText string
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"num":  formatNumber,
+	"rect": formatRect,
+}).Parse(htmlTemplateText))
+
+// htmlReport is the data of the -html report
+type htmlReport struct {
+	Title     string
+	Threshold string
+	Failures  int
+	Errors    int
+	Pairs     []htmlPair
+}
+
+// htmlPair describes one pair of images in the -html report
+type htmlPair struct {
+	Name         string
+	Status       string // "pass", "fail" or "error"
+	Error        string
+	Report       *jsonReport // Nil if Error is set
+	Left         htmlImage   // Left, Right and Diff are empty when not embedded
+	Right        htmlImage
+	Diff         htmlImage
+	Width        int // Size of the stacked images
+	Height       int
+	Channels     []htmlChannel
+	Overall      *errorMetricsJSON // Set with -metrics
+	Clusters     []clusterJSON     // Largest clusters, up to maxPrintedClusters
+	MoreClusters int               // Clusters not listed
+}
+
+// htmlImage is an image embedded in the -html report as a data URI
+type htmlImage struct {
+	Src    template.URL
+	Width  int
+	Height int
+}
+
+// htmlChannel is a row of the per-channel error table
+type htmlChannel struct {
+	Name    string
+	Max     number
+	Mean    number
+	Metrics *errorMetricsJSON // Set with -metrics
+}
+
+// formatNumber formats n with prec decimals, or as ∞ or n/a if not finite
+func formatNumber(prec int, n number) string {
+	f := float64(n)
+	switch {
+	case math.IsInf(f, 0):
+		return "∞"
+	case math.IsNaN(f):
+		return "n/a"
+	}
+	return strconv.FormatFloat(f, 'f', prec, 64)
+}
+
+// formatRect formats r as "x,y wxh", or "none" if nil
+func formatRect(r *rectJSON) string {
+	if r == nil {
+		return "none"
+	}
+	return strconv.Itoa(r.X) + "," + strconv.Itoa(r.Y) + " " + strconv.Itoa(r.Width) + "x" + strconv.Itoa(r.Height)
+}
+
+// embedImage encodes img as a PNG data URI
+func embedImage(img image.Image) (htmlImage, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return htmlImage{}, err
+	}
+	return htmlImage{
+		Src:    template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())),
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+	}, nil
+}
+
+// newHTMLPair describes o for the HTML report. The images are embedded if
+// embed is set.
+func newHTMLPair(o pairOutcome, threshold imagediff.Threshold, metrics, embed bool) (htmlPair, error) {
+	p := htmlPair{Name: o.Name, Status: "pass"}
+	switch {
+	case o.Err != nil:
+		p.Status, p.Error = "error", o.Err.Error()
+		return p, nil
+	case o.Exceeded:
+		p.Status = "fail"
+	}
+
+	r := newPairJSONReport(o, threshold, metrics)
+	p.Report = &r
+	p.Channels = []htmlChannel{
+		{"R", r.MaxError.R, r.MeanError.R, nil},
+		{"G", r.MaxError.G, r.MeanError.G, nil},
+		{"B", r.MaxError.B, r.MeanError.B, nil},
+		{"A", r.MaxError.A, r.MeanError.A, nil},
+	}
+	if m := r.Metrics; m != nil {
+		for i, cm := range []*errorMetricsJSON{&m.R, &m.G, &m.B, &m.A} {
+			p.Channels[i].Metrics = cm
+		}
+		p.Overall = &m.Overall
+	}
+	p.Clusters = r.Clusters[:min(len(r.Clusters), maxPrintedClusters)]
+	p.MoreClusters = len(r.Clusters) - len(p.Clusters)
+
+	if !embed {
+		return p, nil
+	}
+	var err error
+	if p.Left, err = embedImage(o.Result.ToneMapped(o.Result.Left)); err != nil {
+		return p, err
+	}
+	if p.Right, err = embedImage(o.Result.ToneMapped(o.Result.Right)); err != nil {
+		return p, err
+	}
+	if p.Diff, err = embedImage(o.Result.Image); err != nil {
+		return p, err
+	}
+	p.Width = max(p.Left.Width, p.Right.Width, p.Diff.Width)
+	p.Height = max(p.Left.Height, p.Right.Height, p.Diff.Height)
+	return p, nil
+}
+
+// writeHTML writes a self-contained HTML report of the compared pairs with
+// the images embedded, swipe, onion-skin, blink and side-by-side viewers with
+// zoom and pan, and the statistics of each pair. In a batch, images are only
+// embedded for pairs with differing pixels to keep the report small.
+func writeHTML(w io.Writer, outcomes []pairOutcome, threshold imagediff.Threshold, metrics bool) error {
+	failures, errs := summarize(outcomes)
+	report := htmlReport{
+		Title:     "imagediff report",
+		Threshold: threshold.String(),
+		Failures:  failures,
+		Errors:    errs,
+	}
+	if len(outcomes) == 1 {
+		report.Title = "imagediff: " + outcomes[0].Left.Path + " vs " + outcomes[0].Right.Path
+	}
+	for _, o := range outcomes {
+		embed := o.Result != nil && (len(outcomes) == 1 || o.Result.DiffCount > 0)
+		p, err := newHTMLPair(o, threshold, metrics, embed)
+		if err != nil {
+			return err
+		}
+		report.Pairs = append(report.Pairs, p)
+	}
+	return htmlTemplate.Execute(w, report)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/erdichen/imagediff"
+)
+
+// comparedOutcome compares two solid 4x4 images into a pairOutcome
+func comparedOutcome(t *testing.T, name string, left, right color.Color, opts imagediff.Options) pairOutcome {
+	t.Helper()
+	result, err := imagediff.Compare(solidImage(4, 4, left), solidImage(4, 4, right), opts)
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v", name, err)
+	}
+	return pairOutcome{
+		Name:     name,
+		Left:     inputInfo{Path: "left/" + name, Format: "png", Width: 4, Height: 4},
+		Right:    inputInfo{Path: "right/" + name, Format: "png", Width: 4, Height: 4},
+		Output:   "diff/" + name,
+		Result:   result,
+		Exceeded: result.Exceeds(imagediff.Threshold{}),
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	red := color.RGBA{200, 100, 100, 255}
+
+	tests := []struct {
+		name       string
+		outcomes   []pairOutcome
+		metrics    bool
+		wantImages int
+		want       []string
+		notWant    []string
+	}{
+		{
+			name:       "Single Identical Pair",
+			outcomes:   []pairOutcome{comparedOutcome(t, "same.png", gray, gray, imagediff.Options{})},
+			wantImages: 3,
+			want:       []string{"imagediff: left/same.png vs right/same.png", `class="status pass"`, "0 (0.00%)", `data-mode="swipe"`, `data-mode="onion"`, `data-mode="blink"`},
+			notWant:    []string{"image pairs", "<th>MSE</th>"},
+		},
+		{
+			name:       "Single Pair With Metrics And Clusters",
+			outcomes:   []pairOutcome{comparedOutcome(t, "changed.png", gray, red, imagediff.Options{Clusters: true, SSIM: true})},
+			metrics:    true,
+			wantImages: 3,
+			want:       []string{`class="status fail"`, "16 (100.00%), threshold 0, exceeded", "0,0 4x4", "<th>MSE</th>", "<td>100.00</td>", "MS-SSIM", "Cluster bounds"},
+		},
+		{
+			name: "Batch",
+			outcomes: []pairOutcome{
+				comparedOutcome(t, "changed.png", gray, red, imagediff.Options{}),
+				{Name: "broken.png", Err: errors.New("<script>alert(1)</script>")},
+				comparedOutcome(t, "same.png", gray, gray, imagediff.Options{}),
+			},
+			// Only the differing pair is embedded
+			wantImages: 3,
+			want:       []string{"imagediff report", "3 image pairs, 1 differ beyond threshold 0, 1 errors", `href="#pair-1"`, "&lt;script&gt;alert(1)&lt;/script&gt;"},
+			notWant:    []string{"<script>alert(1)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeHTML(&buf, tt.outcomes, imagediff.Threshold{}, tt.metrics); err != nil {
+				t.Fatalf("%s: writeHTML: %v", tt.name, err)
+			}
+			html := buf.String()
+			if got := strings.Count(html, `src="data:image/png;base64,`); got != tt.wantImages {
+				t.Errorf("%s: got %d embedded images, want %d", tt.name, got, tt.wantImages)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(html, s) {
+					t.Errorf("%s: missing %q", tt.name, s)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(html, s) {
+					t.Errorf("%s: unexpected %q", tt.name, s)
+				}
+			}
+		})
+	}
+}
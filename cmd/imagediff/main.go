@@ -0,0 +1,937 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erdichen/imagediff"
+
+	// Decoders of the supported input formats, registered with image.Decode
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// Global flag pointer variables
+var (
+	leftPtr            = flag.String("left", "", "Left input image file or directory (required)")
+	rightPtr           = flag.String("right", "", "Right input image file or directory (required)")
+	outputPtr          = flag.String("output", "", "Output image file (default: temporary file)")
+	outputFormatPtr    = flag.String("output-format", "png", "Output image format: 'png', or 'pam', 'ppm' or 'pgm' (Netpbm)")
+	outputDirPtr       = flag.String("output-dir", "", "Output directory for difference images when comparing directories (default: temporary directory)")
+	junitPtr           = flag.String("junit", "", "Write a JUnit XML report with one test case per image pair to this file")
+	htmlPtr            = flag.String("html", "", "Write a self-contained HTML report with swipe, onion-skin and blink viewers to this file")
+	sarifPtr           = flag.String("sarif", "", "Write a SARIF report of the image pairs that differ beyond -threshold to this file")
+	waitPtr            = flag.Bool("wait", false, "Wait for image viewer to close before exiting")
+	viewerPtr          = flag.String("viewer", "", "Custom image viewer command (overrides default)")
+	includeInputsPtr   = flag.Bool("include-inputs", false, "Include input images in output (left and right of diff)")
+	blinkPtr           = flag.String("blink", "", "Write an animation alternating left and right instead of the difference image: 'gif' or 'apng'")
+	blinkDiffPtr       = flag.Bool("blink-diff", false, "Add the difference image as a third -blink frame")
+	blinkDelayPtr      = flag.Duration("blink-delay", 500*time.Millisecond, "Time each -blink frame is shown")
+	normalizedPtr      = flag.Bool("normalized", false, "Use normalized difference (adjusts for brightness/contrast)")
+	scalePtr           = flag.Float64("scale", 2.0, "Scale factor for amplifying differences in non-normalized mode (default: 2.0)")
+	normalizedScalePtr = flag.Float64("normalized-scale", 50.0, "Scale factor for amplifying differences in normalized mode (default: 50.0)")
+	diffModePtr        = flag.String("diff-mode", "color", "Difference mode: 'bw' (black-and-white), 'gray' (grayscale), 'color' (default), 'ssim' (SSIM map), 'deltae' (CIEDE2000 heatmap), 'overlay' (differences highlighted on the left image), 'heatmap' (difference magnitude through -colormap)")
+	bitDepthPtr        = flag.Int("bit-depth", 8, "Bits per channel of the difference image: 8 or 16")
+	exposurePtr        = flag.Float64("exposure", 0, "Exposure in stops applied to float (PFM, HDR, EXR) inputs for display")
+	toneMapPtr         = flag.String("tonemap", "clamp", "Tone mapping of float inputs for display: 'clamp', 'reinhard' or 'aces'")
+	colormapPtr        = flag.String("colormap", "viridis", "Colormap of 'heatmap' mode: 'viridis', 'inferno', 'jet' or 'turbo'")
+	legendPtr          = flag.Bool("legend", false, "Add a legend bar with the value range below the output ('gray', 'heatmap', 'deltae' and 'ssim' modes)")
+	sizePolicyPtr      = flag.String("size-policy", "error", "Images of different dimensions: 'error', 'intersect' (overlap, rest counts as different), 'pad' (pad to larger size), 'scale' (rescale right to left)")
+	padColorPtr        = flag.String("pad-color", "#00000000", "Padding color for -size-policy pad, as #rrggbb or #rrggbbaa")
+	highlightColorPtr  = flag.String("highlight-color", "#ff0000", "Color of differing pixels in 'overlay' mode, as #rrggbb")
+	alignPtr           = flag.Bool("align", false, "Estimate the translation between the images and diff the aligned overlap")
+	maxShiftPtr        = flag.Int("max-shift", imagediff.DefaultMaxShift, "Largest shift in pixels searched by -align")
+	antiAliasingPtr    = flag.Bool("anti-aliasing", false, "Detect anti-aliased edge pixels, exclude them from the differing-pixel count and draw them in yellow")
+	deltaEThresholdPtr = flag.Float64("deltae-threshold", imagediff.DefaultDeltaEThreshold, "CIEDE2000 difference above which a pixel counts as differing in 'deltae' mode")
+	metricsPtr         = flag.Bool("metrics", false, "Report MSE, RMSE, PSNR and MAE per channel and relative errors")
+	ssimPtr            = flag.Bool("ssim", false, "Report SSIM and MS-SSIM structural similarity (implied by -diff-mode ssim)")
+	verbosePtr         = flag.Bool("verbose", false, "Enable verbose logging")
+	gitConfigPtr       = flag.String("git-config", "", "Configure imagediff as git difftool: 'enable' or 'disable'")
+	thresholdPtr       = flag.String("threshold", "0", "Differences tolerated by -fail-on-diff: pixel count (e.g. 100) or percentage (e.g. 0.5%)")
+	failOnDiffPtr      = flag.Bool("fail-on-diff", false, "Exit with status 1 if the images differ beyond -threshold")
+	strictTimingPtr    = flag.Bool("strict-timing", false, "Count animations whose frame counts or frame delays differ as differing beyond -threshold")
+	tolerancePtr       = flag.String("tolerance", "0", "Per-pixel tolerance: 8-bit units (e.g. 3 or 0.5; standard deviations with -normalized) or percentage of the full range (e.g. 1%)")
+	toleranceMetricPtr = flag.String("tolerance-metric", "channel", "Tolerance metric: 'channel' (largest channel difference) or 'euclidean' (RGBA distance)")
+	headlessPtr        = flag.Bool("headless", false, "Do not open the image viewer (for CI)")
+	reportPtr          = flag.String("report", "", "Write a machine-readable report: 'json'")
+	reportFilePtr      = flag.String("report-file", "", "Report file (default: stdout, replacing the human-readable output)")
+	maskPtr            = flag.String("mask", "", "Mask image whose white pixels are excluded from the comparison")
+	clustersPtr        = flag.Bool("clusters", false, "Group differing pixels into connected clusters and report the largest")
+	drawClustersPtr    = flag.Bool("draw-clusters", false, "Outline clusters of differing pixels on the output (implies -clusters)")
+	regionMaskPtr      = flag.String("region-mask", "", "Mask image whose white pixels are the only ones compared")
+	ignoreRects        rectList   // Set by the repeatable -ignore flag
+	regions            regionList // Set by the repeatable -region flag
+)
+
+// Exit codes
+const (
+	exitDiff  = 1 // Images differ beyond -threshold with -fail-on-diff
+	exitError = 2 // Invalid usage or runtime error
+)
+
+func openImage(filename, viewer string, wait, verbose bool) error {
+	var cmd *exec.Cmd
+
+	if viewer != "" {
+		if verbose {
+			log.Printf("Opening image with custom viewer: %s %s", viewer, filename)
+		}
+		// Use custom viewer
+		if wait {
+			cmd = exec.Command(viewer, filename)
+			return cmd.Run() // Run waits for completion
+		} else {
+			cmd = exec.Command(viewer, filename)
+			return cmd.Start() // Start doesn't wait
+		}
+	}
+
+	// Use default system viewer
+	if verbose {
+		log.Printf("Opening image with default system viewer: %s", filename)
+	}
+	switch runtime.GOOS {
+	case "darwin": // macOS
+		if wait {
+			cmd = exec.Command("open", "-W", filename)
+		} else {
+			cmd = exec.Command("open", filename)
+		}
+	case "linux": // Linux
+		if wait {
+			cmd = exec.Command("sh", "-c", fmt.Sprintf("xdg-open %q && wait", filename))
+		} else {
+			cmd = exec.Command("xdg-open", filename)
+		}
+	case "windows": // Windows
+		if wait {
+			cmd = exec.Command("cmd", "/c", "start", "/wait", filename)
+		} else {
+			cmd = exec.Command("cmd", "/c", "start", filename)
+		}
+	default:
+		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+
+	return cmd.Run()
+}
+
+// Helper function to get viewer name for output message
+func getViewerName(viewer string) string {
+	if viewer != "" {
+		return fmt.Sprintf("custom viewer (%s)", viewer)
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return "default macOS viewer"
+	case "linux":
+		return "default Linux viewer"
+	case "windows":
+		return "default Windows viewer"
+	default:
+		return "default viewer"
+	}
+}
+
+// viewOutput opens the output image in the viewer selected by -viewer
+func viewOutput(path string) error {
+	if err := openImage(path, *viewerPtr, *waitPtr, *verbosePtr); err != nil {
+		return err
+	}
+	if *verbosePtr {
+		if *waitPtr {
+			log.Printf("Image viewer closed")
+		} else {
+			log.Printf("Image opened in %s", getViewerName(*viewerPtr))
+		}
+	}
+	return nil
+}
+
+func configureGitDifftool(enable bool, verbose bool) {
+	toolName := "imagediff"
+	binaryPath, err := os.Executable()
+	if err != nil {
+		if verbose {
+			log.Printf("Error getting executable path: %v", err)
+		} else {
+			fmt.Printf("Error getting executable path: %v\n", err)
+		}
+		os.Exit(exitError)
+	}
+
+	if enable {
+		if verbose {
+			log.Printf("Enabling imagediff as git difftool with path: %s", binaryPath)
+		}
+		cmd := exec.Command("git", "config", "--global", "diff.tool", toolName)
+		if err := cmd.Run(); err != nil {
+			if verbose {
+				log.Printf("Error setting diff.tool: %v", err)
+			} else {
+				fmt.Printf("Error setting diff.tool: %v\n", err)
+			}
+			os.Exit(exitError)
+		}
+
+		cmdStr := fmt.Sprintf("%s -left \"$LOCAL\" -right \"$REMOTE\" -wait", binaryPath)
+		cmd = exec.Command("git", "config", "--global", fmt.Sprintf("difftool.%s.cmd", toolName), cmdStr)
+		if err := cmd.Run(); err != nil {
+			if verbose {
+				log.Printf("Error setting difftool.%s.cmd: %v", toolName, err)
+			} else {
+				fmt.Printf("Error setting difftool.%s.cmd: %v\n", toolName, err)
+			}
+			os.Exit(exitError)
+		}
+
+		fmt.Println("imagediff successfully enabled as git difftool")
+	} else {
+		if verbose {
+			log.Printf("Disabling imagediff as git difftool")
+		}
+		cmd := exec.Command("git", "config", "--global", "--unset", "diff.tool")
+		if err := cmd.Run(); err != nil && err.Error() != "exit status 5" { // 5 means key not found, which is fine
+			if verbose {
+				log.Printf("Error unsetting diff.tool: %v", err)
+			} else {
+				fmt.Printf("Error unsetting diff.tool: %v\n", err)
+			}
+			os.Exit(exitError)
+		}
+
+		cmd = exec.Command("git", "config", "--global", "--unset", fmt.Sprintf("difftool.%s.cmd", toolName))
+		if err := cmd.Run(); err != nil && err.Error() != "exit status 5" {
+			if verbose {
+				log.Printf("Error unsetting difftool.%s.cmd: %v", toolName, err)
+			} else {
+				fmt.Printf("Error unsetting difftool.%s.cmd: %v\n", toolName, err)
+			}
+			os.Exit(exitError)
+		}
+
+		fmt.Println("imagediff successfully disabled as git difftool")
+	}
+}
+
+// parseColor parses a #rrggbb or #rrggbbaa hex color
+func parseColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// parseTolerance parses a tolerance in 8-bit units ("3", "0.5") or a
+// percentage of the full 8-bit range ("1%"). Normalized tolerances are in
+// standard deviations, which have no full range, so percentages are rejected.
+func parseTolerance(s string, normalized bool) (float64, error) {
+	s = strings.TrimSpace(s)
+	p, isPercent := strings.CutSuffix(s, "%")
+	v, err := strconv.ParseFloat(p, 64)
+	if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, fmt.Errorf("invalid -tolerance %q: use a non-negative number of 8-bit units or a percentage such as 1%%", s)
+	}
+	if !isPercent {
+		return v, nil
+	}
+	if normalized {
+		return 0, fmt.Errorf("invalid -tolerance %q: percentages cannot be used with -normalized", s)
+	}
+	if v > 100 {
+		return 0, fmt.Errorf("invalid -tolerance %q: percentages cannot exceed 100%%", s)
+	}
+	return v / 100 * 255, nil
+}
+
+// parseRect parses an x,y,w,h rectangle
+func parseRect(s string) (image.Rectangle, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("invalid rectangle %q", s)
+	}
+	var v [4]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return image.Rectangle{}, fmt.Errorf("invalid rectangle %q", s)
+		}
+		v[i] = n
+	}
+	if v[2] <= 0 || v[3] <= 0 {
+		return image.Rectangle{}, fmt.Errorf("invalid rectangle %q: width and height must be positive", s)
+	}
+	return image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]), nil
+}
+
+// rectList is a flag.Value collecting repeated x,y,w,h rectangles
+type rectList []image.Rectangle
+
+func (l *rectList) String() string {
+	parts := make([]string, len(*l))
+	for i, r := range *l {
+		parts[i] = fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	}
+	return strings.Join(parts, " ")
+}
+
+func (l *rectList) Set(s string) error {
+	r, err := parseRect(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, r)
+	return nil
+}
+
+// parseRegion parses a name=x,y,w,h region; the name defaults to the rectangle
+func parseRegion(s string) (imagediff.Region, error) {
+	name, rect, found := strings.Cut(s, "=")
+	if !found {
+		name, rect = s, s
+	}
+	r, err := parseRect(rect)
+	if err != nil {
+		return imagediff.Region{}, err
+	}
+	if name == "" {
+		return imagediff.Region{}, fmt.Errorf("invalid region %q: empty name", s)
+	}
+	return imagediff.Region{Name: name, Rect: r}, nil
+}
+
+// regionList is a flag.Value collecting repeated name=x,y,w,h regions
+type regionList []imagediff.Region
+
+func (l *regionList) String() string {
+	parts := make([]string, len(*l))
+	for i, r := range *l {
+		parts[i] = fmt.Sprintf("%s=%d,%d,%d,%d", r.Name, r.Rect.Min.X, r.Rect.Min.Y, r.Rect.Dx(), r.Rect.Dy())
+	}
+	return strings.Join(parts, " ")
+}
+
+func (l *regionList) Set(s string) error {
+	r, err := parseRegion(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, r)
+	return nil
+}
+
+func init() {
+	flag.Var(&ignoreRects, "ignore", "Region x,y,w,h excluded from the comparison (repeatable)")
+	flag.Var(&regions, "region", "Named region name=x,y,w,h to compare with separate statistics (repeatable); only regions are compared")
+}
+
+// decodeImageFile opens and decodes an image file, keeping the first frame
+// of animations
+func decodeImageFile(filename string) (image.Image, error) {
+	anim, _, err := decodeInput(filename)
+	if err != nil {
+		return nil, err
+	}
+	return anim.Frames[0], nil
+}
+
+// printMetrics prints the error metrics as a table, one row per channel
+func printMetrics(w io.Writer, m imagediff.Metrics) {
+	fmt.Fprintf(w, "%-8s %12s %12s %10s %10s\n", "Channel", "MSE", "RMSE", "PSNR (dB)", "MAE")
+	for _, row := range []struct {
+		name string
+		em   imagediff.ErrorMetrics
+	}{
+		{"R", m.R}, {"G", m.G}, {"B", m.B}, {"A", m.A}, {"Overall", m.Overall},
+	} {
+		fmt.Fprintf(w, "%-8s %12.4f %12.4f %10.2f %10.4f\n", row.name, row.em.MSE, row.em.RMSE, row.em.PSNR, row.em.MAE)
+	}
+	rel := m.Relative
+	fmt.Fprintf(w, "Relative error: mean %.6f, max %.6f, relMSE %.6g\n", rel.MeanRelError, rel.MaxRelError, rel.RelMSE)
+}
+
+// printRegions prints the differing pixels of each region as a table
+func printRegions(w io.Writer, regions []imagediff.RegionResult) {
+	width := len("Region")
+	for _, r := range regions {
+		width = max(width, len(r.Name))
+	}
+	fmt.Fprintf(w, "%-*s %10s %10s %8s\n", width, "Region", "Pixels", "Differing", "Percent")
+	for _, r := range regions {
+		fmt.Fprintf(w, "%-*s %10d %10d %7.2f%%\n", width, r.Name, r.Pixels, r.DiffCount, r.DiffPercent)
+	}
+}
+
+// maxPrintedClusters limits the clusters listed by printClusters
+const maxPrintedClusters = 10
+
+// printClusters prints the largest clusters of differing pixels as a table
+func printClusters(w io.Writer, clusters []imagediff.Cluster) {
+	fmt.Fprintf(w, "%d clusters of differing pixels\n", len(clusters))
+	if len(clusters) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%-24s %8s %24s\n", "Bounds", "Area", "Max error (R,G,B,A)")
+	for _, c := range clusters[:min(len(clusters), maxPrintedClusters)] {
+		fmt.Fprintf(w, "%-24v %8d %24s\n", c.Bounds, c.Area,
+			fmt.Sprintf("%.0f,%.0f,%.0f,%.0f", c.MaxError.R, c.MaxError.G, c.MaxError.B, c.MaxError.A))
+	}
+	if len(clusters) > maxPrintedClusters {
+		fmt.Fprintf(w, "... and %d more\n", len(clusters)-maxPrintedClusters)
+	}
+}
+
+// printUsageWithExamples prints the standard flag usage followed by example runs
+func printUsageWithExamples() {
+	flag.CommandLine.SetOutput(os.Stderr) // Ensure usage goes to stderr
+	flag.Usage()
+	exe := os.Args[0]
+	fmt.Fprintf(os.Stderr, "\nExamples:\n")
+	fmt.Fprintf(os.Stderr, "  Basic non-normalized difference:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left image1.png -right image2.png\n", exe)
+	fmt.Fprintf(os.Stderr, "  Normalized grayscale difference with custom scale:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left image1.png -right image2.png -normalized -diff-mode gray -normalized-scale 25.0\n", exe)
+	fmt.Fprintf(os.Stderr, "  Composite output with verbose logging:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left image1.png -right image2.png -include-inputs -verbose\n", exe)
+	fmt.Fprintf(os.Stderr, "  CI gate failing when more than 0.1%% of pixels differ:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left image1.png -right image2.png -headless -fail-on-diff -threshold 0.1%%\n", exe)
+	fmt.Fprintf(os.Stderr, "  Ignoring a timestamp region and the areas masked in mask.png:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left image1.png -right image2.png -ignore 0,0,200,20 -mask mask.png\n", exe)
+	fmt.Fprintf(os.Stderr, "  Comparing only two named widgets, with separate counts:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left image1.png -right image2.png -region header=0,0,800,60 -region button=600,500,120,40\n", exe)
+	fmt.Fprintf(os.Stderr, "  Outlining clusters of changed pixels on a composite:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left image1.png -right image2.png -include-inputs -draw-clusters\n", exe)
+	fmt.Fprintf(os.Stderr, "  Comparing two directories with JUnit and SARIF reports for CI:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left baseline/ -right actual/ -output-dir diffs/ -junit imagediff.xml -sarif imagediff.sarif\n", exe)
+	fmt.Fprintf(os.Stderr, "  Differences highlighted in magenta on the left image:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left image1.png -right image2.png -diff-mode overlay -highlight-color #ff00ff\n", exe)
+	fmt.Fprintf(os.Stderr, "  Heatmap of the difference magnitude with a legend bar:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left image1.png -right image2.png -diff-mode heatmap -colormap inferno -legend\n", exe)
+	fmt.Fprintf(os.Stderr, "  Animated GIF blinking between left, right and the difference:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left image1.png -right image2.png -blink gif -blink-diff -blink-delay 700ms\n", exe)
+	fmt.Fprintf(os.Stderr, "  16-bit difference image of 16-bit PNGs, keeping sub-8-bit differences:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left scan1.png -right scan2.png -bit-depth 16 -diff-mode gray -scale 100\n", exe)
+	fmt.Fprintf(os.Stderr, "  Float renders compared in linear light, shown two stops darker with filmic tone mapping:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left reference.exr -right render.exr -metrics -exposure -2 -tonemap aces -include-inputs\n", exe)
+	fmt.Fprintf(os.Stderr, "  Animated GIFs compared frame by frame, writing an animated difference:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left spinner1.gif -right spinner2.gif -include-inputs -output spinner-diff.png\n", exe)
+	fmt.Fprintf(os.Stderr, "  Comparing framebuffer dumps and writing the difference as PAM:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left expected.ppm -right actual.pam -headless -output-format pam -output diff.pam\n", exe)
+	fmt.Fprintf(os.Stderr, "  HTML report with interactive viewers for code review:\n")
+	fmt.Fprintf(os.Stderr, "    %s -left image1.png -right image2.png -headless -html report.html\n", exe)
+	fmt.Fprintf(os.Stderr, "  Configure as git difftool:\n")
+	fmt.Fprintf(os.Stderr, "    %s -git-config enable\n", exe)
+	fmt.Fprintf(os.Stderr, "\n")
+}
+
+func main() {
+	flag.CommandLine.Usage = printUsageWithExamples
+	flag.Parse()
+	start := time.Now()
+
+	if *verbosePtr {
+		log.SetFlags(log.LstdFlags | log.Lshortfile) // Include timestamp and file:line
+	}
+
+	// Handle git-config flag
+	if *gitConfigPtr != "" {
+		if *gitConfigPtr == "enable" {
+			configureGitDifftool(true, *verbosePtr)
+			os.Exit(0)
+		} else if *gitConfigPtr == "disable" {
+			configureGitDifftool(false, *verbosePtr)
+			os.Exit(0)
+		} else {
+			log.Printf("Error: Invalid -git-config value '%s'. Use 'enable' or 'disable'.", *gitConfigPtr)
+			printUsageWithExamples()
+			os.Exit(exitError)
+		}
+	}
+
+	if *leftPtr == "" || *rightPtr == "" {
+		log.Println("Error: Both left and right input files are required")
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+
+	if *verbosePtr {
+		log.Printf("Starting imagediff with left=%s, right=%s", *leftPtr, *rightPtr)
+	}
+
+	// Validate diffMode
+	diffMode, err := imagediff.ParseDiffMode(*diffModePtr)
+	if err != nil {
+		log.Printf("Error: Invalid -diff-mode value '%s'. Use 'bw', 'gray', 'color', 'ssim', 'deltae', 'overlay', or 'heatmap'.", *diffModePtr)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+
+	toleranceMetric, err := imagediff.ParseToleranceMetric(*toleranceMetricPtr)
+	if err != nil {
+		log.Printf("Error: Invalid -tolerance-metric value '%s'. Use 'channel' or 'euclidean'.", *toleranceMetricPtr)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+	tolerance, err := parseTolerance(*tolerancePtr, *normalizedPtr)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+
+	sizePolicy, err := imagediff.ParseSizePolicy(*sizePolicyPtr)
+	if err != nil {
+		log.Printf("Error: Invalid -size-policy value '%s'. Use 'error', 'intersect', 'pad', or 'scale'.", *sizePolicyPtr)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+	padColor, err := parseColor(*padColorPtr)
+	if err != nil {
+		log.Printf("Error: Invalid -pad-color value '%s'. Use #rrggbb or #rrggbbaa.", *padColorPtr)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+
+	if *bitDepthPtr != 8 && *bitDepthPtr != 16 {
+		log.Printf("Error: Invalid -bit-depth value %d. Use 8 or 16.", *bitDepthPtr)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+
+	toneMap, err := imagediff.ParseToneMap(*toneMapPtr)
+	if err != nil {
+		log.Printf("Error: Invalid -tonemap value '%s'. Use 'clamp', 'reinhard', or 'aces'.", *toneMapPtr)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+
+	colormap, err := imagediff.ParseColormap(*colormapPtr)
+	if err != nil {
+		log.Printf("Error: Invalid -colormap value '%s'. Use 'viridis', 'inferno', 'jet', or 'turbo'.", *colormapPtr)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+	if *legendPtr && !diffMode.HasLegend() {
+		log.Printf("Error: -legend is not supported with -diff-mode %s. Use 'gray', 'heatmap', 'deltae', or 'ssim'.", diffMode)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+
+	highlightColor, err := parseColor(*highlightColorPtr)
+	if err != nil {
+		log.Printf("Error: Invalid -highlight-color value '%s'. Use #rrggbb.", *highlightColorPtr)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+
+	if *maxShiftPtr < 0 {
+		log.Printf("Error: Invalid -max-shift value %d. Must not be negative.", *maxShiftPtr)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+
+	threshold, err := imagediff.ParseThreshold(*thresholdPtr)
+	if err != nil {
+		log.Printf("Error: Invalid -threshold value '%s'. Use a pixel count or a percentage.", *thresholdPtr)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+
+	report, err := parseReportFormat(*reportPtr)
+	if err != nil {
+		log.Printf("Error: Invalid -report value '%s'. Use 'json'.", *reportPtr)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+
+	blink, err := parseBlinkFormat(*blinkPtr)
+	if err != nil {
+		log.Printf("Error: Invalid -blink value '%s'. Use 'gif' or 'apng'.", *blinkPtr)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+	if blink != blinkNone && *includeInputsPtr {
+		log.Println("Error: -blink and -include-inputs cannot be used together")
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+	if blink != blinkNone && *legendPtr {
+		log.Println("Error: -blink and -legend cannot be used together")
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+	var netpbm imagediff.NetpbmFormat
+	if *outputFormatPtr != "png" {
+		netpbm, err = imagediff.ParseNetpbmFormat(*outputFormatPtr)
+		if err != nil {
+			log.Printf("Error: Invalid -output-format value '%s'. Use 'png', 'pam', 'ppm', or 'pgm'.", *outputFormatPtr)
+			printUsageWithExamples()
+			os.Exit(exitError)
+		}
+		if blink != blinkNone {
+			log.Println("Error: -blink and -output-format cannot be used together")
+			printUsageWithExamples()
+			os.Exit(exitError)
+		}
+	}
+	if *blinkDelayPtr <= 0 {
+		log.Printf("Error: Invalid -blink-delay value %v. Must be positive.", *blinkDelayPtr)
+		printUsageWithExamples()
+		os.Exit(exitError)
+	}
+	outOpts := outputOptions{
+		Composite:  *includeInputsPtr,
+		Blink:      blink,
+		BlinkDiff:  *blinkDiffPtr,
+		BlinkDelay: *blinkDelayPtr,
+		Legend:     *legendPtr,
+		Netpbm:     netpbm,
+	}
+
+	// A report on stdout replaces the human-readable output
+	var out io.Writer = os.Stdout
+	if report != reportNone && *reportFilePtr == "" {
+		out = io.Discard
+	}
+
+	var mask image.Image
+	if *maskPtr != "" {
+		if *verbosePtr {
+			log.Printf("Decoding mask image %s", *maskPtr)
+		}
+		mask, err = decodeImageFile(*maskPtr)
+		if err != nil {
+			if *verbosePtr {
+				log.Printf("Error reading mask image %s: %v", *maskPtr, err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error reading mask image: %v\n", err)
+			}
+			os.Exit(exitError)
+		}
+	}
+
+	var regionMask image.Image
+	if *regionMaskPtr != "" {
+		if *verbosePtr {
+			log.Printf("Decoding region mask image %s", *regionMaskPtr)
+		}
+		regionMask, err = decodeImageFile(*regionMaskPtr)
+		if err != nil {
+			if *verbosePtr {
+				log.Printf("Error reading region mask image %s: %v", *regionMaskPtr, err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error reading region mask image: %v\n", err)
+			}
+			os.Exit(exitError)
+		}
+	}
+
+	scaleFactor := *scalePtr
+	if *normalizedPtr {
+		scaleFactor = *normalizedScalePtr
+	}
+
+	opts := imagediff.Options{
+		Normalized:         *normalizedPtr,
+		Scale:              scaleFactor,
+		DiffMode:           diffMode,
+		Tolerance:          tolerance,
+		ToleranceMetric:    toleranceMetric,
+		SizePolicy:         sizePolicy,
+		PadColor:           padColor,
+		HighlightColor:     highlightColor,
+		Colormap:           colormap,
+		Deep:               *bitDepthPtr == 16,
+		Exposure:           *exposurePtr,
+		ToneMap:            toneMap,
+		Align:              *alignPtr,
+		MaxShift:           *maxShiftPtr,
+		DeltaEThreshold:    *deltaEThresholdPtr,
+		DetectAntiAliasing: *antiAliasingPtr,
+		Ignore:             ignoreRects,
+		Mask:               mask,
+		Regions:            regions,
+		Clusters:           *clustersPtr,
+		DrawClusters:       *drawClustersPtr,
+		RegionMask:         regionMask,
+		SSIM:               *ssimPtr,
+		Verbose:            *verbosePtr,
+	}
+
+	if isDir(*leftPtr) || isDir(*rightPtr) {
+		if !isDir(*leftPtr) || !isDir(*rightPtr) {
+			log.Println("Error: -left and -right must both be files or both be directories")
+			printUsageWithExamples()
+			os.Exit(exitError)
+		}
+		os.Exit(batchMain(opts, outOpts, threshold, report, out, start))
+	}
+
+	// Open the left image
+	img1File, err := os.Open(*leftPtr)
+	if err != nil {
+		if *verbosePtr {
+			log.Printf("Error opening left image file %s: %v", *leftPtr, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error opening left image: %v\n", err)
+		}
+		os.Exit(exitError)
+	}
+	defer img1File.Close()
+
+	// Open the right image
+	img2File, err := os.Open(*rightPtr)
+	if err != nil {
+		if *verbosePtr {
+			log.Printf("Error opening right image file %s: %v", *rightPtr, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error opening right image: %v\n", err)
+		}
+		os.Exit(exitError)
+	}
+	defer img2File.Close()
+
+	if *verbosePtr {
+		log.Println("Decoding left image")
+	}
+	anim1, format1, err := imagediff.DecodeAnimation(img1File)
+	if err != nil {
+		if *verbosePtr {
+			log.Printf("Error decoding left image: %v", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error decoding left image: %v\n", err)
+		}
+		os.Exit(exitError)
+	}
+	img1 := anim1.Frames[0]
+	if *verbosePtr {
+		log.Printf("Decoded left image as %s (%dx%d%s)", format1, img1.Bounds().Dx(), img1.Bounds().Dy(), frameCount(anim1))
+	}
+
+	if *verbosePtr {
+		log.Println("Decoding right image")
+	}
+	anim2, format2, err := imagediff.DecodeAnimation(img2File)
+	if err != nil {
+		if *verbosePtr {
+			log.Printf("Error decoding right image: %v", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error decoding right image: %v\n", err)
+		}
+		os.Exit(exitError)
+	}
+	img2 := anim2.Frames[0]
+	if *verbosePtr {
+		log.Printf("Decoded right image as %s (%dx%d%s)", format2, img2.Bounds().Dx(), img2.Bounds().Dy(), frameCount(anim2))
+	}
+
+	left := inputInfo{Path: *leftPtr, Format: format1, Width: img1.Bounds().Dx(), Height: img1.Bounds().Dy(), Frames: len(anim1.Frames)}
+	right := inputInfo{Path: *rightPtr, Format: format2, Width: img2.Bounds().Dx(), Height: img2.Bounds().Dy(), Frames: len(anim2.Frames)}
+	if isAnimated(anim1, anim2) {
+		os.Exit(animationMain(anim1, anim2, left, right, opts, outOpts, threshold, report, out, start))
+	}
+
+	decodeTime := time.Since(start)
+
+	compareStart := time.Now()
+	result, err := imagediff.Compare(img1, img2, opts)
+	if errors.Is(err, imagediff.ErrSizeMismatch) {
+		log.Printf("Error: %v (use -size-policy to compare anyway)", err)
+		os.Exit(exitError)
+	} else if err != nil {
+		log.Printf("Error: %v", err)
+		os.Exit(exitError)
+	}
+	compareTime := time.Since(compareStart)
+	diffImg := result.Image
+	if *verbosePtr {
+		log.Printf("Max error R=%.2f G=%.2f B=%.2f A=%.2f, mean error R=%.4f G=%.4f B=%.4f A=%.4f",
+			result.MaxError.R, result.MaxError.G, result.MaxError.B, result.MaxError.A,
+			result.MeanError.R, result.MeanError.G, result.MeanError.B, result.MeanError.A)
+		if result.DiffCount > 0 {
+			log.Printf("Differences bounded by %v", result.DiffBounds)
+		}
+	}
+
+	// Handle output file
+	writeStart := time.Now()
+	outputFile := *outputPtr
+	if outputFile == "" {
+		// Create a temporary file
+		tmpFile, err := os.CreateTemp("", "imagediff-*"+outOpts.ext())
+		if err != nil {
+			if *verbosePtr {
+				log.Printf("Error creating temporary file: %v", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error creating temporary file: %v\n", err)
+			}
+			os.Exit(exitError)
+		}
+		outputFile = tmpFile.Name()
+		defer tmpFile.Close()
+		if *verbosePtr {
+			log.Printf("Created temporary output file: %s", outputFile)
+		}
+	}
+
+	// Create output file
+	outFile, err := os.Create(outputFile)
+	if err != nil {
+		if *verbosePtr {
+			log.Printf("Error creating output file %s: %v", outputFile, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+		}
+		os.Exit(exitError)
+	}
+	defer outFile.Close()
+
+	// Encode and save the difference image, composite or animation
+	if *verbosePtr {
+		log.Printf("Encoding image to %s", outputFile)
+	}
+	err = encodeOutput(outFile, result, outOpts)
+	if err != nil {
+		if *verbosePtr {
+			log.Printf("Error encoding output image: %v", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error encoding output image: %v\n", err)
+		}
+		os.Exit(exitError)
+	}
+	writeTime := time.Since(writeStart)
+
+	diffType := ""
+	diffMsg := ""
+	if *normalizedPtr {
+		diffType = "Normalized "
+	}
+	if result.Options.Deep {
+		diffType += "16-bit "
+	}
+	if !*normalizedPtr {
+		diffMsg = fmt.Sprintf(" (%.2f%% %d differing pixels)", result.DiffPercent, result.DiffCount)
+		if result.Options.DetectAntiAliasing {
+			diffMsg = fmt.Sprintf(" (%.2f%% %d differing pixels, %d anti-aliased)", result.DiffPercent, result.DiffCount, result.AntiAliased)
+		}
+	}
+	outputMode := "Color"
+	if diffMode == imagediff.DiffModeBW {
+		outputMode = "Black-and-White"
+	} else if diffMode == imagediff.DiffModeGray {
+		outputMode = "Grayscale"
+	} else if diffMode == imagediff.DiffModeSSIM {
+		outputMode = "SSIM Map"
+	} else if diffMode == imagediff.DiffModeDeltaE {
+		outputMode = "CIEDE2000 Heatmap"
+	} else if diffMode == imagediff.DiffModeOverlay {
+		outputMode = "Overlay"
+	} else if diffMode == imagediff.DiffModeHeatmap {
+		outputMode = "Heatmap"
+	}
+	if blink != blinkNone {
+		fmt.Fprintf(out, "Blink animation (%s) of left and right successfully created: %s%s\n", blink, outputFile, diffMsg)
+	} else {
+		fmt.Fprintf(out, "%s%s difference image successfully created with scale factor %.1f: %s%s\n", diffType, outputMode, result.Options.Scale, outputFile, diffMsg)
+	}
+
+	if *alignPtr {
+		fmt.Fprintf(out, "Aligned with offset (%d, %d), compared %dx%d overlap\n",
+			result.Offset.X, result.Offset.Y, diffImg.Bounds().Dx(), diffImg.Bounds().Dy())
+	}
+	if result.IgnoreMask != nil {
+		fmt.Fprintf(out, "Ignored %d pixels\n", result.Ignored)
+	}
+	if result.SubStepCount > 0 {
+		fmt.Fprintf(out, "%d differing pixels differ by less than one 8-bit step\n", result.SubStepCount)
+	}
+	if len(result.Regions) > 0 {
+		printRegions(out, result.Regions)
+	}
+	if result.Options.Clusters {
+		printClusters(out, result.Clusters)
+	}
+	if *metricsPtr {
+		printMetrics(out, result.Metrics)
+	}
+	if diffMode == imagediff.DiffModeDeltaE {
+		fmt.Fprintf(out, "ΔE2000: max %.2f, mean %.4f (threshold %.2f)\n", result.MaxDeltaE, result.MeanDeltaE, result.Options.DeltaEThreshold)
+	}
+	if result.Options.SSIM {
+		fmt.Fprintf(out, "SSIM: %.4f, MS-SSIM: %.4f\n", result.SSIM, result.MSSSIM)
+	}
+
+	exceeded := result.Exceeds(threshold)
+	if exceeded && *failOnDiffPtr {
+		fmt.Fprintf(out, "Images differ beyond threshold %v\n", threshold)
+	}
+
+	outcome := pairOutcome{
+		Name:     *rightPtr,
+		Left:     left,
+		Right:    right,
+		Output:   outputFile,
+		Result:   result,
+		Exceeded: exceeded,
+		Timing:   timing{Decode: decodeTime, Compare: compareTime, Write: writeTime, Total: time.Since(start)},
+	}
+	if err := writePairReports([]pairOutcome{outcome}, threshold, start); err != nil {
+		if *verbosePtr {
+			log.Printf("Error: %v", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(exitError)
+	}
+
+	if report == reportJSON {
+		if err := writeReport(*reportFilePtr, newPairJSONReport(outcome, threshold, *metricsPtr)); err != nil {
+			if *verbosePtr {
+				log.Printf("Error writing report: %v", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			}
+			os.Exit(exitError)
+		}
+	}
+
+	if !*headlessPtr {
+		if err := viewOutput(outputFile); err != nil {
+			if *verbosePtr {
+				log.Printf("Error opening image: %v", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error opening image: %v\n", err)
+			}
+			os.Exit(exitError)
+		}
+	}
+
+	if exceeded && *failOnDiffPtr {
+		os.Exit(exitDiff)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/erdichen/imagediff"
+)
+
+func TestPrintUsageWithExamples(t *testing.T) {
+	// Capture stdout
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+
+	printUsageWithExamples()
+	w.Close()
+	os.Stderr = oldStderr
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	output := buf.String()
+
+	if !strings.Contains(output, "Examples:") || !strings.Contains(output, "imagediff") {
+		t.Errorf("printUsageWithExamples() output missing expected content: %s", output)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    color.NRGBA
+		wantErr bool
+	}{
+		{input: "#ff8000", want: color.NRGBA{255, 128, 0, 255}},
+		{input: "00ff0080", want: color.NRGBA{0, 255, 0, 128}},
+		{input: "#00000000", want: color.NRGBA{0, 0, 0, 0}},
+		{input: "#fff", wantErr: true},
+		{input: "#gg0000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseColor(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseColor(%q): got error %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("parseColor(%q): got %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTolerance(t *testing.T) {
+	tests := []struct {
+		input      string
+		normalized bool
+		want       float64
+		wantErr    bool
+	}{
+		{input: "0.5", want: 0.5},
+		{input: "0.99", want: 0.99},
+		{input: "1", want: 1},
+		{input: "3", want: 3},
+		{input: "1%", want: 2.55},
+		{input: "100%", want: 255},
+		{input: "0.5", normalized: true, want: 0.5},
+		{input: "2", normalized: true, want: 2},
+		{input: "1%", normalized: true, wantErr: true},
+		{input: "101%", wantErr: true},
+		{input: "-1", wantErr: true},
+		{input: "NaN", wantErr: true},
+		{input: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		name := tt.input
+		if tt.normalized {
+			name += " normalized"
+		}
+		t.Run(name, func(t *testing.T) {
+			got, err := parseTolerance(tt.input, tt.normalized)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTolerance(%q, %v): got error %v, wantErr %v", tt.input, tt.normalized, err, tt.wantErr)
+			}
+			if err == nil && math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("parseTolerance(%q, %v): got %v, want %v", tt.input, tt.normalized, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRect(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    image.Rectangle
+		wantErr bool
+	}{
+		{input: "10,20,30,40", want: image.Rect(10, 20, 40, 60)},
+		{input: " 0, 0, 1, 1", want: image.Rect(0, 0, 1, 1)},
+		{input: "10,20,30", wantErr: true},
+		{input: "10,20,0,40", wantErr: true},
+		{input: "a,b,c,d", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseRect(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRect(%q): got error %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("parseRect(%q): got %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRegion(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    imagediff.Region
+		wantErr bool
+	}{
+		{input: "header=0,0,800,60", want: imagediff.Region{Name: "header", Rect: image.Rect(0, 0, 800, 60)}},
+		{input: "1,2,3,4", want: imagediff.Region{Name: "1,2,3,4", Rect: image.Rect(1, 2, 4, 6)}},
+		{input: "=1,2,3,4", wantErr: true},
+		{input: "button=1,2,3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseRegion(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRegion(%q): got error %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("parseRegion(%q): got %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
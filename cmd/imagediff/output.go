@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/erdichen/imagediff"
+)
+
+// blinkFormat selects the animation written by -blink
+type blinkFormat string
+
+const (
+	blinkNone blinkFormat = ""
+	blinkGIF  blinkFormat = "gif"
+	blinkAPNG blinkFormat = "apng"
+)
+
+// parseBlinkFormat converts a -blink flag value to a blinkFormat
+func parseBlinkFormat(s string) (blinkFormat, error) {
+	switch format := blinkFormat(s); format {
+	case blinkNone, blinkGIF, blinkAPNG:
+		return format, nil
+	}
+	return "", fmt.Errorf("invalid blink format %q", s)
+}
+
+// outputOptions selects the image written for each comparison
+type outputOptions struct {
+	Composite  bool                   // Left, difference and right side by side
+	Blink      blinkFormat            // Animation alternating left and right, if set
+	BlinkDiff  bool                   // Add the difference image as a third frame
+	BlinkDelay time.Duration          // Time each frame is shown
+	Legend     bool                   // Value range bar below the difference image
+	Netpbm     imagediff.NetpbmFormat // Netpbm format instead of PNG, if set
+}
+
+// ext returns the file extension of the output image
+func (o outputOptions) ext() string {
+	if o.Blink == blinkGIF {
+		return ".gif"
+	}
+	if o.Netpbm != "" {
+		return "." + string(o.Netpbm)
+	}
+	return ".png" // Also for APNG, which PNG viewers show as its first frame
+}
+
+// encodeOutput encodes the output image of result selected by o
+func encodeOutput(w io.Writer, result *imagediff.Result, o outputOptions) error {
+	verbose := result.Options.Verbose
+	switch o.Blink {
+	case blinkGIF:
+		if verbose {
+			log.Println("Creating blink animation as GIF")
+		}
+		return imagediff.EncodeGIF(w, result.BlinkFrames(o.BlinkDiff), o.BlinkDelay)
+	case blinkAPNG:
+		if verbose {
+			log.Println("Creating blink animation as APNG")
+		}
+		return imagediff.EncodeAPNG(w, result.BlinkFrames(o.BlinkDiff), o.BlinkDelay)
+	}
+	var img image.Image = result.Image
+	if o.Composite {
+		if verbose {
+			log.Println("Creating composite image with inputs")
+		}
+		img = result.Composite()
+	}
+	img = o.withLegend(result, img)
+	if o.Netpbm != "" {
+		return imagediff.EncodeNetpbm(w, img, imagediff.NetpbmOptions{Format: o.Netpbm})
+	}
+	return png.Encode(w, img)
+}
+
+// withLegend adds the legend bar of result below img if requested
+func (o outputOptions) withLegend(result *imagediff.Result, img image.Image) image.Image {
+	if !o.Legend {
+		return img
+	}
+	return result.WithLegend(img)
+}
+
+// writeOutput writes the output image of result to path, creating parent
+// directories
+func writeOutput(path string, result *imagediff.Result, o outputOptions) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return writeFile(path, func(w io.Writer) error {
+		return encodeOutput(w, result, o)
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/erdichen/imagediff"
+)
+
+func TestParseBlinkFormat(t *testing.T) {
+	for _, s := range []string{"", "gif", "apng"} {
+		if got, err := parseBlinkFormat(s); err != nil || string(got) != s {
+			t.Errorf("parseBlinkFormat(%q): got %q, %v", s, got, err)
+		}
+	}
+	if _, err := parseBlinkFormat("webp"); err == nil {
+		t.Errorf("parseBlinkFormat(%q): got no error", "webp")
+	}
+}
+
+func TestEncodeOutput(t *testing.T) {
+	result, err := imagediff.Compare(solidImage(4, 4, color.RGBA{100, 100, 100, 255}), solidImage(4, 4, color.RGBA{200, 100, 100, 255}), imagediff.Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		name    string
+		outOpts outputOptions
+		ext     string
+		check   func(t *testing.T, data []byte)
+	}{
+		{
+			name: "Difference",
+			ext:  ".png",
+			check: func(t *testing.T, data []byte) {
+				img, err := png.Decode(bytes.NewReader(data))
+				if err != nil || img.Bounds() != image.Rect(0, 0, 4, 4) {
+					t.Errorf("got %v, %v, want a 4x4 PNG", img, err)
+				}
+			},
+		},
+		{
+			name:    "Composite",
+			outOpts: outputOptions{Composite: true},
+			ext:     ".png",
+			check: func(t *testing.T, data []byte) {
+				img, err := png.Decode(bytes.NewReader(data))
+				if err != nil || img.Bounds() != image.Rect(0, 0, 12, 4) {
+					t.Errorf("got %v, %v, want a 12x4 PNG", img, err)
+				}
+			},
+		},
+		{
+			name:    "PAM",
+			outOpts: outputOptions{Netpbm: imagediff.NetpbmPAM},
+			ext:     ".pam",
+			check: func(t *testing.T, data []byte) {
+				img, err := imagediff.DecodeNetpbm(bytes.NewReader(data))
+				if err != nil || img.Bounds() != image.Rect(0, 0, 4, 4) || !bytes.HasPrefix(data, []byte("P7\n")) {
+					t.Errorf("got %v, %v, want a 4x4 PAM", img, err)
+				}
+			},
+		},
+		{
+			name:    "Legend Without Scale Ignored",
+			outOpts: outputOptions{Legend: true},
+			ext:     ".png",
+			check: func(t *testing.T, data []byte) {
+				img, err := png.Decode(bytes.NewReader(data))
+				if err != nil || img.Bounds() != image.Rect(0, 0, 4, 4) {
+					t.Errorf("got %v, %v, want a 4x4 PNG for color mode", img, err)
+				}
+			},
+		},
+		{
+			name:    "Blink GIF With Difference",
+			outOpts: outputOptions{Blink: blinkGIF, BlinkDiff: true, BlinkDelay: 300 * time.Millisecond},
+			ext:     ".gif",
+			check: func(t *testing.T, data []byte) {
+				anim, err := gif.DecodeAll(bytes.NewReader(data))
+				if err != nil || len(anim.Image) != 3 || anim.Delay[0] != 30 {
+					t.Errorf("got %v, want three frames of 30 hundredths of a second", err)
+				}
+			},
+		},
+		{
+			name:    "Blink APNG",
+			outOpts: outputOptions{Blink: blinkAPNG, BlinkDelay: time.Second},
+			ext:     ".png",
+			check: func(t *testing.T, data []byte) {
+				img, err := png.Decode(bytes.NewReader(data))
+				if err != nil || img.At(0, 0) != (color.NRGBA{100, 100, 100, 255}) {
+					t.Errorf("got %v, want the left image as the first frame", err)
+				}
+				if !bytes.Contains(data, []byte("acTL")) || !bytes.Contains(data, []byte("fdAT")) {
+					t.Error("missing animation chunks")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.outOpts.ext(); got != tt.ext {
+				t.Errorf("%s: ext got %q, want %q", tt.name, got, tt.ext)
+			}
+			var buf bytes.Buffer
+			if err := encodeOutput(&buf, result, tt.outOpts); err != nil {
+				t.Fatalf("%s: encodeOutput: %v", tt.name, err)
+			}
+			tt.check(t, buf.Bytes())
+		})
+	}
+	heatmap, err := imagediff.Compare(solidImage(4, 4, color.RGBA{100, 100, 100, 255}), solidImage(4, 4, color.RGBA{200, 100, 100, 255}), imagediff.Options{DiffMode: imagediff.DiffModeHeatmap})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := encodeOutput(&buf, heatmap, outputOptions{Composite: true, Legend: true}); err != nil {
+		t.Fatalf("encodeOutput: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil || img.Bounds().Dy() <= 4 || img.Bounds().Dx() < 12 {
+		t.Errorf("got %v, %v, want the composite with a legend bar below", img, err)
+	}
+
+	deep, err := imagediff.Compare(solidImage(4, 4, color.RGBA{100, 100, 100, 255}), solidImage(4, 4, color.RGBA{200, 100, 100, 255}), imagediff.Options{Deep: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buf.Reset()
+	if err := encodeOutput(&buf, deep, outputOptions{Composite: true}); err != nil {
+		t.Fatalf("encodeOutput: %v", err)
+	}
+	if img, err := png.Decode(&buf); err != nil || img.ColorModel() != color.RGBA64Model {
+		t.Errorf("got %v, want a 16-bit PNG", err)
+	}
+	buf.Reset()
+	if err := encodeOutput(&buf, deep, outputOptions{Netpbm: imagediff.NetpbmPPM}); err != nil {
+		t.Fatalf("encodeOutput: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("P6\n4 4\n65535\n")) {
+		t.Errorf("got header %q, want a 16-bit PPM", buf.Bytes()[:min(buf.Len(), 16)])
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/erdichen/imagediff"
+)
+
+// reportFormat selects the machine-readable report written by -report
+type reportFormat string
+
+const (
+	reportNone reportFormat = ""
+	reportJSON reportFormat = "json"
+)
+
+// parseReportFormat converts a -report flag value to a reportFormat
+func parseReportFormat(s string) (reportFormat, error) {
+	switch format := reportFormat(s); format {
+	case reportNone, reportJSON:
+		return format, nil
+	}
+	return "", fmt.Errorf("invalid report format %q", s)
+}
+
+// number is a float64 encoded as null in JSON when it is not finite, such as
+// the PSNR of identical images
+type number float64
+
+func (n number) MarshalJSON() ([]byte, error) {
+	f := float64(n)
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(f)
+}
+
+// inputInfo describes one input image
+type inputInfo struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Frames int    `json:"frames"`
+}
+
+type pointJSON struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type rectJSON struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type channelJSON struct {
+	R number `json:"r"`
+	G number `json:"g"`
+	B number `json:"b"`
+	A number `json:"a"`
+}
+
+type statsJSON struct {
+	Mean channelJSON `json:"mean"`
+	Std  channelJSON `json:"std"`
+}
+
+type errorMetricsJSON struct {
+	MSE  number `json:"mse"`
+	RMSE number `json:"rmse"`
+	PSNR number `json:"psnr"` // null for identical inputs
+	MAE  number `json:"mae"`
+}
+
+type metricsJSON struct {
+	R        errorMetricsJSON    `json:"r"`
+	G        errorMetricsJSON    `json:"g"`
+	B        errorMetricsJSON    `json:"b"`
+	A        errorMetricsJSON    `json:"a"`
+	Overall  errorMetricsJSON    `json:"overall"`
+	Relative relativeMetricsJSON `json:"relative"`
+}
+
+type relativeMetricsJSON struct {
+	MeanRelError number `json:"meanRelError"`
+	MaxRelError  number `json:"maxRelError"`
+	RelMSE       number `json:"relMSE"`
+}
+
+type regionJSON struct {
+	Name        string    `json:"name"`
+	Bounds      *rectJSON `json:"bounds"`
+	Pixels      int64     `json:"pixels"`
+	DiffCount   int64     `json:"diffCount"`
+	DiffPercent number    `json:"diffPercent"`
+	DiffBounds  *rectJSON `json:"diffBounds"`
+}
+
+type clusterJSON struct {
+	Bounds   *rectJSON   `json:"bounds"`
+	Area     int64       `json:"area"`
+	MaxError channelJSON `json:"maxError"`
+}
+
+// frameJSON is the comparison of one frame of animations
+type frameJSON struct {
+	Index        int    `json:"index"`
+	DiffCount    int64  `json:"diffCount"`
+	DiffPercent  number `json:"diffPercent"`
+	LeftDelayMs  number `json:"leftDelayMs"`
+	RightDelayMs number `json:"rightDelayMs"`
+	Exceeded     bool   `json:"exceeded"`
+}
+
+// animationJSON is the frame-by-frame comparison of animations. The other
+// fields of the report describe the frame with the most differing pixels.
+type animationJSON struct {
+	Shown           int         `json:"shown"` // Frame described by the other fields
+	DiffFrames      int         `json:"diffFrames"`
+	DiffCount       int64       `json:"diffCount"`
+	DiffPercent     number      `json:"diffPercent"`
+	DelayMismatches []int       `json:"delayMismatches"`
+	Frames          []frameJSON `json:"frames"`
+}
+
+// timing holds the durations of the stages of a run
+type timing struct {
+	Decode  time.Duration
+	Compare time.Duration
+	Write   time.Duration
+	Total   time.Duration
+}
+
+type timingJSON struct {
+	DecodeMs  number `json:"decodeMs"`
+	CompareMs number `json:"compareMs"`
+	WriteMs   number `json:"writeMs"`
+	TotalMs   number `json:"totalMs"`
+}
+
+// jsonReport is the document written by -report json
+type jsonReport struct {
+	Left            inputInfo            `json:"left"`
+	Right           inputInfo            `json:"right"`
+	Output          string               `json:"output"`
+	Mode            string               `json:"mode"`
+	Normalized      bool                 `json:"normalized"`
+	Scale           number               `json:"scale"`
+	Tolerance       number               `json:"tolerance"`
+	ToleranceMetric string               `json:"toleranceMetric"`
+	SizePolicy      string               `json:"sizePolicy"`
+	BitDepth        int                  `json:"bitDepth"`
+	Width           int                  `json:"width"`
+	Height          int                  `json:"height"`
+	DiffCount       int64                `json:"diffCount"`
+	DiffPercent     number               `json:"diffPercent"`
+	DiffBounds      *rectJSON            `json:"diffBounds"` // null if identical
+	AntiAliased     int64                `json:"antiAliased"`
+	SubStepCount    int64                `json:"subStepCount"` // Differing by less than one 8-bit step
+	Ignored         int64                `json:"ignored"`
+	MaxError        channelJSON          `json:"maxError"`
+	MeanError       channelJSON          `json:"meanError"`
+	Threshold       string               `json:"threshold"`
+	Exceeded        bool                 `json:"exceeded"`
+	Offset          *pointJSON           `json:"offset,omitempty"`
+	Stats           map[string]statsJSON `json:"stats,omitempty"`
+	Metrics         *metricsJSON         `json:"metrics,omitempty"`
+	DeltaE          map[string]number    `json:"deltaE,omitempty"`
+	SSIM            map[string]number    `json:"ssim,omitempty"`
+	Regions         []regionJSON         `json:"regions,omitempty"`
+	Clusters        []clusterJSON        `json:"clusters,omitempty"`
+	Animation       *animationJSON       `json:"animation,omitempty"`
+	Timing          timingJSON           `json:"timing"`
+}
+
+func toRect(r image.Rectangle) *rectJSON {
+	if r.Empty() {
+		return nil
+	}
+	return &rectJSON{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+func toChannel(e imagediff.ChannelError) channelJSON {
+	return channelJSON{number(e.R), number(e.G), number(e.B), number(e.A)}
+}
+
+func toStats(s imagediff.ImageStats) statsJSON {
+	return statsJSON{
+		Mean: channelJSON{number(s.MeanR), number(s.MeanG), number(s.MeanB), number(s.MeanA)},
+		Std:  channelJSON{number(s.StdR), number(s.StdG), number(s.StdB), number(s.StdA)},
+	}
+}
+
+func toErrorMetrics(m imagediff.ErrorMetrics) errorMetricsJSON {
+	return errorMetricsJSON{number(m.MSE), number(m.RMSE), number(m.PSNR), number(m.MAE)}
+}
+
+// bitDepth returns the bits per channel of the difference image
+func bitDepth(opts imagediff.Options) int {
+	if opts.Deep {
+		return 16
+	}
+	return 8
+}
+
+func milliseconds(d time.Duration) number {
+	return number(float64(d) / float64(time.Millisecond))
+}
+
+// newJSONReport builds the JSON report of a comparison. metrics adds the
+// error metrics, which -metrics also prints.
+func newJSONReport(left, right inputInfo, output string, result *imagediff.Result, threshold imagediff.Threshold, metrics bool, t timing) jsonReport {
+	opts := result.Options
+	bounds := result.Image.Bounds()
+	r := jsonReport{
+		Left:            left,
+		Right:           right,
+		Output:          output,
+		Mode:            string(opts.DiffMode),
+		Normalized:      opts.Normalized,
+		Scale:           number(opts.Scale),
+		Tolerance:       number(opts.Tolerance),
+		ToleranceMetric: string(opts.ToleranceMetric),
+		SizePolicy:      string(opts.SizePolicy),
+		BitDepth:        bitDepth(opts),
+		Width:           bounds.Dx(),
+		Height:          bounds.Dy(),
+		DiffCount:       result.DiffCount,
+		DiffPercent:     number(result.DiffPercent),
+		DiffBounds:      toRect(result.DiffBounds),
+		AntiAliased:     result.AntiAliased,
+		SubStepCount:    result.SubStepCount,
+		Ignored:         result.Ignored,
+		MaxError:        toChannel(result.MaxError),
+		MeanError:       toChannel(result.MeanError),
+		Threshold:       threshold.String(),
+		Exceeded:        result.Exceeds(threshold),
+		Timing: timingJSON{
+			DecodeMs:  milliseconds(t.Decode),
+			CompareMs: milliseconds(t.Compare),
+			WriteMs:   milliseconds(t.Write),
+			TotalMs:   milliseconds(t.Total),
+		},
+	}
+	if opts.Align {
+		r.Offset = &pointJSON{result.Offset.X, result.Offset.Y}
+	}
+	if opts.Normalized {
+		r.Stats = map[string]statsJSON{"left": toStats(result.LeftStats), "right": toStats(result.RightStats)}
+	}
+	if metrics {
+		m := result.Metrics
+		r.Metrics = &metricsJSON{
+			R:       toErrorMetrics(m.R),
+			G:       toErrorMetrics(m.G),
+			B:       toErrorMetrics(m.B),
+			A:       toErrorMetrics(m.A),
+			Overall: toErrorMetrics(m.Overall),
+			Relative: relativeMetricsJSON{
+				MeanRelError: number(m.Relative.MeanRelError),
+				MaxRelError:  number(m.Relative.MaxRelError),
+				RelMSE:       number(m.Relative.RelMSE),
+			},
+		}
+	}
+	if opts.DiffMode == imagediff.DiffModeDeltaE {
+		r.DeltaE = map[string]number{"max": number(result.MaxDeltaE), "mean": number(result.MeanDeltaE), "threshold": number(opts.DeltaEThreshold)}
+	}
+	if opts.SSIM {
+		r.SSIM = map[string]number{"ssim": number(result.SSIM), "msssim": number(result.MSSSIM)}
+	}
+	for _, rr := range result.Regions {
+		r.Regions = append(r.Regions, regionJSON{
+			Name:        rr.Name,
+			Bounds:      toRect(rr.Bounds),
+			Pixels:      rr.Pixels,
+			DiffCount:   rr.DiffCount,
+			DiffPercent: number(rr.DiffPercent),
+			DiffBounds:  toRect(rr.DiffBounds),
+		})
+	}
+	for _, c := range result.Clusters {
+		r.Clusters = append(r.Clusters, clusterJSON{Bounds: toRect(c.Bounds), Area: c.Area, MaxError: toChannel(c.MaxError)})
+	}
+	return r
+}
+
+// newPairJSONReport builds the JSON report of a compared pair, with the
+// frames of animated inputs
+func newPairJSONReport(o pairOutcome, threshold imagediff.Threshold, metrics bool) jsonReport {
+	r := newJSONReport(o.Left, o.Right, o.Output, o.Result, threshold, metrics, o.Timing)
+	a := o.Animation
+	if a == nil {
+		return r
+	}
+	r.Exceeded = o.Exceeded
+	r.Animation = &animationJSON{
+		Shown:           a.Worst,
+		DiffFrames:      a.DiffFrames,
+		DiffCount:       a.DiffCount,
+		DiffPercent:     number(a.DiffPercent),
+		DelayMismatches: append([]int{}, a.DelayMismatches...),
+	}
+	for i, f := range a.Frames {
+		r.Animation.Frames = append(r.Animation.Frames, frameJSON{
+			Index:        i,
+			DiffCount:    f.DiffCount,
+			DiffPercent:  number(f.DiffPercent),
+			LeftDelayMs:  milliseconds(a.Left.Delays[i]),
+			RightDelayMs: milliseconds(a.Right.Delays[i]),
+			Exceeded:     f.Exceeds(threshold),
+		})
+	}
+	return r
+}
+
+// jsonError is the batch report entry of a pair that could not be compared
+type jsonError struct {
+	Left  inputInfo `json:"left"`
+	Right inputInfo `json:"right"`
+	Error string    `json:"error"`
+}
+
+// newBatchJSONReport builds the JSON report of a batch, one entry per pair
+func newBatchJSONReport(outcomes []pairOutcome, threshold imagediff.Threshold, metrics bool) []any {
+	entries := make([]any, 0, len(outcomes))
+	for _, o := range outcomes {
+		if o.Err != nil {
+			entries = append(entries, jsonError{Left: o.Left, Right: o.Right, Error: o.Err.Error()})
+			continue
+		}
+		entries = append(entries, newPairJSONReport(o, threshold, metrics))
+	}
+	return entries
+}
+
+// writeJSONReport writes r as indented JSON
+func writeJSONReport(w io.Writer, r any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// writeReport writes a JSON report to filename, or to stdout if filename is
+// empty
+func writeReport(filename string, r any) error {
+	if filename == "" {
+		return writeJSONReport(os.Stdout, r)
+	}
+	return writeFile(filename, func(w io.Writer) error {
+		return writeJSONReport(w, r)
+	})
+}
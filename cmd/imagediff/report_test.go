@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erdichen/imagediff"
+)
+
+func solidImage(w, h int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestParseReportFormat(t *testing.T) {
+	for _, s := range []string{"", "json"} {
+		if got, err := parseReportFormat(s); err != nil || string(got) != s {
+			t.Errorf("parseReportFormat(%q): got %q, %v", s, got, err)
+		}
+	}
+	if _, err := parseReportFormat("xml"); err == nil {
+		t.Errorf("parseReportFormat(%q): got no error", "xml")
+	}
+}
+
+func TestJSONReport(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	tests := []struct {
+		name       string
+		right      color.Color
+		opts       imagediff.Options
+		metrics    bool
+		wantKeys   []string
+		absentKeys []string
+		check      func(t *testing.T, doc map[string]any)
+	}{
+		{
+			name:       "Identical With Metrics",
+			right:      gray,
+			opts:       imagediff.Options{Align: true},
+			metrics:    true,
+			wantKeys:   []string{"left", "right", "mode", "scale", "diffCount", "diffPercent", "timing", "metrics", "offset"},
+			absentKeys: []string{"stats", "ssim"},
+			check: func(t *testing.T, doc map[string]any) {
+				// Infinite PSNR is encoded as null
+				psnr, ok := doc["metrics"].(map[string]any)["overall"].(map[string]any)["psnr"]
+				if !ok || psnr != nil {
+					t.Errorf("overall PSNR got %v, want null", psnr)
+				}
+				if rel := doc["metrics"].(map[string]any)["relative"].(map[string]any); rel["relMSE"] != 0.0 || rel["maxRelError"] != 0.0 {
+					t.Errorf("relative metrics got %v, want zero", rel)
+				}
+				if doc["diffBounds"] != nil {
+					t.Errorf("diffBounds got %v, want null", doc["diffBounds"])
+				}
+			},
+		},
+		{
+			name:       "Normalized",
+			right:      color.RGBA{110, 100, 100, 255},
+			opts:       imagediff.Options{Normalized: true},
+			wantKeys:   []string{"stats"},
+			absentKeys: []string{"metrics", "offset"},
+			check: func(t *testing.T, doc map[string]any) {
+				mean := doc["stats"].(map[string]any)["right"].(map[string]any)["mean"].(map[string]any)
+				if mean["r"] != 110.0 {
+					t.Errorf("right mean R got %v, want 110", mean["r"])
+				}
+			},
+		},
+		{
+			name:     "Differences",
+			right:    color.RGBA{200, 100, 100, 255},
+			opts:     imagediff.Options{SSIM: true},
+			wantKeys: []string{"ssim"},
+			check: func(t *testing.T, doc map[string]any) {
+				if doc["diffCount"] != 16.0 || doc["diffPercent"] != 100.0 || doc["exceeded"] != true {
+					t.Errorf("got diffCount %v diffPercent %v exceeded %v, want 16, 100 and true",
+						doc["diffCount"], doc["diffPercent"], doc["exceeded"])
+				}
+				bounds := doc["diffBounds"].(map[string]any)
+				if bounds["width"] != 4.0 || bounds["height"] != 4.0 {
+					t.Errorf("diffBounds got %v, want 4x4", bounds)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := imagediff.Compare(solidImage(4, 4, gray), solidImage(4, 4, tt.right), tt.opts)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			left := inputInfo{Path: "left.png", Format: "png", Width: 4, Height: 4}
+			right := inputInfo{Path: "right.png", Format: "png", Width: 4, Height: 4}
+			r := newJSONReport(left, right, "diff.png", result, imagediff.Threshold{}, tt.metrics, timing{Total: time.Millisecond})
+
+			var buf bytes.Buffer
+			if err := writeJSONReport(&buf, r); err != nil {
+				t.Fatalf("%s: writeJSONReport: %v", tt.name, err)
+			}
+			var doc map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+				t.Fatalf("%s: invalid JSON %q: %v", tt.name, buf.String(), err)
+			}
+			for _, key := range tt.wantKeys {
+				if _, ok := doc[key]; !ok {
+					t.Errorf("%s: missing key %q", tt.name, key)
+				}
+			}
+			for _, key := range tt.absentKeys {
+				if _, ok := doc[key]; ok {
+					t.Errorf("%s: unexpected key %q", tt.name, key)
+				}
+			}
+			if !strings.Contains(buf.String(), `"path": "left.png"`) {
+				t.Errorf("%s: left path missing from %s", tt.name, buf.String())
+			}
+			if tt.check != nil {
+				tt.check(t, doc)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package imagediff
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// Colormap selects the colors of DiffModeHeatmap.
+type Colormap string
+
+const (
+	ColormapViridis Colormap = "viridis" // Perceptually uniform dark blue to yellow
+	ColormapInferno Colormap = "inferno" // Perceptually uniform black to pale yellow
+	ColormapJet     Colormap = "jet"     // Classic blue to red rainbow
+	ColormapTurbo   Colormap = "turbo"   // Smoother rainbow with perceptual lightness
+)
+
+// ParseColormap converts a -colormap flag value to a Colormap.
+func ParseColormap(s string) (Colormap, error) {
+	switch cm := Colormap(s); cm {
+	case ColormapViridis, ColormapInferno, ColormapJet, ColormapTurbo:
+		return cm, nil
+	}
+	return "", fmt.Errorf("invalid colormap %q", s)
+}
+
+// Polynomial fits of the matplotlib viridis and inferno colormaps and of
+// Google's turbo colormap: coefficients of t^0 to t^6 per channel.
+var (
+	viridisCoeffs = [3][7]float64{
+		{0.2777273272234177, 0.1050930431085774, -0.3308618287255563, -4.634230498983486, 6.228269936347081, 4.776384997670288, -5.435455855934631},
+		{0.005407344544966578, 1.404613529898575, 0.214847559468213, -5.799100973351585, 14.17993336680509, -13.74514537774601, 4.645852612178535},
+		{0.3340998053353061, 1.384590162594685, 0.09509516302823659, -19.33244095627987, 56.69055260068105, -65.35303263337234, 26.3124352495832},
+	}
+	infernoCoeffs = [3][7]float64{
+		{0.0002189403691192265, 0.1065134194856116, 11.60249308247187, -41.70399613139459, 77.162935699427, -71.31942824499214, 25.13112622477341},
+		{0.001651004631001012, 0.5639564367884091, -3.972853965665698, 17.43639888205313, -33.40235894210092, 32.62606426397723, -12.24266895238567},
+		{-0.01948089843709184, 3.932712388889277, -15.9423941062914, 44.35414519872813, -81.80730925738993, 73.20951985803202, -23.07032500287172},
+	}
+	turboCoeffs = [3][7]float64{
+		{0.13572138, 4.61539260, -42.66032258, 132.13108234, -152.94239396, 59.28637943, 0},
+		{0.09140261, 2.19418839, 4.84296658, -14.18503333, 4.27729857, 2.82956604, 0},
+		{0.10667330, 12.64194608, -60.58204836, 110.36276771, -89.90310912, 27.34824973, 0},
+	}
+)
+
+// At maps t in [0, 1] to a color; t outside is clamped.
+func (cm Colormap) At(t float64) color.RGBA {
+	rgb := cm.rgb(t)
+	to8 := func(v float64) uint8 {
+		return uint8(math.Round(v * 255))
+	}
+	return color.RGBA{to8(rgb[0]), to8(rgb[1]), to8(rgb[2]), 255}
+}
+
+// rgb returns the color of At as channel values in [0, 1], without rounding.
+func (cm Colormap) rgb(t float64) [3]float64 {
+	t = max(min(t, 1), 0)
+	var rgb [3]float64
+	switch cm {
+	case ColormapJet:
+		rgb = [3]float64{1.5 - math.Abs(4*t-3), 1.5 - math.Abs(4*t-2), 1.5 - math.Abs(4*t-1)}
+	case ColormapInferno:
+		rgb = evalCoeffs(&infernoCoeffs, t)
+	case ColormapTurbo:
+		rgb = evalCoeffs(&turboCoeffs, t)
+	default:
+		rgb = evalCoeffs(&viridisCoeffs, t)
+	}
+	for c := range rgb {
+		rgb[c] = max(min(rgb[c], 1), 0)
+	}
+	return rgb
+}
+
+// evalCoeffs evaluates the per-channel polynomials at t with Horner's method.
+func evalCoeffs(coeffs *[3][7]float64, t float64) [3]float64 {
+	var rgb [3]float64
+	for c := range rgb {
+		for i := len(coeffs[c]) - 1; i >= 0; i-- {
+			rgb[c] = rgb[c]*t + coeffs[c][i]
+		}
+	}
+	return rgb
+}
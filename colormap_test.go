@@ -0,0 +1,99 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestParseColormap(t *testing.T) {
+	for _, s := range []string{"viridis", "inferno", "jet", "turbo"} {
+		if got, err := ParseColormap(s); err != nil || string(got) != s {
+			t.Errorf("ParseColormap(%q): got %q, %v", s, got, err)
+		}
+	}
+	for _, s := range []string{"", "rainbow"} {
+		if _, err := ParseColormap(s); err == nil {
+			t.Errorf("ParseColormap(%q): got no error", s)
+		}
+	}
+}
+
+func TestColormapAt(t *testing.T) {
+	tests := []struct {
+		cm   Colormap
+		t    float64
+		want color.RGBA
+	}{
+		// Reference values of the published colormaps, within the error of
+		// the polynomial fits
+		{ColormapViridis, 0, color.RGBA{68, 1, 84, 255}},
+		{ColormapViridis, 0.5, color.RGBA{33, 145, 140, 255}},
+		{ColormapViridis, 1, color.RGBA{253, 231, 37, 255}},
+		{ColormapInferno, 0, color.RGBA{0, 0, 4, 255}},
+		{ColormapInferno, 1, color.RGBA{252, 255, 164, 255}},
+		{ColormapTurbo, 0.5, color.RGBA{164, 252, 60, 255}}, // Loosest fit
+		{ColormapJet, 0, color.RGBA{0, 0, 128, 255}},
+		{ColormapJet, 0.5, color.RGBA{128, 255, 128, 255}},
+		{ColormapJet, 1, color.RGBA{128, 0, 0, 255}},
+		// Clamped outside [0, 1]
+		{ColormapJet, -1, color.RGBA{0, 0, 128, 255}},
+		{ColormapJet, 2, color.RGBA{128, 0, 0, 255}},
+	}
+
+	for _, tt := range tests {
+		tolerance := 8
+		if tt.cm == ColormapTurbo {
+			tolerance = 24
+		}
+		near := func(a, b uint8) bool { return max(int(a)-int(b), int(b)-int(a)) <= tolerance }
+		got := tt.cm.At(tt.t)
+		if !near(got.R, tt.want.R) || !near(got.G, tt.want.G) || !near(got.B, tt.want.B) || got.A != 255 {
+			t.Errorf("%s.At(%v): got %v, want %v", tt.cm, tt.t, got, tt.want)
+		}
+	}
+
+	// The perceptual colormaps grow steadily lighter
+	for _, cm := range []Colormap{ColormapViridis, ColormapInferno} {
+		prev := -1.0
+		for i := range 11 {
+			c := cm.At(float64(i) / 10)
+			luma := 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+			if luma <= prev {
+				t.Errorf("%s: luma %v at %v not above %v", cm, luma, float64(i)/10, prev)
+			}
+			prev = luma
+		}
+	}
+}
+
+func TestCompareHeatmap(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	for _, cm := range []Colormap{"", ColormapInferno} {
+		left := createTestImage(4, 4, gray)
+		right := createTestImage(4, 4, gray).(*image.RGBA)
+		right.Set(1, 1, color.RGBA{255, 255, 255, 255})
+		right.Set(2, 2, color.RGBA{110, 110, 110, 255})
+
+		result, err := Compare(left, right, Options{DiffMode: DiffModeHeatmap, Colormap: cm})
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", cm, err)
+		}
+		want := result.Options.Colormap
+		if cm == "" && want != ColormapViridis {
+			t.Errorf("default colormap: got %q, want %q", want, ColormapViridis)
+		}
+		for p, v := range map[image.Point]float64{{0, 0}: 0, {1, 1}: 1, {2, 2}: 20.0 / 255} {
+			if got := result.Image.At(p.X, p.Y); got != want.At(v) {
+				t.Errorf("%q: pixel %v got %v, want %v", cm, p, got, want.At(v))
+			}
+		}
+		if result.DiffCount != 2 {
+			t.Errorf("%q: DiffCount got %d, want 2", cm, result.DiffCount)
+		}
+	}
+
+	if _, err := Compare(createTestImage(2, 2, gray), createTestImage(2, 2, gray), Options{DiffMode: DiffModeHeatmap, Colormap: "rainbow"}); err == nil {
+		t.Error("invalid colormap: got no error")
+	}
+}
@@ -0,0 +1,148 @@
+package imagediff
+
+import (
+	"image/color"
+	"math"
+)
+
+// DefaultDeltaEThreshold is roughly one just-noticeable difference in CIEDE2000.
+const DefaultDeltaEThreshold = 1.0
+
+// lab is a color in CIE L*a*b* with a D65 white point.
+type lab struct {
+	L, A, B float64
+}
+
+// D65 reference white in CIE XYZ
+const (
+	whiteX = 0.95047
+	whiteY = 1.0
+	whiteZ = 1.08883
+)
+
+// srgbToLinear removes the sRGB transfer function from a channel in [0, 1].
+func srgbToLinear(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func labF(t float64) float64 {
+	const delta = 6.0 / 29.0
+	if t > delta*delta*delta {
+		return math.Cbrt(t)
+	}
+	return t/(3*delta*delta) + 4.0/29.0
+}
+
+// rgbToLab converts 8-bit sRGB channel values to CIE L*a*b*.
+func rgbToLab(r, g, b float64) lab {
+	return linearToLab(srgbToLinear(r/255), srgbToLinear(g/255), srgbToLinear(b/255))
+}
+
+// linearToLab converts linear sRGB channel values, with 1 as the white point,
+// to CIE L*a*b*.
+func linearToLab(rl, gl, bl float64) lab {
+	x := 0.4124564*rl + 0.3575761*gl + 0.1804375*bl
+	y := 0.2126729*rl + 0.7151522*gl + 0.0721750*bl
+	z := 0.0193339*rl + 0.1191920*gl + 0.9503041*bl
+
+	fx := labF(x / whiteX)
+	fy := labF(y / whiteY)
+	fz := labF(z / whiteZ)
+	return lab{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
+
+// ciede2000 returns the CIEDE2000 color difference between two colors, with
+// the parametric weighting factors kL, kC and kH set to 1. See Sharma, Wu and
+// Dalal, "The CIEDE2000 Color-Difference Formula" (2005).
+func ciede2000(c1, c2 lab) float64 {
+	const pow25to7 = 6103515625.0 // 25^7
+
+	cab1 := math.Hypot(c1.A, c1.B)
+	cab2 := math.Hypot(c2.A, c2.B)
+	cabMean := (cab1 + cab2) / 2
+	cabMean7 := math.Pow(cabMean, 7)
+	g := 0.5 * (1 - math.Sqrt(cabMean7/(cabMean7+pow25to7)))
+
+	a1 := (1 + g) * c1.A
+	a2 := (1 + g) * c2.A
+	cp1 := math.Hypot(a1, c1.B)
+	cp2 := math.Hypot(a2, c2.B)
+
+	hueAngle := func(b, a float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := math.Atan2(b, a) * 180 / math.Pi
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+	hp1 := hueAngle(c1.B, a1)
+	hp2 := hueAngle(c2.B, a2)
+
+	dL := c2.L - c1.L
+	dC := cp2 - cp1
+	var dh float64
+	if cp1*cp2 != 0 {
+		dh = hp2 - hp1
+		if dh > 180 {
+			dh -= 360
+		} else if dh < -180 {
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(cp1*cp2) * math.Sin(dh*math.Pi/360)
+
+	lMean := (c1.L + c2.L) / 2
+	cpMean := (cp1 + cp2) / 2
+	hpMean := hp1 + hp2
+	if cp1*cp2 != 0 {
+		if math.Abs(hp1-hp2) <= 180 {
+			hpMean /= 2
+		} else if hp1+hp2 < 360 {
+			hpMean = (hp1 + hp2 + 360) / 2
+		} else {
+			hpMean = (hp1 + hp2 - 360) / 2
+		}
+	}
+
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	t := 1 - 0.17*math.Cos(rad(hpMean-30)) +
+		0.24*math.Cos(rad(2*hpMean)) +
+		0.32*math.Cos(rad(3*hpMean+6)) -
+		0.20*math.Cos(rad(4*hpMean-63))
+	dTheta := 30 * math.Exp(-((hpMean-275)/25)*((hpMean-275)/25))
+	cpMean7 := math.Pow(cpMean, 7)
+	rc := 2 * math.Sqrt(cpMean7/(cpMean7+pow25to7))
+	lMean50 := (lMean - 50) * (lMean - 50)
+	sl := 1 + 0.015*lMean50/math.Sqrt(20+lMean50)
+	sc := 1 + 0.045*cpMean
+	sh := 1 + 0.015*cpMean*t
+	rt := -math.Sin(rad(2*dTheta)) * rc
+
+	return math.Sqrt((dL/sl)*(dL/sl) + (dC/sc)*(dC/sc) + (dH/sh)*(dH/sh) + rt*(dC/sc)*(dH/sh))
+}
+
+// heatColor maps t in [0, 1] to a black-red-yellow-white heatmap.
+func heatColor(t float64) color.RGBA {
+	r, g, b := heatLevels(t)
+	return color.RGBA{uint8(r), uint8(g), uint8(b), 255}
+}
+
+// heatLevels returns the channel levels of heatColor in 8-bit units, without
+// rounding.
+func heatLevels(t float64) (r, g, b float64) {
+	t = max(min(t, 1), 0) * 3
+	switch {
+	case t < 1:
+		return t * 255, 0, 0
+	case t < 2:
+		return 255, (t - 1) * 255, 0
+	default:
+		return 255, 255, (t - 2) * 255
+	}
+}
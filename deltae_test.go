@@ -0,0 +1,88 @@
+package imagediff
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestCIEDE2000(t *testing.T) {
+	// Reference pairs from Sharma, Wu and Dalal (2005), Table 1
+	tests := []struct {
+		name   string
+		c1, c2 lab
+		want   float64
+	}{
+		{name: "Pair 1", c1: lab{50.0000, 2.6772, -79.7751}, c2: lab{50.0000, 0.0000, -82.7485}, want: 2.0425},
+		{name: "Pair 7", c1: lab{50.0000, 0.0000, 0.0000}, c2: lab{50.0000, -1.0000, 2.0000}, want: 2.3669},
+		{name: "Pair 13", c1: lab{50.0000, 2.4900, -0.0010}, c2: lab{50.0000, -2.4900, 0.0011}, want: 7.2195},
+		{name: "Pair 17", c1: lab{50.0000, 2.5000, 0.0000}, c2: lab{73.0000, 25.0000, -18.0000}, want: 27.1492},
+		{name: "Pair 25", c1: lab{60.2574, -34.0099, 36.2677}, c2: lab{60.4626, -34.1751, 39.4387}, want: 1.2644},
+		{name: "Identical", c1: lab{50, 10, 10}, c2: lab{50, 10, 10}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ciede2000(tt.c1, tt.c2); !approxEqual(got, tt.want, 0.0001) {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			}
+			if got := ciede2000(tt.c2, tt.c1); !approxEqual(got, tt.want, 0.0001) {
+				t.Errorf("%s (swapped): got %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRGBToLab(t *testing.T) {
+	tests := []struct {
+		name    string
+		r, g, b float64
+		want    lab
+	}{
+		{name: "White", r: 255, g: 255, b: 255, want: lab{100, 0, 0}},
+		{name: "Black", r: 0, g: 0, b: 0, want: lab{0, 0, 0}},
+		{name: "Red", r: 255, g: 0, b: 0, want: lab{53.24, 80.09, 67.20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rgbToLab(tt.r, tt.g, tt.b)
+			if !approxEqual(got.L, tt.want.L, 0.01) || !approxEqual(got.A, tt.want.A, 0.01) || !approxEqual(got.B, tt.want.B, 0.01) {
+				t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareDeltaEMode(t *testing.T) {
+	tests := []struct {
+		name          string
+		img2          color.RGBA
+		threshold     float64
+		wantDiffCount int64
+	}{
+		{name: "Identical", img2: color.RGBA{100, 150, 200, 255}, wantDiffCount: 0},
+		{name: "Below JND", img2: color.RGBA{100, 150, 201, 255}, wantDiffCount: 0},
+		{name: "Visible", img2: color.RGBA{120, 150, 200, 255}, wantDiffCount: 16},
+		{name: "Custom Threshold", img2: color.RGBA{120, 150, 200, 255}, threshold: 50, wantDiffCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img1 := createTestImage(4, 4, color.RGBA{100, 150, 200, 255})
+			res, err := Compare(img1, createTestImage(4, 4, tt.img2), Options{DiffMode: DiffModeDeltaE, DeltaEThreshold: tt.threshold})
+			if err != nil {
+				t.Fatalf("%s: Compare: %v", tt.name, err)
+			}
+			if res.DiffCount != tt.wantDiffCount {
+				t.Errorf("%s: DiffCount got %d, want %d (max ΔE %v)", tt.name, res.DiffCount, tt.wantDiffCount, res.MaxDeltaE)
+			}
+			if !approxEqual(res.MaxDeltaE, res.MeanDeltaE, 1e-9) {
+				t.Errorf("%s: uniform images should have MaxDeltaE %v == MeanDeltaE %v", tt.name, res.MaxDeltaE, res.MeanDeltaE)
+			}
+			gotPixel := res.Image.At(0, 0).(color.RGBA)
+			if (res.MaxDeltaE == 0) != (gotPixel == color.RGBA{0, 0, 0, 255}) {
+				t.Errorf("%s: heatmap pixel %v inconsistent with ΔE %v", tt.name, gotPixel, res.MaxDeltaE)
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package imagediff
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+var errEXRFormat = errors.New("imagediff: invalid OpenEXR image")
+
+// OpenEXR compression methods supported by DecodeEXR
+const (
+	exrNone = 0 // Uncompressed, one scanline per chunk
+	exrZIPS = 2 // zlib, one scanline per chunk
+	exrZIP  = 3 // zlib, 16 scanlines per chunk
+)
+
+// OpenEXR pixel types
+const (
+	exrUint  = 0
+	exrHalf  = 1
+	exrFloat = 2
+)
+
+// maxEXRAttribute bounds the size of the header attributes that are read.
+const maxEXRAttribute = 1 << 20
+
+func init() {
+	image.RegisterFormat("exr", "\x76\x2f\x31\x01", DecodeEXR, DecodeEXRConfig)
+}
+
+// exrChannel is an entry of the channels attribute.
+type exrChannel struct {
+	name      string
+	pixelType int32
+}
+
+// size returns the bytes per sample.
+func (c exrChannel) size() int {
+	if c.pixelType == exrHalf {
+		return 2
+	}
+	return 4
+}
+
+// exrHeader holds the attributes of a scanline OpenEXR image needed to
+// decode it.
+type exrHeader struct {
+	channels    []exrChannel // Sorted by name, as stored
+	compression byte
+	dataWindow  image.Rectangle
+}
+
+// linesPerChunk returns the number of scanlines stored in each chunk.
+func (h *exrHeader) linesPerChunk() int {
+	if h.compression == exrZIP {
+		return 16
+	}
+	return 1
+}
+
+// DecodeEXR reads a single-part scanline OpenEXR image, uncompressed or with
+// ZIP or ZIPS compression, into a *FloatImage with the bounds of its data
+// window. The R, G, B and A channels are used, or Y for grayscale images;
+// other channels and layers are ignored. Half, float and uint samples are
+// supported. Alpha is premultiplied, as OpenEXR stores it; images without
+// an A channel are opaque.
+func DecodeEXR(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readEXRHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{"R": 0, "G": 1, "B": 2, "A": 3, "Y": -1}
+	var hasColor, hasAlpha bool
+	bytesPerPixel := 0
+	for _, c := range h.channels {
+		bytesPerPixel += c.size()
+		switch c.name {
+		case "R", "G", "B", "Y":
+			hasColor = true
+		case "A":
+			hasAlpha = true
+		}
+	}
+	if !hasColor {
+		return nil, fmt.Errorf("%w: no R, G, B or Y channel", errEXRFormat)
+	}
+
+	img := NewFloatImage(h.dataWindow)
+	if !hasAlpha {
+		for i := 3; i < len(img.Pix); i += 4 {
+			img.Pix[i] = 1
+		}
+	}
+	width := h.dataWindow.Dx()
+	lines := h.linesPerChunk()
+	numChunks := (h.dataWindow.Dy() + lines - 1) / lines
+
+	// Chunks follow the offset table in the file, so they are read in turn
+	// and placed by their own y coordinate.
+	if _, err := br.Discard(8 * numChunks); err != nil {
+		return nil, fmt.Errorf("%w: truncated offset table", errEXRFormat)
+	}
+	var chunkHeader [8]byte
+	var packed, raw []byte
+	for range numChunks {
+		if _, err := io.ReadFull(br, chunkHeader[:]); err != nil {
+			return nil, fmt.Errorf("%w: truncated chunk", errEXRFormat)
+		}
+		y := int(int32(binary.LittleEndian.Uint32(chunkHeader[:4])))
+		size := int(int32(binary.LittleEndian.Uint32(chunkHeader[4:])))
+		if y < h.dataWindow.Min.Y || y >= h.dataWindow.Max.Y || (y-h.dataWindow.Min.Y)%lines != 0 {
+			return nil, fmt.Errorf("%w: chunk at line %d", errEXRFormat, y)
+		}
+		n := min(lines, h.dataWindow.Max.Y-y)
+		rawSize := n * width * bytesPerPixel
+		if size <= 0 || size > rawSize || (h.compression == exrNone && size != rawSize) {
+			return nil, fmt.Errorf("%w: chunk size %d", errEXRFormat, size)
+		}
+		packed = grow(packed, size)
+		if _, err := io.ReadFull(br, packed); err != nil {
+			return nil, fmt.Errorf("%w: truncated chunk", errEXRFormat)
+		}
+		data := packed
+		if size < rawSize {
+			// Compressed chunks that would not shrink are stored as they are
+			raw = grow(raw, rawSize)
+			if err := unzipEXRChunk(packed, raw); err != nil {
+				return nil, err
+			}
+			data = raw
+		}
+
+		// Each scanline holds the samples of one channel after another
+		for line := range n {
+			for _, c := range h.channels {
+				ch, ok := index[c.name]
+				for x := range width {
+					var v float32
+					switch c.pixelType {
+					case exrHalf:
+						v = halfToFloat32(binary.LittleEndian.Uint16(data))
+					case exrFloat:
+						v = math.Float32frombits(binary.LittleEndian.Uint32(data))
+					default:
+						v = float32(binary.LittleEndian.Uint32(data))
+					}
+					data = data[c.size():]
+					if !ok {
+						continue
+					}
+					i := img.PixOffset(h.dataWindow.Min.X+x, y+line)
+					if ch < 0 {
+						img.Pix[i], img.Pix[i+1], img.Pix[i+2] = v, v, v
+					} else {
+						img.Pix[i+ch] = v
+					}
+				}
+			}
+		}
+	}
+	return img, nil
+}
+
+// DecodeEXRConfig returns the dimensions of the data window of an OpenEXR
+// image without decoding the pixels.
+func DecodeEXRConfig(r io.Reader) (image.Config, error) {
+	h, err := readEXRHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.RGBA64Model, Width: h.dataWindow.Dx(), Height: h.dataWindow.Dy()}, nil
+}
+
+// readEXRHeader parses the magic number, version and header attributes,
+// leaving br at the offset table.
+func readEXRHeader(br *bufio.Reader) (*exrHeader, error) {
+	var start [8]byte
+	if _, err := io.ReadFull(br, start[:]); err != nil || string(start[:4]) != "\x76\x2f\x31\x01" {
+		return nil, errEXRFormat
+	}
+	version := binary.LittleEndian.Uint32(start[4:])
+	if version&0xff != 2 {
+		return nil, fmt.Errorf("%w: version %d", errEXRFormat, version&0xff)
+	}
+	if version&0x1a00 != 0 {
+		return nil, fmt.Errorf("%w: tiled, deep and multi-part images are not supported", errEXRFormat)
+	}
+
+	h := &exrHeader{}
+	var haveChannels, haveCompression, haveDataWindow bool
+	for {
+		name, err := readEXRString(br)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			break
+		}
+		if _, err := readEXRString(br); err != nil { // Type, implied by the name
+			return nil, err
+		}
+		var sizeBytes [4]byte
+		if _, err := io.ReadFull(br, sizeBytes[:]); err != nil {
+			return nil, fmt.Errorf("%w: truncated header", errEXRFormat)
+		}
+		size := int(int32(binary.LittleEndian.Uint32(sizeBytes[:])))
+		if size < 0 || size > maxEXRAttribute {
+			return nil, fmt.Errorf("%w: attribute %q of %d bytes", errEXRFormat, name, size)
+		}
+		switch name {
+		case "channels", "compression", "dataWindow":
+		default:
+			if _, err := br.Discard(size); err != nil {
+				return nil, fmt.Errorf("%w: truncated header", errEXRFormat)
+			}
+			continue
+		}
+		value := make([]byte, size)
+		if _, err := io.ReadFull(br, value); err != nil {
+			return nil, fmt.Errorf("%w: truncated header", errEXRFormat)
+		}
+		switch name {
+		case "channels":
+			if h.channels, err = parseEXRChannels(value); err != nil {
+				return nil, err
+			}
+			haveChannels = true
+		case "compression":
+			if size != 1 {
+				return nil, fmt.Errorf("%w: compression attribute", errEXRFormat)
+			}
+			h.compression = value[0]
+			haveCompression = true
+		case "dataWindow":
+			if size != 16 {
+				return nil, fmt.Errorf("%w: dataWindow attribute", errEXRFormat)
+			}
+			box := func(i int) int { return int(int32(binary.LittleEndian.Uint32(value[4*i:]))) }
+			// Maximum coordinates are inclusive
+			h.dataWindow = image.Rect(box(0), box(1), box(2)+1, box(3)+1)
+			haveDataWindow = box(2) >= box(0) && box(3) >= box(1)
+			if !haveDataWindow {
+				return nil, fmt.Errorf("%w: empty data window", errEXRFormat)
+			}
+		}
+	}
+
+	switch {
+	case !haveChannels || !haveCompression || !haveDataWindow:
+		return nil, fmt.Errorf("%w: missing channels, compression or dataWindow", errEXRFormat)
+	case h.compression != exrNone && h.compression != exrZIPS && h.compression != exrZIP:
+		return nil, fmt.Errorf("%w: unsupported compression %d", errEXRFormat, h.compression)
+	case int64(h.dataWindow.Dx())*int64(h.dataWindow.Dy())*4 > maxFloatSamples:
+		return nil, fmt.Errorf("%w: image too large", errEXRFormat)
+	}
+	return h, nil
+}
+
+// readEXRString reads a null-terminated attribute name or type.
+func readEXRString(br *bufio.Reader) (string, error) {
+	s, err := br.ReadString(0)
+	if err != nil || len(s) > 256 {
+		return "", fmt.Errorf("%w: truncated header", errEXRFormat)
+	}
+	return s[:len(s)-1], nil
+}
+
+// parseEXRChannels parses a chlist attribute: for each channel a
+// null-terminated name, the pixel type, a linear flag, three reserved bytes
+// and the x and y sampling, terminated by an empty name.
+func parseEXRChannels(value []byte) ([]exrChannel, error) {
+	var channels []exrChannel
+	for {
+		end := bytes.IndexByte(value, 0)
+		if end < 0 {
+			return nil, fmt.Errorf("%w: channels attribute", errEXRFormat)
+		}
+		if end == 0 {
+			return channels, nil
+		}
+		if len(value) < end+17 {
+			return nil, fmt.Errorf("%w: channels attribute", errEXRFormat)
+		}
+		c := exrChannel{name: string(value[:end])}
+		fields := value[end+1:]
+		c.pixelType = int32(binary.LittleEndian.Uint32(fields))
+		xSampling := binary.LittleEndian.Uint32(fields[8:])
+		ySampling := binary.LittleEndian.Uint32(fields[12:])
+		if c.pixelType < exrUint || c.pixelType > exrFloat {
+			return nil, fmt.Errorf("%w: channel %q of pixel type %d", errEXRFormat, c.name, c.pixelType)
+		}
+		if xSampling != 1 || ySampling != 1 {
+			return nil, fmt.Errorf("%w: subsampled channel %q is not supported", errEXRFormat, c.name)
+		}
+		channels = append(channels, c)
+		value = fields[16:]
+	}
+}
+
+// unzipEXRChunk inflates a ZIP or ZIPS chunk into raw, which has the size of
+// the uncompressed data, and undoes the byte predictor and the split of the
+// bytes into even and odd halves applied before compression.
+func unzipEXRChunk(packed, raw []byte) error {
+	zr, err := zlib.NewReader(bytes.NewReader(packed))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errEXRFormat, err)
+	}
+	tmp := make([]byte, len(raw))
+	if _, err := io.ReadFull(zr, tmp); err != nil {
+		return fmt.Errorf("%w: %v", errEXRFormat, err)
+	}
+	// Reading to the end verifies the checksum
+	if n, err := zr.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		return fmt.Errorf("%w: chunk longer than its scanlines", errEXRFormat)
+	}
+	for i := 1; i < len(tmp); i++ {
+		tmp[i] = tmp[i-1] + tmp[i] - 128
+	}
+	half := (len(tmp) + 1) / 2
+	for i := range raw {
+		if i%2 == 0 {
+			raw[i] = tmp[i/2]
+		} else {
+			raw[i] = tmp[half+i/2]
+		}
+	}
+	return nil
+}
+
+// halfToFloat32 converts an IEEE 754 half-precision value to float32.
+func halfToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h) & 0x3ff
+	switch exp {
+	case 0:
+		// Zero or subnormal: mant * 2^-24
+		v := float32(mant) / (1 << 24)
+		if sign != 0 {
+			v = -v
+		}
+		return v
+	case 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | mant<<13) // Infinity or NaN
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
+// grow returns b resized to n bytes, reusing its storage if large enough.
+func grow(b []byte, n int) []byte {
+	if cap(b) < n {
+		return make([]byte, n)
+	}
+	return b[:n]
+}
@@ -0,0 +1,240 @@
+package imagediff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"math"
+	"testing"
+)
+
+// exrTestImage describes an OpenEXR file written by exrData
+type exrTestImage struct {
+	compression byte
+	window      image.Rectangle
+	channels    []exrChannel // Sorted by name
+	sample      func(name string, x, y int) float32
+	decreasing  bool // Chunks stored bottom to top
+}
+
+// exrAttribute appends a header attribute to b
+func exrAttribute(b []byte, name, typ string, value []byte) []byte {
+	b = append(b, name+"\x00"+typ+"\x00"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(value)))
+	return append(b, value...)
+}
+
+// float32ToHalf converts v, which must be zero or a normal half value
+func float32ToHalf(v float32) uint16 {
+	bits := math.Float32bits(v)
+	sign := uint16(bits>>16) & 0x8000
+	if bits&0x7fffffff == 0 {
+		return sign
+	}
+	return sign | uint16(int(bits>>23&0xff)-127+15)<<10 | uint16(bits>>13&0x3ff)
+}
+
+// exrData encodes img as a single-part scanline OpenEXR file
+func exrData(img exrTestImage) []byte {
+	box := func(r image.Rectangle) []byte {
+		var b []byte
+		for _, v := range []int{r.Min.X, r.Min.Y, r.Max.X - 1, r.Max.Y - 1} {
+			b = binary.LittleEndian.AppendUint32(b, uint32(int32(v)))
+		}
+		return b
+	}
+	var chlist []byte
+	for _, c := range img.channels {
+		chlist = append(chlist, c.name+"\x00"...)
+		chlist = binary.LittleEndian.AppendUint32(chlist, uint32(c.pixelType))
+		chlist = append(chlist, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0)
+	}
+	chlist = append(chlist, 0)
+
+	data := []byte("\x76\x2f\x31\x01\x02\x00\x00\x00")
+	data = exrAttribute(data, "channels", "chlist", chlist)
+	data = exrAttribute(data, "compression", "compression", []byte{img.compression})
+	data = exrAttribute(data, "dataWindow", "box2i", box(img.window))
+	data = exrAttribute(data, "displayWindow", "box2i", box(img.window))
+	data = exrAttribute(data, "lineOrder", "lineOrder", []byte{0})
+	data = exrAttribute(data, "pixelAspectRatio", "float", binary.LittleEndian.AppendUint32(nil, math.Float32bits(1)))
+	data = append(data, 0)
+
+	lines := 1
+	if img.compression == exrZIP {
+		lines = 16
+	}
+	var chunks [][]byte
+	for y := img.window.Min.Y; y < img.window.Max.Y; y += lines {
+		var raw []byte
+		for line := y; line < min(y+lines, img.window.Max.Y); line++ {
+			for _, c := range img.channels {
+				for x := img.window.Min.X; x < img.window.Max.X; x++ {
+					v := img.sample(c.name, x, line)
+					switch c.pixelType {
+					case exrHalf:
+						raw = binary.LittleEndian.AppendUint16(raw, float32ToHalf(v))
+					case exrFloat:
+						raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(v))
+					default:
+						raw = binary.LittleEndian.AppendUint32(raw, uint32(v))
+					}
+				}
+			}
+		}
+		packed := raw
+		if img.compression != exrNone {
+			// Split into even and odd bytes, then store byte deltas
+			tmp := make([]byte, len(raw))
+			half := (len(raw) + 1) / 2
+			for i, b := range raw {
+				if i%2 == 0 {
+					tmp[i/2] = b
+				} else {
+					tmp[half+i/2] = b
+				}
+			}
+			prev := tmp[0]
+			for i := 1; i < len(tmp); i++ {
+				tmp[i], prev = tmp[i]-prev+128, tmp[i]
+			}
+			var buf bytes.Buffer
+			zw := zlib.NewWriter(&buf)
+			zw.Write(tmp)
+			zw.Close()
+			if buf.Len() < len(raw) {
+				packed = buf.Bytes()
+			}
+		}
+		chunk := binary.LittleEndian.AppendUint32(nil, uint32(int32(y)))
+		chunk = binary.LittleEndian.AppendUint32(chunk, uint32(len(packed)))
+		chunks = append(chunks, append(chunk, packed...))
+	}
+	if img.decreasing {
+		for i, j := 0, len(chunks)-1; i < j; i, j = i+1, j-1 {
+			chunks[i], chunks[j] = chunks[j], chunks[i]
+		}
+	}
+
+	offset := len(data) + 8*len(chunks)
+	for _, c := range chunks {
+		data = binary.LittleEndian.AppendUint64(data, uint64(offset))
+		offset += len(c)
+	}
+	for _, c := range chunks {
+		data = append(data, c...)
+	}
+	return data
+}
+
+func TestDecodeEXR(t *testing.T) {
+	rgb := []exrChannel{{"B", exrFloat}, {"G", exrFloat}, {"R", exrFloat}}
+	gradient := func(name string, x, y int) float32 {
+		switch name {
+		case "R":
+			return float32(x) + 0.5
+		case "G":
+			return float32(y) * 4
+		case "A":
+			return 0.5
+		}
+		return -1.5
+	}
+
+	tests := []struct {
+		name string
+		img  exrTestImage
+		want map[image.Point][4]float32
+	}{
+		{
+			name: "Uncompressed Float Data Window",
+			img:  exrTestImage{compression: exrNone, window: image.Rect(2, -3, 5, 1), channels: rgb, sample: gradient},
+			want: map[image.Point][4]float32{{2, -3}: {2.5, -12, -1.5, 1}, {4, 0}: {4.5, 0, -1.5, 1}},
+		},
+		{
+			name: "ZIP Half With Alpha",
+			img: exrTestImage{compression: exrZIP, window: image.Rect(0, 0, 5, 20), sample: gradient,
+				channels: []exrChannel{{"A", exrHalf}, {"B", exrHalf}, {"G", exrHalf}, {"R", exrHalf}}},
+			want: map[image.Point][4]float32{{0, 0}: {0.5, 0, -1.5, 0.5}, {3, 17}: {3.5, 68, -1.5, 0.5}, {4, 19}: {4.5, 76, -1.5, 0.5}},
+		},
+		{
+			name: "ZIPS Luminance Decreasing",
+			img: exrTestImage{compression: exrZIPS, window: image.Rect(0, 0, 16, 3), decreasing: true,
+				channels: []exrChannel{{"Y", exrFloat}, {"Z", exrUint}},
+				sample:   func(name string, x, y int) float32 { return float32(y) + 0.25 }},
+			want: map[image.Point][4]float32{{0, 0}: {0.25, 0.25, 0.25, 1}, {15, 2}: {2.25, 2.25, 2.25, 1}},
+		},
+		{
+			name: "ZIP Incompressible Stored",
+			img:  exrTestImage{compression: exrZIP, window: image.Rect(0, 0, 1, 1), channels: rgb, sample: gradient},
+			want: map[image.Point][4]float32{{0, 0}: {0.5, 0, -1.5, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := exrData(tt.img)
+			img, format, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			f, ok := img.(*FloatImage)
+			if format != "exr" || !ok || f.Bounds() != tt.img.window {
+				t.Fatalf("%s: got format %q, %T, bounds %v", tt.name, format, img, img.Bounds())
+			}
+			for p, want := range tt.want {
+				if r, g, b, a := f.FloatAt(p.X, p.Y); [4]float32{r, g, b, a} != want {
+					t.Errorf("%s: pixel %v got %v, want %v", tt.name, p, [4]float32{r, g, b, a}, want)
+				}
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil || cfg.Width != tt.img.window.Dx() || cfg.Height != tt.img.window.Dy() {
+				t.Errorf("%s: DecodeConfig got %+v, %v", tt.name, cfg, err)
+			}
+		})
+	}
+
+	valid := exrTestImage{compression: exrZIPS, window: image.Rect(0, 0, 16, 2), channels: rgb, sample: gradient}
+	corrupt := func(fn func(img *exrTestImage, data []byte) []byte) []byte {
+		img := valid
+		return fn(&img, exrData(img))
+	}
+	for name, data := range map[string][]byte{
+		"Version": corrupt(func(_ *exrTestImage, d []byte) []byte { d[4] = 1; return d }),
+		"Tiled":   corrupt(func(_ *exrTestImage, d []byte) []byte { d[5] = 0x02; return d }),
+		"PIZ":     corrupt(func(img *exrTestImage, _ []byte) []byte { img.compression = 4; return exrData(*img) }),
+		"No Color": corrupt(func(img *exrTestImage, _ []byte) []byte {
+			img.channels = []exrChannel{{"Z", exrFloat}}
+			return exrData(*img)
+		}),
+		"Truncated":    corrupt(func(_ *exrTestImage, d []byte) []byte { return d[:len(d)-3] }),
+		"Corrupt Data": corrupt(func(_ *exrTestImage, d []byte) []byte { d[len(d)-1] ^= 0xff; return d }),
+		"No Header":    []byte("\x76\x2f\x31\x01\x02\x00\x00\x00\x00"),
+		"Not An EXR":   []byte("P6 1 1 255\n\x00\x00\x00"),
+	} {
+		if _, err := DecodeEXR(bytes.NewReader(data)); !errors.Is(err, errEXRFormat) {
+			t.Errorf("%s: got %v, want %v", name, err, errEXRFormat)
+		}
+	}
+}
+
+func TestHalfToFloat32(t *testing.T) {
+	for h, want := range map[uint16]float32{
+		0x0000: 0,
+		0x3c00: 1,
+		0xc000: -2,
+		0x3555: 0.333251953125,
+		0x7bff: 65504,
+		0x0001: 1.0 / (1 << 24), // Smallest subnormal
+		0x7c00: float32(math.Inf(1)),
+	} {
+		if got := halfToFloat32(h); got != want {
+			t.Errorf("halfToFloat32(%#04x): got %v, want %v", h, got, want)
+		}
+	}
+	if got := halfToFloat32(0x7e00); !math.IsNaN(float64(got)) {
+		t.Errorf("halfToFloat32(0x7e00): got %v, want NaN", got)
+	}
+}
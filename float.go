@@ -0,0 +1,187 @@
+package imagediff
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+)
+
+// ToneMap selects how the linear values of a FloatImage are mapped to the
+// displayable range [0, 1] once scaled by the exposure.
+type ToneMap string
+
+const (
+	ToneMapClamp    ToneMap = "clamp"    // Values above 1 saturate
+	ToneMapReinhard ToneMap = "reinhard" // v / (1 + v): highlights compressed, never saturating
+	ToneMapACES     ToneMap = "aces"     // Filmic curve fitted to the ACES reference rendering transform
+)
+
+// ParseToneMap converts a -tonemap flag value to a ToneMap.
+func ParseToneMap(s string) (ToneMap, error) {
+	switch tm := ToneMap(s); tm {
+	case ToneMapClamp, ToneMapReinhard, ToneMapACES:
+		return tm, nil
+	}
+	return "", fmt.Errorf("invalid tone map %q", s)
+}
+
+// apply maps a linear value to [0, 1].
+func (tm ToneMap) apply(v float64) float64 {
+	switch tm {
+	case ToneMapReinhard:
+		v = max(v, 0)
+		v /= 1 + v
+	case ToneMapACES:
+		// Krzysztof Narkowicz's fit
+		v = max(v, 0)
+		v = v * (2.51*v + 0.03) / (v*(2.43*v+0.59) + 0.14)
+	}
+	return min(max(v, 0), 1)
+}
+
+// FloatImage is an in-memory image of linear float32 RGBA values with
+// premultiplied alpha, as decoded from PFM, Radiance HDR and OpenEXR files.
+// Values are not limited to [0, 1].
+//
+// Compare compares two FloatImages in float. As an image.Image, a FloatImage
+// returns its values clamped to [0, 1] and encoded as sRGB.
+type FloatImage struct {
+	// Pix holds the R, G, B and A values of each pixel, starting at the top-left.
+	Pix []float32
+	// Stride is the Pix stride (in float32 values) between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+}
+
+// NewFloatImage returns a new FloatImage with the given bounds, transparent
+// black.
+func NewFloatImage(r image.Rectangle) *FloatImage {
+	return &FloatImage{Pix: make([]float32, 4*r.Dx()*r.Dy()), Stride: 4 * r.Dx(), Rect: r}
+}
+
+func (p *FloatImage) ColorModel() color.Model { return color.RGBA64Model }
+
+func (p *FloatImage) Bounds() image.Rectangle { return p.Rect }
+
+func (p *FloatImage) At(x, y int) color.Color {
+	return p.toneMapAt(x, y, 1, ToneMapClamp)
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the pixel at (x, y).
+func (p *FloatImage) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
+}
+
+// FloatAt returns the linear values of the pixel at (x, y), zero outside the
+// bounds.
+func (p *FloatImage) FloatAt(x, y int) (r, g, b, a float32) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return 0, 0, 0, 0
+	}
+	s := p.Pix[p.PixOffset(x, y):][:4]
+	return s[0], s[1], s[2], s[3]
+}
+
+// SetFloat sets the linear values of the pixel at (x, y).
+func (p *FloatImage) SetFloat(x, y int, r, g, b, a float32) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	s := p.Pix[p.PixOffset(x, y):][:4]
+	s[0], s[1], s[2], s[3] = r, g, b, a
+}
+
+// SubImage returns an image representing the portion of p visible through r.
+// The returned value shares pixels with p.
+func (p *FloatImage) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		return &FloatImage{}
+	}
+	return &FloatImage{Pix: p.Pix[p.PixOffset(r.Min.X, r.Min.Y):], Stride: p.Stride, Rect: r}
+}
+
+// ToneMapped returns p scaled by 2^exposure, mapped to [0, 1] by tm and
+// encoded as sRGB with 16 bits per channel.
+func (p *FloatImage) ToneMapped(exposure float64, tm ToneMap) *image.RGBA64 {
+	out := image.NewRGBA64(p.Rect)
+	gain := math.Exp2(exposure)
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		for x := p.Rect.Min.X; x < p.Rect.Max.X; x++ {
+			out.SetRGBA64(x, y, p.toneMapAt(x, y, gain, tm))
+		}
+	}
+	return out
+}
+
+// toneMapAt returns the display color of the pixel at (x, y). The color
+// channels are tone mapped and encoded without the alpha premultiplication,
+// which is reapplied afterwards.
+func (p *FloatImage) toneMapAt(x, y int, gain float64, tm ToneMap) color.RGBA64 {
+	r, g, b, a := p.FloatAt(x, y)
+	alpha := min(max(float64(a), 0), 1)
+	if alpha == 0 {
+		return color.RGBA64{}
+	}
+	to16 := func(v float32) uint16 {
+		return uint16(math.Round(linearToSRGB(tm.apply(float64(v)*gain/alpha)) * alpha * 0xffff))
+	}
+	return color.RGBA64{to16(r), to16(g), to16(b), uint16(math.Round(alpha * 0xffff))}
+}
+
+// linearToSRGB applies the sRGB transfer function to v in [0, 1].
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// ToneMapped returns img as displayed: a *FloatImage tone mapped with
+// Options.Exposure and Options.ToneMap, and any other image unchanged.
+// Composite and BlinkFrames show the compared images this way.
+func (r *Result) ToneMapped(img image.Image) image.Image {
+	return toneMapped(img, r.Options)
+}
+
+func toneMapped(img image.Image, opts Options) image.Image {
+	if f, ok := img.(*FloatImage); ok {
+		return f.ToneMapped(opts.Exposure, opts.ToneMap)
+	}
+	return img
+}
+
+// matchFloatInputs returns left and right unchanged if both are FloatImages
+// that can be compared in float, or otherwise with any FloatImage tone mapped,
+// so that a float rendering can be compared with its 8-bit or 16-bit export.
+// SizePolicyPad and SizePolicyScale resample into 16-bit images, so images of
+// different sizes are tone mapped first under those policies.
+func matchFloatInputs(left, right image.Image, opts Options) (image.Image, image.Image) {
+	_, float1 := left.(*FloatImage)
+	_, float2 := right.(*FloatImage)
+	resized := !opts.Align && left.Bounds().Size() != right.Bounds().Size() &&
+		(opts.SizePolicy == SizePolicyPad || opts.SizePolicy == SizePolicyScale)
+	if float1 && float2 && !resized {
+		return left, right
+	}
+	if (float1 || float2) && opts.Verbose {
+		log.Printf("Tone mapping float images with exposure %g and %s", opts.Exposure, opts.ToneMap)
+	}
+	return toneMapped(left, opts), toneMapped(right, opts)
+}
+
+// levels returns the channel values of the pixel of img at (x, y) in 8-bit
+// units. Those of a *FloatImage are its linear values times 255, not clamped.
+func levels(img image.Image, x, y int) (r, g, b, a float64) {
+	if f, ok := img.(*FloatImage); ok {
+		fr, fg, fb, fa := f.FloatAt(x, y)
+		return float64(fr) * 255, float64(fg) * 255, float64(fb) * 255, float64(fa) * 255
+	}
+	r16, g16, b16, a16 := img.At(x, y).RGBA()
+	// Inverse of 8-bit to 16-bit conversion: (2^16 - 1) / (2^8 - 1) = 65535 / 255 ≈ 257
+	return float64(r16) / 257, float64(g16) / 257, float64(b16) / 257, float64(a16) / 257
+}
@@ -0,0 +1,190 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// newTestFloatImage returns a width x height opaque FloatImage of value v
+func newTestFloatImage(width, height int, v float32) *FloatImage {
+	img := NewFloatImage(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetFloat(x, y, v, v, v, 1)
+		}
+	}
+	return img
+}
+
+func TestParseToneMap(t *testing.T) {
+	for _, s := range []string{"clamp", "reinhard", "aces"} {
+		if got, err := ParseToneMap(s); err != nil || string(got) != s {
+			t.Errorf("ParseToneMap(%q): got %q, %v", s, got, err)
+		}
+	}
+	if _, err := ParseToneMap("filmic"); err == nil {
+		t.Errorf("ParseToneMap(%q): got no error", "filmic")
+	}
+}
+
+func TestFloatImage(t *testing.T) {
+	img := NewFloatImage(image.Rect(-1, -1, 2, 1))
+	img.SetFloat(0, 0, 0.5, 1, 4, 1)
+	img.SetFloat(1, 0, 0.25, 0.25, 0.25, 0.5) // Premultiplied
+	img.SetFloat(5, 5, 1, 1, 1, 1)            // Outside, ignored
+
+	if got, want := img.At(0, 0), (color.RGBA64{48192, 0xffff, 0xffff, 0xffff}); got != want {
+		t.Errorf("At: got %v, want %v", got, want)
+	}
+	if got, want := img.At(1, 0), (color.RGBA64{24096, 24096, 24096, 0x8000}); got != want {
+		t.Errorf("At with alpha: got %v, want %v", got, want)
+	}
+	if got := img.At(-1, -1); got != (color.RGBA64{}) {
+		t.Errorf("At transparent: got %v", got)
+	}
+
+	pix := NewFloatImage(image.Rect(0, 0, 1, 1))
+	pix.SetFloat(0, 0, 0.5, 1, 4, 1)
+	tests := []struct {
+		exposure float64
+		tm       ToneMap
+		want     color.RGBA64
+	}{
+		{0, ToneMapClamp, color.RGBA64{48192, 0xffff, 0xffff, 0xffff}},
+		{-1, ToneMapClamp, color.RGBA64{35199, 48192, 0xffff, 0xffff}},
+		{0, ToneMapReinhard, color.RGBA64{40140, 48192, 59396, 0xffff}},
+		{0, ToneMapACES, color.RGBA64{52908, 59521, 64763, 0xffff}},
+	}
+	for _, tt := range tests {
+		if got := pix.ToneMapped(tt.exposure, tt.tm).RGBA64At(0, 0); got != tt.want {
+			t.Errorf("ToneMapped(%v, %s): got %v, want %v", tt.exposure, tt.tm, got, tt.want)
+		}
+	}
+
+	sub := img.SubImage(image.Rect(0, 0, 5, 5)).(*FloatImage)
+	if sub.Bounds() != image.Rect(0, 0, 2, 1) {
+		t.Errorf("SubImage bounds: got %v", sub.Bounds())
+	}
+	sub.SetFloat(0, 0, 3, 3, 3, 1)
+	if r, _, _, _ := img.FloatAt(0, 0); r != 3 {
+		t.Errorf("SubImage does not share pixels: got %v", r)
+	}
+}
+
+func TestCompareFloat(t *testing.T) {
+	// withPixel returns a 4x4 float image of value v with the pixel at (1, 1) set to p
+	withPixel := func(v, p float32) *FloatImage {
+		img := newTestFloatImage(4, 4, v)
+		img.SetFloat(1, 1, p, v, v, 1)
+		return img
+	}
+
+	tests := []struct {
+		name      string
+		left      image.Image
+		right     image.Image
+		opts      Options
+		diffCount int64
+		subStep   int64
+		maxErrorR float64
+		float     bool // Compared in float
+	}{
+		{
+			name:      "Values Above One",
+			left:      newTestFloatImage(4, 4, 2),
+			right:     withPixel(2, 2.5),
+			diffCount: 1,
+			maxErrorR: 127.5,
+			float:     true,
+		},
+		{
+			name:      "Below One 8-bit Step",
+			left:      newTestFloatImage(4, 4, 0.5),
+			right:     withPixel(0.5, 0.502),
+			diffCount: 1,
+			subStep:   1,
+			maxErrorR: 0.51,
+			float:     true,
+		},
+		{
+			name:      "NaN Differs",
+			left:      newTestFloatImage(4, 4, 1),
+			right:     withPixel(1, float32(math.NaN())),
+			diffCount: 1,
+			maxErrorR: math.Inf(1),
+			float:     true,
+		},
+		{
+			name:  "Integer Image Compared Tone Mapped",
+			left:  newTestFloatImage(4, 4, 1),
+			right: createTestImage(4, 4, color.White),
+		},
+		{
+			name:      "Exposure Applied To Mixed Inputs",
+			left:      newTestFloatImage(4, 4, 1),
+			right:     createTestImage(4, 4, color.White),
+			opts:      Options{Exposure: -1},
+			diffCount: 16,
+			maxErrorR: 255 - 48192.0/257,
+		},
+		{
+			name:      "Intersect Keeps Float",
+			left:      newTestFloatImage(4, 4, 2),
+			right:     newTestFloatImage(4, 3, 2.5),
+			opts:      Options{SizePolicy: SizePolicyIntersect},
+			diffCount: 16,
+			maxErrorR: 127.5,
+			float:     true,
+		},
+		{
+			name:      "Pad Tone Maps",
+			left:      newTestFloatImage(4, 4, 2),
+			right:     newTestFloatImage(4, 3, 2.5),
+			opts:      Options{SizePolicy: SizePolicyPad},
+			diffCount: 4, // Transparent padding
+			maxErrorR: 255,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Compare(tt.left, tt.right, tt.opts)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			if result.DiffCount != tt.diffCount || result.SubStepCount != tt.subStep {
+				t.Errorf("%s: DiffCount %d, SubStepCount %d, want %d, %d", tt.name, result.DiffCount, result.SubStepCount, tt.diffCount, tt.subStep)
+			}
+			if result.MaxError.R != tt.maxErrorR && !approxEqual(result.MaxError.R, tt.maxErrorR, 1e-3) {
+				t.Errorf("%s: MaxError.R got %v, want %v", tt.name, result.MaxError.R, tt.maxErrorR)
+			}
+			if _, ok := result.Left.(*FloatImage); ok != tt.float {
+				t.Errorf("%s: compared in float %v, want %v", tt.name, ok, tt.float)
+			}
+		})
+	}
+
+	// Relative errors of linear values above one
+	result, err := Compare(newTestFloatImage(1, 1, 4), newTestFloatImage(1, 1, 5), Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := 1 / 4.01; !approxEqual(result.Metrics.Relative.MaxRelError, want, 1e-6) || !approxEqual(result.Metrics.Relative.MeanRelError, want, 1e-6) {
+		t.Errorf("Relative got %+v, want %v", result.Metrics.Relative, want)
+	}
+
+	// The composite shows the inputs with the exposure applied
+	result, err = Compare(newTestFloatImage(2, 2, 0.25), newTestFloatImage(2, 2, 0.25), Options{Exposure: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := color.RGBA{188, 188, 188, 255} // sRGB of 0.5
+	if got := color.RGBAModel.Convert(result.Composite().At(0, 0)); got != want {
+		t.Errorf("Composite: got %v, want %v", got, want)
+	}
+	if _, err := Compare(newTestFloatImage(1, 1, 0), newTestFloatImage(1, 1, 0), Options{ToneMap: "filmic"}); err == nil {
+		t.Error("invalid tone map: got no error")
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/erdichen/imagediff
 
 go 1.24.0
+
+require golang.org/x/image v0.25.0
@@ -1,60 +1,276 @@
-package main
+// Package imagediff computes and visualizes the pixel-wise difference between
+// two images.
+package imagediff
 
 import (
-	"flag"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
-	"image/png"
 	"iter"
 	"log"
 	"math"
-	"os"
-	"os/exec"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
-	"sync/atomic"
 )
 
-// Global flag pointer variables
-var (
-	leftPtr            = flag.String("left", "", "Left input image file (required)")
-	rightPtr           = flag.String("right", "", "Right input image file (required)")
-	outputPtr          = flag.String("output", "", "Output image file (default: temporary file)")
-	waitPtr            = flag.Bool("wait", false, "Wait for image viewer to close before exiting")
-	viewerPtr          = flag.String("viewer", "", "Custom image viewer command (overrides default)")
-	includeInputsPtr   = flag.Bool("include-inputs", false, "Include input images in output (left and right of diff)")
-	normalizedPtr      = flag.Bool("normalized", false, "Use normalized difference (adjusts for brightness/contrast)")
-	scalePtr           = flag.Float64("scale", 2.0, "Scale factor for amplifying differences in non-normalized mode (default: 2.0)")
-	normalizedScalePtr = flag.Float64("normalized-scale", 50.0, "Scale factor for amplifying differences in normalized mode (default: 50.0)")
-	diffModePtr        = flag.String("diff-mode", "color", "Difference mode: 'bw' (black-and-white), 'gray' (grayscale), 'color' (default)")
-	verbosePtr         = flag.Bool("verbose", false, "Enable verbose logging")
-	gitConfigPtr       = flag.String("git-config", "", "Configure imagediff as git difftool: 'enable' or 'disable'")
+// DiffMode selects how differences are rendered in the difference image.
+type DiffMode string
+
+const (
+	DiffModeBW      DiffMode = "bw"      // Black-and-white: any difference becomes white
+	DiffModeGray    DiffMode = "gray"    // Grayscale: average of the channel differences
+	DiffModeColor   DiffMode = "color"   // Color: per-channel RGB difference
+	DiffModeSSIM    DiffMode = "ssim"    // SSIM map: local structural dissimilarity
+	DiffModeDeltaE  DiffMode = "deltae"  // Heatmap of the CIEDE2000 perceptual color difference
+	DiffModeOverlay DiffMode = "overlay" // Differences highlighted over a faded copy of the left image
+	DiffModeHeatmap DiffMode = "heatmap" // Average of the channel differences through Options.Colormap
 )
 
+// ToleranceMetric selects how channel differences are compared against
+// Options.Tolerance.
+type ToleranceMetric string
+
+const (
+	ToleranceChannel   ToleranceMetric = "channel"   // Largest single channel difference
+	ToleranceEuclidean ToleranceMetric = "euclidean" // Euclidean distance over R, G, B and A
+)
+
+const (
+	DefaultScale           = 2.0  // Default scale factor in non-normalized mode
+	DefaultNormalizedScale = 50.0 // Default scale factor in normalized mode
+)
+
+// ErrSizeMismatch is returned by Compare when the input images have different
+// dimensions and Options.SizePolicy is SizePolicyError.
+var ErrSizeMismatch = errors.New("images must have the same dimensions")
+
+// Options configures Compare. The zero value is a non-normalized color diff
+// with the default scale factor.
+type Options struct {
+	// Normalized adjusts for brightness/contrast by comparing pixels after
+	// normalizing each image with its per-channel mean and standard deviation.
+	Normalized bool
+	// Scale amplifies differences in the difference image. Zero selects
+	// DefaultScale, or DefaultNormalizedScale when Normalized is set.
+	Scale float64
+	// DiffMode selects how differences are rendered. Empty selects DiffModeColor.
+	DiffMode DiffMode
+	// Tolerance is the largest difference, in 8-bit units (standard deviations
+	// when Normalized), for which a pixel still counts as equal. It governs
+	// DiffCount, DiffBounds and the bw output.
+	Tolerance float64
+	// ToleranceMetric selects how Tolerance is applied. Empty selects
+	// ToleranceChannel.
+	ToleranceMetric ToleranceMetric
+	// SizePolicy selects how images of different dimensions are compared.
+	// Empty selects SizePolicyError.
+	SizePolicy SizePolicy
+	// PadColor fills the padding added by SizePolicyPad. Nil selects
+	// transparent black.
+	PadColor color.Color
+	// HighlightColor paints differing pixels in DiffModeOverlay. Nil selects
+	// DefaultHighlightColor.
+	HighlightColor color.Color
+	// Colormap colors DiffModeHeatmap. Empty selects ColormapViridis.
+	Colormap Colormap
+	// Deep renders the difference image and the composite with 16 bits per
+	// channel (*image.RGBA64), so that differences below one 8-bit step stay
+	// visible once amplified by Scale. Pixels are always compared at the full
+	// precision of the inputs.
+	Deep bool
+	// Exposure scales the values of FloatImage inputs by 2^Exposure before
+	// ToneMap maps them to the displayable range, in Composite, BlinkFrames
+	// and whenever a FloatImage is compared with an integer image.
+	Exposure float64
+	// ToneMap maps the values of FloatImage inputs for display. Empty selects
+	// ToneMapClamp.
+	ToneMap ToneMap
+	// Align estimates the translation between left and right and compares
+	// only their aligned overlap; SizePolicy is not applied. The estimate is
+	// reported in Result.Offset.
+	Align bool
+	// MaxShift bounds the alignment search in pixels along each axis. Zero
+	// selects DefaultMaxShift.
+	MaxShift int
+	// DeltaEThreshold is the CIEDE2000 difference above which a pixel counts
+	// as differing in DiffModeDeltaE, replacing Tolerance. Zero selects
+	// DefaultDeltaEThreshold.
+	DeltaEThreshold float64
+	// DetectAntiAliasing classifies differing pixels that look like
+	// anti-aliased edges separately: they are counted in
+	// Result.AntiAliased instead of DiffCount and drawn in AntiAliasColor.
+	DetectAntiAliasing bool
+	// Ignore lists rectangles, in the coordinate space of the left image,
+	// whose pixels are excluded from the comparison.
+	Ignore []image.Rectangle
+	// Mask excludes the pixels under its light, opaque pixels from the
+	// comparison. Its origin is aligned with the origin of the left image.
+	Mask image.Image
+	// Clusters groups differing pixels into 8-connected clusters reported in
+	// Result.Clusters.
+	Clusters bool
+	// DrawClusters outlines each cluster in ClusterColor on the difference
+	// image and the composite. It implies Clusters.
+	DrawClusters bool
+	// Regions restricts the comparison to the listed rectangles, together
+	// with RegionMask if set, and reports statistics for each in
+	// Result.Regions. Pixels outside are ignored.
+	Regions []Region
+	// RegionMask restricts the comparison to the pixels under its light,
+	// opaque pixels, together with Regions if set. Its origin is aligned
+	// with the origin of the left image.
+	RegionMask image.Image
+	// SSIM computes Result.SSIM and Result.MSSSIM. It is implied by DiffModeSSIM.
+	SSIM bool
+	// Verbose enables progress logging through the standard log package.
+	Verbose bool
+
+	ignoreMask *image.Alpha // Built by Compare from Ignore, Mask, Regions and RegionMask
+}
+
+// Result holds the outcome of Compare.
+type Result struct {
+	Image        draw.Image      // Difference image, in the coordinate space of Left
+	Left         image.Image     // Left image as compared, after applying SizePolicy
+	Right        image.Image     // Right image as compared, after applying SizePolicy
+	Options      Options         // Options used, with defaults applied
+	Offset       image.Point     // Translation of Right relative to Left found by Options.Align
+	NonZeroLeft  int64           // Number of non-zero pixels in the left image
+	NonZeroRight int64           // Number of non-zero pixels in the right image
+	LeftStats    ImageStats      // Channel statistics of the left image, set when Normalized
+	RightStats   ImageStats      // Channel statistics of the right image, set when Normalized
+	DiffCount    int64           // Number of differing pixels
+	SubStepCount int64           // Differing pixels whose raw channel differences are all below one 8-bit step
+	AntiAliased  int64           // Number of anti-aliased pixels excluded from DiffCount
+	Ignored      int64           // Number of pixels excluded by Options.Ignore, Mask, Regions and RegionMask
+	IgnoreMask   *image.Alpha    // Opaque where pixels were ignored, nil if none
+	DiffPercent  float64         // DiffCount as a percentage of the compared pixels
+	MaxError     ChannelError    // Largest per-channel difference
+	MeanError    ChannelError    // Mean per-channel difference over the compared pixels
+	DiffBounds   image.Rectangle // Bounding box of differing pixels, empty if none
+	Metrics      Metrics         // MSE, RMSE, PSNR, MAE and relative errors of the raw pixel values
+	MaxDeltaE    float64         // Largest CIEDE2000 difference, set in DiffModeDeltaE
+	MeanDeltaE   float64         // Mean CIEDE2000 difference, set in DiffModeDeltaE
+	SSIM         float64         // Mean structural similarity, set with Options.SSIM
+	MSSSIM       float64         // Multi-scale structural similarity, set with Options.SSIM
+	Regions      []RegionResult  // Statistics of each of Options.Regions, in order
+	Clusters     []Cluster       // Clusters of differing pixels, largest first, set with Options.Clusters
+}
+
+// ChannelError holds a per-channel difference in 8-bit units, or in standard
+// deviations when comparing normalized images.
+type ChannelError struct {
+	R, G, B, A float64
+}
+
+func (e ChannelError) add(o ChannelError) ChannelError {
+	return ChannelError{e.R + o.R, e.G + o.G, e.B + o.B, e.A + o.A}
+}
+
+// Threshold bounds the amount of difference tolerated between two images,
+// either as an absolute number of differing pixels or as a percentage.
+type Threshold struct {
+	Count     int64   // Maximum number of differing pixels
+	Percent   float64 // Maximum percentage of differing pixels, used when IsPercent is set
+	IsPercent bool
+}
+
+// ParseThreshold parses a pixel count ("100") or a percentage ("0.5%").
+func ParseThreshold(s string) (Threshold, error) {
+	s = strings.TrimSpace(s)
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		percent, err := strconv.ParseFloat(p, 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return Threshold{}, fmt.Errorf("invalid threshold percentage %q", s)
+		}
+		return Threshold{Percent: percent, IsPercent: true}, nil
+	}
+	count, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || count < 0 {
+		return Threshold{}, fmt.Errorf("invalid threshold %q", s)
+	}
+	return Threshold{Count: count}, nil
+}
+
+func (t Threshold) String() string {
+	if t.IsPercent {
+		return strconv.FormatFloat(t.Percent, 'f', -1, 64) + "%"
+	}
+	return strconv.FormatInt(t.Count, 10)
+}
+
+// Exceeds reports whether the difference in r is beyond t.
+func (r *Result) Exceeds(t Threshold) bool {
+	if t.IsPercent {
+		return r.DiffPercent > t.Percent
+	}
+	return r.DiffCount > t.Count
+}
+
+// chunkStats accumulates the statistics of a single chunk.
+type chunkStats struct {
+	count1, count2, diffCount int64
+	antiAliased, ignored      int64
+	subStep                   int64
+	sumErr, maxErr            ChannelError
+	sumAbs, sumSq             ChannelError // Raw 8-bit errors for Metrics
+	sumRel, sumRelSq, maxRel  float64      // Relative errors of the color channels for Metrics
+	sumDeltaE, maxDeltaE      float64
+	diffBounds                image.Rectangle
+}
+
+func (s *chunkStats) merge(o chunkStats) {
+	s.count1 += o.count1
+	s.count2 += o.count2
+	s.diffCount += o.diffCount
+	s.antiAliased += o.antiAliased
+	s.ignored += o.ignored
+	s.subStep += o.subStep
+	s.sumErr = s.sumErr.add(o.sumErr)
+	s.sumAbs = s.sumAbs.add(o.sumAbs)
+	s.sumSq = s.sumSq.add(o.sumSq)
+	s.sumRel += o.sumRel
+	s.sumRelSq += o.sumRelSq
+	s.maxRel = max(s.maxRel, o.maxRel)
+	s.maxErr.R = max(s.maxErr.R, o.maxErr.R)
+	s.maxErr.G = max(s.maxErr.G, o.maxErr.G)
+	s.maxErr.B = max(s.maxErr.B, o.maxErr.B)
+	s.maxErr.A = max(s.maxErr.A, o.maxErr.A)
+	s.sumDeltaE += o.sumDeltaE
+	s.maxDeltaE = max(s.maxDeltaE, o.maxDeltaE)
+	s.diffBounds = s.diffBounds.Union(o.diffBounds)
+}
+
+// ImageStats holds per-channel statistics in 8-bit units.
 type ImageStats struct {
-	meanR, meanG, meanB, meanA float64
-	stdR, stdG, stdB, stdA     float64
+	MeanR, MeanG, MeanB, MeanA float64
+	StdR, StdG, StdB, StdA     float64
 }
 
+// Chunk is a rectangular region of the image processed by a single goroutine.
 type Chunk struct {
 	startX, endX int
 	startY, endY int
 }
 
-func calculateImageStats(img image.Image) ImageStats {
+// CalculateImageStats returns the per-channel mean and standard deviation of
+// img in 8-bit units. The values of a *FloatImage are scaled by 255.
+func CalculateImageStats(img image.Image) ImageStats {
 	bounds := img.Bounds()
 	var sumR, sumG, sumB, sumA float64
 	count := float64(bounds.Dx() * bounds.Dy())
 
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, a := img.At(x, y).RGBA()
-			sumR += float64(r) / 257
-			sumG += float64(g) / 257
-			sumB += float64(b) / 257
-			sumA += float64(a) / 257
+			r, g, b, a := levels(img, x, y)
+			sumR += r
+			sumG += g
+			sumB += b
+			sumA += a
 		}
 	}
 
@@ -66,11 +282,7 @@ func calculateImageStats(img image.Image) ImageStats {
 	var sumSqDiffR, sumSqDiffG, sumSqDiffB, sumSqDiffA float64
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, a := img.At(x, y).RGBA()
-			r8 := float64(r) / 257
-			g8 := float64(g) / 257
-			b8 := float64(b) / 257
-			a8 := float64(a) / 257
+			r8, g8, b8, a8 := levels(img, x, y)
 
 			sumSqDiffR += (r8 - meanR) * (r8 - meanR)
 			sumSqDiffG += (g8 - meanG) * (g8 - meanG)
@@ -80,14 +292,14 @@ func calculateImageStats(img image.Image) ImageStats {
 	}
 
 	return ImageStats{
-		meanR: meanR,
-		meanG: meanG,
-		meanB: meanB,
-		meanA: meanA,
-		stdR:  math.Sqrt(sumSqDiffR / count),
-		stdG:  math.Sqrt(sumSqDiffG / count),
-		stdB:  math.Sqrt(sumSqDiffB / count),
-		stdA:  math.Sqrt(sumSqDiffA / count),
+		MeanR: meanR,
+		MeanG: meanG,
+		MeanB: meanB,
+		MeanA: meanA,
+		StdR:  math.Sqrt(sumSqDiffR / count),
+		StdG:  math.Sqrt(sumSqDiffG / count),
+		StdB:  math.Sqrt(sumSqDiffB / count),
+		StdA:  math.Sqrt(sumSqDiffA / count),
 	}
 }
 
@@ -98,99 +310,213 @@ func normalizePixel(value float64, mean float64, std float64) float64 {
 	return (value - mean) / std
 }
 
-func computeDiffChunk(img1, img2 image.Image, diffImg *image.RGBA, chunk Chunk, stats1, stats2 ImageStats, normalized bool, scaleFactor float64, diffMode string, verbose bool) (int64, int64, int64) {
-	if verbose {
+// computeDiffChunk compares the pixels of chunk and renders them into diffImg,
+// which may be nil to collect statistics only. Differing pixels are marked
+// opaque in diffMask if it is not nil.
+func computeDiffChunk(img1, img2 image.Image, diffImg draw.Image, diffMask *image.Alpha, chunk Chunk, stats1, stats2 ImageStats, opts Options) chunkStats {
+	if opts.Verbose {
 		log.Printf("Processing chunk: startX=%d, endX=%d, startY=%d, endY=%d", chunk.startX, chunk.endX, chunk.startY, chunk.endY)
 	}
 
-	var count1, count2, diffCount int64
+	var cs chunkStats
+	scaleFactor := opts.Scale
+	var highlight color.NRGBA
+	if opts.DiffMode == DiffModeOverlay {
+		highlight = color.NRGBAModel.Convert(opts.HighlightColor).(color.NRGBA)
+	}
+
+	// Images are compared by their position relative to their own bounds,
+	// so chunk coordinates in img1 map to img2 by a constant offset
+	min1, min2 := img1.Bounds().Min, img2.Bounds().Min
+	offset := min2.Sub(min1)
+	_, linear := img1.(*FloatImage)
 
 	// Calculate difference
 	for y := chunk.startY; y < chunk.endY; y++ {
 		for x := chunk.startX; x < chunk.endX; x++ {
+			// Ignored pixels are hatched once the diff pass is done
+			if ignored(opts.ignoreMask, x, y) {
+				cs.ignored++
+				continue
+			}
+
 			// Get colors from both images
-			r1, g1, b1, a1 := img1.At(x, y).RGBA()
-			r2, g2, b2, a2 := img2.At(x, y).RGBA()
-
-			// Inverse of 8-bit to 16-bit conversion: (2^16 - 1) / (2^8 - 1) = 65535 / 255 ≈ 257
-			r1f := float64(r1) / 257 // RGBA returns 16-bit values
-			g1f := float64(g1) / 257
-			b1f := float64(b1) / 257
-			a1f := float64(a1) / 257
-			r2f := float64(r2) / 257
-			g2f := float64(g2) / 257
-			b2f := float64(b2) / 257
-			a2f := float64(a2) / 257
-
-			if (r1 + g1 + b1 + a1) > 0 {
-				count1++
+			r1f, g1f, b1f, a1f := levels(img1, x, y)
+			r2f, g2f, b2f, a2f := levels(img2, x+offset.X, y+offset.Y)
+
+			if r1f != 0 || g1f != 0 || b1f != 0 || a1f != 0 {
+				cs.count1++
 			}
-			if (r2 + g2 + b2 + a2) > 0 {
-				count2++
+			if r2f != 0 || g2f != 0 || b2f != 0 || a2f != 0 {
+				cs.count2++
+			}
+
+			rRaw, gRaw, bRaw, aRaw := absDiff(r1f, r2f), absDiff(g1f, g2f), absDiff(b1f, b2f), absDiff(a1f, a2f)
+			cs.sumAbs = cs.sumAbs.add(ChannelError{rRaw, gRaw, bRaw, aRaw})
+			cs.sumSq = cs.sumSq.add(ChannelError{rRaw * rRaw, gRaw * gRaw, bRaw * bRaw, aRaw * aRaw})
+			for _, c := range [][2]float64{{r1f, rRaw}, {g1f, gRaw}, {b1f, bRaw}} {
+				ref, diff := c[0]/255, c[1]/255
+				rel := diff / (math.Abs(ref) + relativeEpsilon)
+				cs.sumRel += rel
+				cs.sumRelSq += diff * diff / (ref*ref + relativeEpsilon)
+				cs.maxRel = max(cs.maxRel, rel)
 			}
 
 			var rDiff, gDiff, bDiff, aDiff float64
-			if normalized {
-				normR1 := normalizePixel(r1f, stats1.meanR, stats1.stdR)
-				normG1 := normalizePixel(g1f, stats1.meanG, stats1.stdG)
-				normB1 := normalizePixel(b1f, stats1.meanB, stats1.stdB)
-				normA1 := normalizePixel(a1f, stats1.meanA, stats1.stdA)
-				normR2 := normalizePixel(r2f, stats2.meanR, stats2.stdR)
-				normG2 := normalizePixel(g2f, stats2.meanG, stats2.stdG)
-				normB2 := normalizePixel(b2f, stats2.meanB, stats2.stdB)
-				normA2 := normalizePixel(a2f, stats2.meanA, stats2.stdA)
+			if opts.Normalized {
+				normR1 := normalizePixel(r1f, stats1.MeanR, stats1.StdR)
+				normG1 := normalizePixel(g1f, stats1.MeanG, stats1.StdG)
+				normB1 := normalizePixel(b1f, stats1.MeanB, stats1.StdB)
+				normA1 := normalizePixel(a1f, stats1.MeanA, stats1.StdA)
+				normR2 := normalizePixel(r2f, stats2.MeanR, stats2.StdR)
+				normG2 := normalizePixel(g2f, stats2.MeanG, stats2.StdG)
+				normB2 := normalizePixel(b2f, stats2.MeanB, stats2.StdB)
+				normA2 := normalizePixel(a2f, stats2.MeanA, stats2.StdA)
 
 				rDiff = math.Abs(normR1 - normR2)
 				gDiff = math.Abs(normG1 - normG2)
 				bDiff = math.Abs(normB1 - normB2)
 				aDiff = math.Abs(normA1 - normA2)
 			} else {
-				// Calculate absolute differences
-				rDiff = math.Abs(r1f - r2f)
-				gDiff = math.Abs(g1f - g2f)
-				bDiff = math.Abs(b1f - b2f)
-				aDiff = math.Abs(a1f - a2f)
+				// Absolute differences
+				rDiff, gDiff, bDiff, aDiff = rRaw, gRaw, bRaw, aRaw
 			}
 
-			if (rDiff + gDiff + bDiff + aDiff) > 0 {
-				diffCount++
+			var differs bool
+			var deltaE float64
+			if opts.DiffMode == DiffModeDeltaE {
+				// Perceptual difference of the raw colors; those of float images are linear
+				var lab1, lab2 lab
+				if linear {
+					lab1, lab2 = linearToLab(r1f/255, g1f/255, b1f/255), linearToLab(r2f/255, g2f/255, b2f/255)
+				} else {
+					lab1, lab2 = rgbToLab(r1f, g1f, b1f), rgbToLab(r2f, g2f, b2f)
+				}
+				deltaE = ciede2000(lab1, lab2)
+				cs.sumDeltaE += deltaE
+				cs.maxDeltaE = max(cs.maxDeltaE, deltaE)
+				differs = deltaE > opts.DeltaEThreshold
+			} else {
+				differs = opts.exceedsTolerance(rDiff, gDiff, bDiff, aDiff)
+			}
+			antiAliased := differs && opts.DetectAntiAliasing &&
+				(isAntiAliased(img1, img2, x-min1.X, y-min1.Y) || isAntiAliased(img2, img1, x-min1.X, y-min1.Y))
+			if antiAliased {
+				differs = false
+				cs.antiAliased++
+			}
+			if differs {
+				cs.diffCount++
+				if max(rRaw, gRaw, bRaw, aRaw) < 1 {
+					cs.subStep++ // Lost when rounding the inputs to 8 bits
+				}
+				cs.diffBounds = cs.diffBounds.Union(image.Rect(x, y, x+1, y+1))
+				if diffMask != nil {
+					diffMask.SetAlpha(x, y, color.Alpha{255})
+				}
+			}
+			cs.sumErr.R += rDiff
+			cs.sumErr.G += gDiff
+			cs.sumErr.B += bDiff
+			cs.sumErr.A += aDiff
+			cs.maxErr.R = max(cs.maxErr.R, rDiff)
+			cs.maxErr.G = max(cs.maxErr.G, gDiff)
+			cs.maxErr.B = max(cs.maxErr.B, bDiff)
+			cs.maxErr.A = max(cs.maxErr.A, aDiff)
+
+			if diffImg == nil {
+				continue
 			}
 
-			// Ensure values stay within 8-bit range
-			var r, g, b uint8
-			switch diffMode {
-			case "bw":
-				// Black and white: any difference becomes white
-				if rDiff > 0 || gDiff > 0 || bDiff > 0 {
-					r, g, b = 255, 255, 255
+			// Channel levels in 8-bit units, kept fractional in deep images
+			var c color.Color
+			switch opts.DiffMode {
+			case DiffModeBW:
+				// Black and white: any difference beyond the tolerance becomes white
+				if differs {
+					c = levelColor(255, 255, 255, opts.Deep)
 				} else {
-					r, g, b = 0, 0, 0
+					c = levelColor(0, 0, 0, opts.Deep)
 				}
-			case "gray":
+			case DiffModeGray:
 				// Grayscale: average the differences
-				avgDiff := (rDiff + gDiff + bDiff) / 3.0
-				gray := uint8(min(avgDiff*scaleFactor, 255))
-				r, g, b = gray, gray, gray
-			case "color":
-				// RGB difference
-				r = uint8(min(rDiff*scaleFactor, 255))
-				g = uint8(min(gDiff*scaleFactor, 255))
-				b = uint8(min(bDiff*scaleFactor, 255))
+				gray := (rDiff + gDiff + bDiff) / 3.0 * scaleFactor
+				c = levelColor(gray, gray, gray, opts.Deep)
+			case DiffModeDeltaE:
+				// Heatmap: a difference of 50 saturates at scale factor 1
+				r, g, b := heatLevels(deltaE * scaleFactor / 50)
+				c = levelColor(r, g, b, opts.Deep)
+			case DiffModeHeatmap:
+				// Colormap of the same magnitude as gray
+				t := (rDiff + gDiff + bDiff) / 3.0 * scaleFactor / 255
+				if opts.Deep {
+					rgb := opts.Colormap.rgb(t)
+					c = levelColor(rgb[0]*255, rgb[1]*255, rgb[2]*255, true)
+				} else {
+					c = opts.Colormap.At(t)
+				}
+			case DiffModeOverlay:
+				// Faded left image with differences in the highlight color
+				r, g, b := overlayLevels(r1f, g1f, b1f, a1f, differs, max(rDiff, gDiff, bDiff, aDiff), scaleFactor, highlight)
+				c = levelColor(r, g, b, opts.Deep)
 			default:
-				// Default to color if unspecified or invalid
-				r = uint8(min(rDiff*scaleFactor, 255))
-				g = uint8(min(gDiff*scaleFactor, 255))
-				b = uint8(min(bDiff*scaleFactor, 255))
+				// RGB difference
+				c = levelColor(rDiff*scaleFactor, gDiff*scaleFactor, bDiff*scaleFactor, opts.Deep)
 			}
 
-			a := uint8(255) // Hardcode alpha to 255 for full opacity
+			if antiAliased {
+				c = AntiAliasColor
+			}
 
 			// Set pixel in difference image
-			diffImg.Set(x, y, color.RGBA{r, g, b, a})
+			diffImg.Set(x, y, c)
 		}
 	}
 
-	return count1, count2, diffCount
+	return cs
+}
+
+// absDiff returns |a - b|. For the values of float images, it is zero if both
+// are NaN or the same infinity, and +Inf if only one is NaN, so that NaNs
+// count as differences.
+func absDiff(a, b float64) float64 {
+	if a == b || math.IsNaN(a) && math.IsNaN(b) {
+		return 0
+	}
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.Inf(1)
+	}
+	return math.Abs(a - b)
+}
+
+// levelColor returns an opaque color with channel levels r, g and b in 8-bit
+// units, clamped to [0, 255]. Deep colors round each level to 16 bits;
+// otherwise levels are truncated to 8 bits.
+func levelColor(r, g, b float64, deep bool) color.Color {
+	clamp := func(v float64) float64 { return min(max(v, 0), 255) }
+	if deep {
+		to16 := func(v float64) uint16 { return uint16(math.Round(clamp(v) * 257)) }
+		return color.RGBA64{to16(r), to16(g), to16(b), 0xffff}
+	}
+	return color.RGBA{uint8(clamp(r)), uint8(clamp(g)), uint8(clamp(b)), 255}
+}
+
+// newDiffImage returns the image that a difference image or composite is
+// rendered into: *image.RGBA64 if deep, *image.RGBA otherwise.
+func newDiffImage(bounds image.Rectangle, deep bool) draw.Image {
+	if deep {
+		return image.NewRGBA64(bounds)
+	}
+	return image.NewRGBA(bounds)
+}
+
+// exceedsTolerance reports whether a pixel with the given channel differences
+// counts as differing.
+func (opts Options) exceedsTolerance(rDiff, gDiff, bDiff, aDiff float64) bool {
+	if opts.ToleranceMetric == ToleranceEuclidean {
+		return math.Sqrt(rDiff*rDiff+gDiff*gDiff+bDiff*bDiff+aDiff*aDiff) > opts.Tolerance
+	}
+	return max(rDiff, gDiff, bDiff, aDiff) > opts.Tolerance
 }
 
 func createChunks(bounds image.Rectangle, numChunksX, numChunksY int) iter.Seq[Chunk] {
@@ -224,419 +550,324 @@ func createChunks(bounds image.Rectangle, numChunksX, numChunksY int) iter.Seq[C
 	}
 }
 
-func openImage(filename, viewer string, wait, verbose bool) error {
-	var cmd *exec.Cmd
-
-	if viewer != "" {
-		if verbose {
-			log.Printf("Opening image with custom viewer: %s %s", viewer, filename)
-		}
-		// Use custom viewer
-		if wait {
-			cmd = exec.Command(viewer, filename)
-			return cmd.Run() // Run waits for completion
-		} else {
-			cmd = exec.Command(viewer, filename)
-			return cmd.Start() // Start doesn't wait
-		}
+// chunkGrid picks the number of chunks along each axis: roughly one chunk per
+// CPU, but never smaller than 32 pixels on a side.
+func chunkGrid(bounds image.Rectangle) (int, int) {
+	numCPU := runtime.NumCPU()
+	numChunksX := int(math.Sqrt(float64(numCPU)))
+	numChunksY := numCPU / numChunksX
+	if numChunksX*numChunksY < numCPU {
+		numChunksY++
 	}
 
-	// Use default system viewer
-	if verbose {
-		log.Printf("Opening image with default system viewer: %s", filename)
+	minChunkSize := 32
+	if bounds.Dx()/numChunksX < minChunkSize {
+		numChunksX = bounds.Dx() / minChunkSize
 	}
-	switch runtime.GOOS {
-	case "darwin": // macOS
-		if wait {
-			cmd = exec.Command("open", "-W", filename)
-		} else {
-			cmd = exec.Command("open", filename)
-		}
-	case "linux": // Linux
-		if wait {
-			cmd = exec.Command("sh", "-c", fmt.Sprintf("xdg-open %q && wait", filename))
-		} else {
-			cmd = exec.Command("xdg-open", filename)
-		}
-	case "windows": // Windows
-		if wait {
-			cmd = exec.Command("cmd", "/c", "start", "/wait", filename)
-		} else {
-			cmd = exec.Command("cmd", "/c", "start", filename)
-		}
-	default:
-		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	if bounds.Dy()/numChunksY < minChunkSize {
+		numChunksY = bounds.Dy() / minChunkSize
 	}
-
-	return cmd.Run()
+	if numChunksX < 1 {
+		numChunksX = 1
+	}
+	if numChunksY < 1 {
+		numChunksY = 1
+	}
+	return numChunksX, numChunksY
 }
 
-// Helper function to get viewer name for output message
-func getViewerName(viewer string) string {
-	if viewer != "" {
-		return fmt.Sprintf("custom viewer (%s)", viewer)
-	}
-	switch runtime.GOOS {
-	case "darwin":
-		return "default macOS viewer"
-	case "linux":
-		return "default Linux viewer"
-	case "windows":
-		return "default Windows viewer"
-	default:
-		return "default viewer"
+// forEachChunk splits bounds into chunks and calls fn on each of them
+// concurrently. It returns once all calls have completed.
+func forEachChunk(bounds image.Rectangle, fn func(Chunk)) {
+	numChunksX, numChunksY := chunkGrid(bounds)
+
+	var wg sync.WaitGroup
+	for chunk := range createChunks(bounds, numChunksX, numChunksY) {
+		wg.Add(1)
+		go func(c Chunk) {
+			defer wg.Done()
+			fn(c)
+		}(chunk)
 	}
+	wg.Wait() // Wait for all chunks to complete
 }
 
-func createCompositeImage(img1, img2, diffImg image.Image) image.Image {
-	bounds1 := img1.Bounds()
-	width := bounds1.Dx() * 3 // Input1 + Diff + Input2 side by side
-	height := bounds1.Dy()    // Same height as input images
+// CreateCompositeImage places img1, diffImg and img2 side by side. Panels of
+// different sizes are aligned at the top; the composite is as tall as the
+// tallest panel.
+func CreateCompositeImage(img1, img2, diffImg image.Image) image.Image {
+	return createComposite(img1, img2, diffImg, false)
+}
 
-	composite := image.NewRGBA(image.Rect(0, 0, width, height))
+// createComposite implements CreateCompositeImage, with 16 bits per channel
+// if deep.
+func createComposite(img1, img2, diffImg image.Image, deep bool) draw.Image {
+	bounds1, boundsDiff, bounds2 := img1.Bounds(), diffImg.Bounds(), img2.Bounds()
+	width := bounds1.Dx() + boundsDiff.Dx() + bounds2.Dx() // Input1 + Diff + Input2 side by side
+	height := max(bounds1.Dy(), boundsDiff.Dy(), bounds2.Dy())
+
+	composite := newDiffImage(image.Rect(0, 0, width, height), deep)
 
 	// Draw first input image (left)
 	draw.Draw(composite, image.Rect(0, 0, bounds1.Dx(), bounds1.Dy()), img1, bounds1.Min, draw.Src)
 
 	// Draw difference image (center)
-	draw.Draw(composite, image.Rect(bounds1.Dx(), 0, bounds1.Dx()*2, bounds1.Dy()), diffImg, bounds1.Min, draw.Src)
+	x := bounds1.Dx()
+	draw.Draw(composite, image.Rect(x, 0, x+boundsDiff.Dx(), boundsDiff.Dy()), diffImg, boundsDiff.Min, draw.Src)
 
 	// Draw second input image (right)
-	draw.Draw(composite, image.Rect(bounds1.Dx()*2, 0, width, bounds1.Dy()), img2, bounds1.Min, draw.Src)
+	x += boundsDiff.Dx()
+	draw.Draw(composite, image.Rect(x, 0, x+bounds2.Dx(), bounds2.Dy()), img2, bounds2.Min, draw.Src)
 
 	return composite
 }
 
-func configureGitDifftool(enable bool, verbose bool) {
-	toolName := "imagediff"
-	binaryPath, err := os.Executable()
-	if err != nil {
-		if verbose {
-			log.Printf("Error getting executable path: %v", err)
-		} else {
-			fmt.Printf("Error getting executable path: %v\n", err)
-		}
-		os.Exit(1)
-	}
-
-	if enable {
-		if verbose {
-			log.Printf("Enabling imagediff as git difftool with path: %s", binaryPath)
-		}
-		cmd := exec.Command("git", "config", "--global", "diff.tool", toolName)
-		if err := cmd.Run(); err != nil {
-			if verbose {
-				log.Printf("Error setting diff.tool: %v", err)
-			} else {
-				fmt.Printf("Error setting diff.tool: %v\n", err)
-			}
-			os.Exit(1)
-		}
-
-		cmdStr := fmt.Sprintf("%s -left \"$LOCAL\" -right \"$REMOTE\" -wait", binaryPath)
-		cmd = exec.Command("git", "config", "--global", fmt.Sprintf("difftool.%s.cmd", toolName), cmdStr)
-		if err := cmd.Run(); err != nil {
-			if verbose {
-				log.Printf("Error setting difftool.%s.cmd: %v", toolName, err)
-			} else {
-				fmt.Printf("Error setting difftool.%s.cmd: %v\n", toolName, err)
-			}
-			os.Exit(1)
-		}
-
-		fmt.Println("imagediff successfully enabled as git difftool")
-	} else {
-		if verbose {
-			log.Printf("Disabling imagediff as git difftool")
-		}
-		cmd := exec.Command("git", "config", "--global", "--unset", "diff.tool")
-		if err := cmd.Run(); err != nil && err.Error() != "exit status 5" { // 5 means key not found, which is fine
-			if verbose {
-				log.Printf("Error unsetting diff.tool: %v", err)
-			} else {
-				fmt.Printf("Error unsetting diff.tool: %v\n", err)
-			}
-			os.Exit(1)
-		}
-
-		cmd = exec.Command("git", "config", "--global", "--unset", fmt.Sprintf("difftool.%s.cmd", toolName))
-		if err := cmd.Run(); err != nil && err.Error() != "exit status 5" {
-			if verbose {
-				log.Printf("Error unsetting difftool.%s.cmd: %v", toolName, err)
-			} else {
-				fmt.Printf("Error unsetting difftool.%s.cmd: %v\n", toolName, err)
-			}
-			os.Exit(1)
-		}
-
-		fmt.Println("imagediff successfully disabled as git difftool")
-	}
+// Composite returns CreateCompositeImage of the compared images and the
+// difference image, with ignored regions of the input panels dimmed and, with
+// Options.DrawClusters, clusters outlined on the input panels too. With
+// Options.Deep the composite has 16 bits per channel. FloatImage inputs are
+// tone mapped (see ToneMapped).
+func (r *Result) Composite() image.Image {
+	composite := createComposite(r.ToneMapped(r.Left), r.ToneMapped(r.Right), r.Image, r.Options.Deep)
+	leftBounds := r.Left.Bounds()
+	leftPanel := image.Rectangle{Max: leftBounds.Size()}
+	x := leftBounds.Dx() + r.Image.Bounds().Dx()
+	rightPanel := image.Rectangle{Max: r.Right.Bounds().Size()}.Add(image.Pt(x, 0))
+	r.markPanel(composite, leftPanel)
+	r.markPanel(composite, rightPanel)
+	return composite
 }
 
-// printUsageWithExamples prints the standard flag usage followed by example runs
-func printUsageWithExamples() {
-	flag.CommandLine.SetOutput(os.Stderr) // Ensure usage goes to stderr
-	flag.Usage()
-	exe := os.Args[0]
-	fmt.Fprintf(os.Stderr, "\nExamples:\n")
-	fmt.Fprintf(os.Stderr, "  Basic non-normalized difference:\n")
-	fmt.Fprintf(os.Stderr, "    %s -left image1.png -right image2.png\n", exe)
-	fmt.Fprintf(os.Stderr, "  Normalized grayscale difference with custom scale:\n")
-	fmt.Fprintf(os.Stderr, "    %s -left image1.png -right image2.png -normalized -diff-mode gray -normalized-scale 25.0\n", exe)
-	fmt.Fprintf(os.Stderr, "  Composite output with verbose logging:\n")
-	fmt.Fprintf(os.Stderr, "    %s -left image1.png -right image2.png -include-inputs -verbose\n", exe)
-	fmt.Fprintf(os.Stderr, "  Configure as git difftool:\n")
-	fmt.Fprintf(os.Stderr, "    %s -git-config enable\n", exe)
-	fmt.Fprintf(os.Stderr, "\n")
+// markPanel dims the ignored pixels of an input image drawn at panel and, with
+// Options.DrawClusters, outlines the clusters on it.
+func (r *Result) markPanel(img draw.Image, panel image.Rectangle) {
+	origin := r.Left.Bounds().Min
+	if r.IgnoreMask != nil {
+		dimIgnored(img, panel, r.IgnoreMask, origin)
+	}
+	if r.Options.DrawClusters {
+		drawClusters(img, panel, r.Clusters, panel.Min.Sub(origin))
+	}
 }
 
-func main() {
-	flag.CommandLine.Usage = printUsageWithExamples
-	flag.Parse()
-
-	if *verbosePtr {
-		log.SetFlags(log.LstdFlags | log.Lshortfile) // Include timestamp and file:line
-	}
-
-	// Handle git-config flag
-	if *gitConfigPtr != "" {
-		if *gitConfigPtr == "enable" {
-			configureGitDifftool(true, *verbosePtr)
-			os.Exit(0)
-		} else if *gitConfigPtr == "disable" {
-			configureGitDifftool(false, *verbosePtr)
-			os.Exit(0)
-		} else {
-			log.Printf("Error: Invalid -git-config value '%s'. Use 'enable' or 'disable'.", *gitConfigPtr)
-			printUsageWithExamples()
-			os.Exit(1)
-		}
+func (opts Options) withDefaults() Options {
+	if opts.DiffMode == "" {
+		opts.DiffMode = DiffModeColor
 	}
-
-	if *leftPtr == "" || *rightPtr == "" {
-		log.Println("Error: Both left and right input files are required")
-		printUsageWithExamples()
-		os.Exit(1)
+	if opts.DiffMode == DiffModeSSIM {
+		opts.SSIM = true
 	}
-
-	if *verbosePtr {
-		log.Printf("Starting imagediff with left=%s, right=%s", *leftPtr, *rightPtr)
+	if opts.DrawClusters {
+		opts.Clusters = true
 	}
-
-	// Validate diffMode
-	if *diffModePtr != "bw" && *diffModePtr != "gray" && *diffModePtr != "color" {
-		log.Printf("Error: Invalid -diff-mode value '%s'. Use 'bw', 'gray', or 'color'.", *diffModePtr)
-		printUsageWithExamples()
-		os.Exit(1)
+	if opts.SizePolicy == "" {
+		opts.SizePolicy = SizePolicyError
 	}
-
-	// Open the left image
-	img1File, err := os.Open(*leftPtr)
-	if err != nil {
-		if *verbosePtr {
-			log.Printf("Error opening left image file %s: %v", *leftPtr, err)
-		} else {
-			fmt.Printf("Error opening left image: %v\n", err)
-		}
-		os.Exit(1)
+	if opts.PadColor == nil {
+		opts.PadColor = color.Transparent
 	}
-	defer img1File.Close()
-
-	// Open the right image
-	img2File, err := os.Open(*rightPtr)
-	if err != nil {
-		if *verbosePtr {
-			log.Printf("Error opening right image file %s: %v", *rightPtr, err)
-		} else {
-			fmt.Printf("Error opening right image: %v\n", err)
-		}
-		os.Exit(1)
+	if opts.HighlightColor == nil {
+		opts.HighlightColor = DefaultHighlightColor
 	}
-	defer img2File.Close()
-
-	if *verbosePtr {
-		log.Println("Decoding left image")
+	if opts.Colormap == "" {
+		opts.Colormap = ColormapViridis
 	}
-	img1, _, err := image.Decode(img1File)
-	if err != nil {
-		if *verbosePtr {
-			log.Printf("Error decoding left image: %v", err)
-		} else {
-			fmt.Printf("Error decoding left image: %v\n", err)
-		}
-		os.Exit(1)
+	if opts.ToneMap == "" {
+		opts.ToneMap = ToneMapClamp
 	}
-
-	if *verbosePtr {
-		log.Println("Decoding right image")
+	if opts.MaxShift == 0 {
+		opts.MaxShift = DefaultMaxShift
 	}
-	img2, _, err := image.Decode(img2File)
-	if err != nil {
-		if *verbosePtr {
-			log.Printf("Error decoding right image: %v", err)
-		} else {
-			fmt.Printf("Error decoding right image: %v\n", err)
-		}
-		os.Exit(1)
+	if opts.DeltaEThreshold == 0 {
+		opts.DeltaEThreshold = DefaultDeltaEThreshold
 	}
-
-	// Check if images have the same dimensions
-	bounds1 := img1.Bounds()
-	bounds2 := img2.Bounds()
-	if bounds1 != bounds2 {
-		log.Println("Error: Images must have the same dimensions")
-		os.Exit(1)
+	if opts.ToleranceMetric == "" {
+		opts.ToleranceMetric = ToleranceChannel
 	}
-
-	var stats1, stats2 ImageStats
-	if *normalizedPtr {
-		if *verbosePtr {
-			log.Println("Calculating statistics for left image")
-		}
-		stats1 = calculateImageStats(img1)
-		if *verbosePtr {
-			log.Println("Calculating statistics for right image")
+	if opts.Scale == 0 {
+		opts.Scale = DefaultScale
+		if opts.Normalized {
+			opts.Scale = DefaultNormalizedScale
 		}
-		stats2 = calculateImageStats(img2)
 	}
+	return opts
+}
 
-	// Create output image
-	diffImg := image.NewRGBA(bounds1)
-	scaleFactor := *scalePtr
-	if *normalizedPtr {
-		scaleFactor = *normalizedScalePtr
+// ParseDiffMode converts a -diff-mode flag value to a DiffMode.
+func ParseDiffMode(s string) (DiffMode, error) {
+	switch mode := DiffMode(s); mode {
+	case DiffModeBW, DiffModeGray, DiffModeColor, DiffModeSSIM, DiffModeDeltaE, DiffModeOverlay, DiffModeHeatmap:
+		return mode, nil
 	}
+	return "", fmt.Errorf("invalid diff mode %q", s)
+}
 
-	numCPU := runtime.NumCPU()
-	numChunksX := int(math.Sqrt(float64(numCPU)))
-	numChunksY := numCPU / numChunksX
-	if numChunksX*numChunksY < numCPU {
-		numChunksY++
+// ParseToleranceMetric converts a -tolerance-metric flag value to a ToleranceMetric.
+func ParseToleranceMetric(s string) (ToleranceMetric, error) {
+	switch metric := ToleranceMetric(s); metric {
+	case ToleranceChannel, ToleranceEuclidean:
+		return metric, nil
 	}
+	return "", fmt.Errorf("invalid tolerance metric %q", s)
+}
 
-	minChunkSize := 32
-	if bounds1.Dx()/numChunksX < minChunkSize {
-		numChunksX = bounds1.Dx() / minChunkSize
+// Compare computes the difference between left and right. Pixels are matched
+// by their offset from each image's bounds.Min, so sub-images with different
+// origins are aligned; the difference image uses the bounds of left. Images
+// of different dimensions are handled according to opts.SizePolicy. The image
+// is split into chunks processed concurrently.
+//
+// Two FloatImages are compared in float: channel differences are their linear
+// values times 255, so that Tolerance and Scale keep their 8-bit meaning, and
+// values above 1 are not clamped. A FloatImage compared with any other image
+// is tone mapped first.
+func Compare(left, right image.Image, opts Options) (*Result, error) {
+	opts = opts.withDefaults()
+	if _, err := ParseDiffMode(string(opts.DiffMode)); err != nil {
+		return nil, err
 	}
-	if bounds1.Dy()/numChunksY < minChunkSize {
-		numChunksY = bounds1.Dy() / minChunkSize
+	if _, err := ParseToleranceMetric(string(opts.ToleranceMetric)); err != nil {
+		return nil, err
 	}
-	if numChunksX < 1 {
-		numChunksX = 1
+	if _, err := ParseSizePolicy(string(opts.SizePolicy)); err != nil {
+		return nil, err
 	}
-	if numChunksY < 1 {
-		numChunksY = 1
+	if _, err := ParseColormap(string(opts.Colormap)); err != nil {
+		return nil, err
 	}
-
-	if *verbosePtr {
-		log.Printf("Splitting image into %d chunks (%dx%d)", numChunksX*numChunksY, numChunksX, numChunksY)
+	if _, err := ParseToneMap(string(opts.ToneMap)); err != nil {
+		return nil, err
 	}
+	left, right = matchFloatInputs(left, right, opts)
 
-	var wg sync.WaitGroup
-	var count1, count2, diffCount int64
-
-	for chunk := range createChunks(bounds1, numChunksX, numChunksY) {
-		wg.Add(1)
-		go func(c Chunk) {
-			defer wg.Done()
-			c1, c2, c3 := computeDiffChunk(img1, img2, diffImg, c, stats1, stats2, *normalizedPtr, scaleFactor, *diffModePtr, *verbosePtr)
-			atomic.AddInt64(&count1, c1)
-			atomic.AddInt64(&count2, c2)
-			atomic.AddInt64(&diffCount, c3)
-		}(chunk)
+	// Cover the padding and strips beyond the left image as well
+	size1, size2 := left.Bounds().Size(), right.Bounds().Size()
+	maskBounds := image.Rectangle{Max: image.Pt(max(size1.X, size2.X), max(size1.Y, size2.Y))}.Add(left.Bounds().Min)
+	opts.ignoreMask = buildIgnoreMask(maskBounds, opts)
+	if opts.Verbose && opts.ignoreMask != nil {
+		log.Printf("Ignoring %d rectangles, mask %v; restricting to %d regions, region mask %v",
+			len(opts.Ignore), opts.Mask != nil, len(opts.Regions), opts.RegionMask != nil)
 	}
 
-	wg.Wait() // Wait for all chunks to complete
+	if opts.Align {
+		return compareAligned(left, right, opts)
+	}
+	if opts.SizePolicy == SizePolicyIntersect && left.Bounds().Size() != right.Bounds().Size() {
+		return compareIntersection(left, right, opts)
+	}
+	left, right, err := applySizePolicy(left, right, opts)
+	if err != nil {
+		return nil, err
+	}
+	return compareSameSize(left, right, opts)
+}
 
-	if *verbosePtr {
-		log.Printf("Non-zero pixels left %v right %v diff %v\n", count1, count2, diffCount)
+// compareSameSize runs the chunked diff pass over two images of the same
+// size, which may have different origins. opts must have defaults applied.
+func compareSameSize(left, right image.Image, opts Options) (*Result, error) {
+	bounds := left.Bounds()
+	if bounds.Size() != right.Bounds().Size() {
+		return nil, ErrSizeMismatch
 	}
 
-	// Handle output file
-	outputFile := *outputPtr
-	if outputFile == "" {
-		// Create a temporary file
-		tmpFile, err := os.CreateTemp("", "imagediff-*.png")
-		if err != nil {
-			if *verbosePtr {
-				log.Printf("Error creating temporary file: %v", err)
-			} else {
-				fmt.Printf("Error creating temporary file: %v\n", err)
-			}
-			os.Exit(1)
+	var stats1, stats2 ImageStats
+	if opts.Normalized {
+		if opts.Verbose {
+			log.Println("Calculating statistics for left image")
 		}
-		outputFile = tmpFile.Name()
-		defer tmpFile.Close()
-		if *verbosePtr {
-			log.Printf("Created temporary output file: %s", outputFile)
+		stats1 = CalculateImageStats(left)
+		if opts.Verbose {
+			log.Println("Calculating statistics for right image")
 		}
+		stats2 = CalculateImageStats(right)
 	}
 
-	// Create output file
-	outFile, err := os.Create(outputFile)
-	if err != nil {
-		if *verbosePtr {
-			log.Printf("Error creating output file %s: %v", outputFile, err)
-		} else {
-			fmt.Printf("Error creating output file: %v\n", err)
-		}
-		os.Exit(1)
+	diffImg := newDiffImage(bounds, opts.Deep)
+	var diffMask *image.Alpha
+	if opts.Clusters {
+		diffMask = image.NewAlpha(bounds)
 	}
-	defer outFile.Close()
 
-	// Decide which image to save
-	var finalImg image.Image = diffImg
-	if *includeInputsPtr {
-		if *verbosePtr {
-			log.Println("Creating composite image with inputs")
-		}
-		finalImg = createCompositeImage(img1, img2, diffImg)
+	numChunksX, numChunksY := chunkGrid(bounds)
+	if opts.Verbose {
+		log.Printf("Splitting image into %d chunks (%dx%d)", numChunksX*numChunksY, numChunksX, numChunksY)
 	}
 
-	// Encode and save the difference image
-	if *verbosePtr {
-		log.Printf("Encoding image to %s", outputFile)
-	}
-	err = png.Encode(outFile, finalImg)
-	if err != nil {
-		if *verbosePtr {
-			log.Printf("Error encoding output image: %v", err)
-		} else {
-			fmt.Printf("Error encoding output image: %v\n", err)
+	var mu sync.Mutex
+	var total chunkStats
+	forEachChunk(bounds, func(c Chunk) {
+		cs := computeDiffChunk(left, right, diffImg, diffMask, c, stats1, stats2, opts)
+		mu.Lock()
+		total.merge(cs)
+		mu.Unlock()
+	})
+
+	if opts.Verbose {
+		log.Printf("Non-zero pixels left %v right %v diff %v\n", total.count1, total.count2, total.diffCount)
+	}
+
+	numPixels := float64(int64(bounds.Dx()*bounds.Dy()) - total.ignored)
+	res := &Result{
+		Image:        diffImg,
+		Left:         left,
+		Right:        right,
+		Options:      opts,
+		NonZeroLeft:  total.count1,
+		NonZeroRight: total.count2,
+		LeftStats:    stats1,
+		RightStats:   stats2,
+		DiffCount:    total.diffCount,
+		SubStepCount: total.subStep,
+		AntiAliased:  total.antiAliased,
+		Ignored:      total.ignored,
+		IgnoreMask:   opts.ignoreMask,
+		MaxError:     total.maxErr,
+		DiffBounds:   total.diffBounds,
+	}
+	if numPixels > 0 {
+		res.DiffPercent = float64(total.diffCount) * 100 / numPixels
+		res.MeanError = ChannelError{
+			R: total.sumErr.R / numPixels,
+			G: total.sumErr.G / numPixels,
+			B: total.sumErr.B / numPixels,
+			A: total.sumErr.A / numPixels,
+		}
+		res.Metrics = computeMetrics(total, numPixels)
+		if opts.DiffMode == DiffModeDeltaE {
+			res.MaxDeltaE = total.maxDeltaE
+			res.MeanDeltaE = total.sumDeltaE / numPixels
 		}
-		os.Exit(1)
 	}
 
-	diffType := ""
-	diffMsg := ""
-	if *normalizedPtr {
-		diffType = "Normalized "
-	} else {
-		diffPercent := float64(diffCount) * 100 / float64(bounds1.Dx()*bounds1.Dy())
-		diffMsg = fmt.Sprintf(" (%.2f%% %d differing pixels)", diffPercent, diffCount)
-	}
-	outputMode := "Color"
-	if *diffModePtr == "bw" {
-		outputMode = "Black-and-White"
-	} else if *diffModePtr == "gray" {
-		outputMode = "Grayscale"
+	for _, region := range opts.Regions {
+		if opts.Verbose {
+			log.Printf("Comparing region %q %v", region.Name, region.Rect)
+		}
+		res.Regions = append(res.Regions, compareRegion(left, right, region, stats1, stats2, opts))
 	}
-	fmt.Printf("%s%s difference image successfully created with scale factor %.1f: %s%s\n", diffType, outputMode, scaleFactor, outputFile, diffMsg)
 
-	err = openImage(outputFile, *viewerPtr, *waitPtr, *verbosePtr)
-	if err != nil {
-		if *verbosePtr {
-			log.Printf("Error opening image: %v", err)
-		} else {
-			fmt.Printf("Error opening image: %v\n", err)
+	if opts.SSIM {
+		if opts.Verbose {
+			log.Println("Computing SSIM")
+		}
+		luma1, luma2 := newLumaImage(left), newLumaImage(right)
+		values, score, _ := ssimMap(luma1, luma2)
+		res.SSIM = score
+		res.MSSSIM = msssim(luma1, luma2)
+		if opts.DiffMode == DiffModeSSIM {
+			renderSSIMMap(diffImg, values, opts.Scale)
 		}
-		os.Exit(1)
 	}
-	if *verbosePtr {
-		if *waitPtr {
-			fmt.Println("Image viewer closed")
-		} else {
-			fmt.Println("Image opened in", getViewerName(*viewerPtr))
+	hatchIgnored(diffImg, opts.ignoreMask)
+
+	if opts.Clusters {
+		res.Clusters = findClusters(diffMask, left, right)
+		if opts.Verbose {
+			log.Printf("Found %d clusters of differing pixels", len(res.Clusters))
+		}
+		if opts.DrawClusters {
+			drawClusters(diffImg, bounds, res.Clusters, image.Point{})
 		}
 	}
+	return res, nil
 }
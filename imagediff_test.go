@@ -1,13 +1,10 @@
-package main
+package imagediff
 
 import (
-	"bytes"
 	"image"
 	"image/color"
-	"io"
+	"image/draw"
 	"math"
-	"os"
-	"strings"
 	"testing"
 )
 
@@ -70,21 +67,21 @@ func TestCalculateImageStats(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			stats := calculateImageStats(tt.img)
-			if !approxEqual(stats.meanR, tt.wantMeanR, 0.1) ||
-				!approxEqual(stats.meanG, tt.wantMeanG, 0.1) ||
-				!approxEqual(stats.meanB, tt.wantMeanB, 0.1) ||
-				!approxEqual(stats.meanA, tt.wantMeanA, 0.1) {
+			stats := CalculateImageStats(tt.img)
+			if !approxEqual(stats.MeanR, tt.wantMeanR, 0.1) ||
+				!approxEqual(stats.MeanG, tt.wantMeanG, 0.1) ||
+				!approxEqual(stats.MeanB, tt.wantMeanB, 0.1) ||
+				!approxEqual(stats.MeanA, tt.wantMeanA, 0.1) {
 				t.Errorf("%s: Means got R:%v G:%v B:%v A:%v, want R:%v G:%v B:%v A:%v",
-					tt.name, stats.meanR, stats.meanG, stats.meanB, stats.meanA,
+					tt.name, stats.MeanR, stats.MeanG, stats.MeanB, stats.MeanA,
 					tt.wantMeanR, tt.wantMeanG, tt.wantMeanB, tt.wantMeanA)
 			}
-			if !approxEqual(stats.stdR, tt.wantStdR, 0.1) ||
-				!approxEqual(stats.stdG, tt.wantStdG, 0.1) ||
-				!approxEqual(stats.stdB, tt.wantStdB, 0.1) ||
-				!approxEqual(stats.stdA, tt.wantStdA, 0.1) {
+			if !approxEqual(stats.StdR, tt.wantStdR, 0.1) ||
+				!approxEqual(stats.StdG, tt.wantStdG, 0.1) ||
+				!approxEqual(stats.StdB, tt.wantStdB, 0.1) ||
+				!approxEqual(stats.StdA, tt.wantStdA, 0.1) {
 				t.Errorf("%s: Stds got R:%v G:%v B:%v A:%v, want R:%v G:%v B:%v A:%v",
-					tt.name, stats.stdR, stats.stdG, stats.stdB, stats.stdA,
+					tt.name, stats.StdR, stats.StdG, stats.StdB, stats.StdA,
 					tt.wantStdR, tt.wantStdG, tt.wantStdB, tt.wantStdA)
 			}
 		})
@@ -123,7 +120,7 @@ func TestComputeDiffChunk(t *testing.T) {
 		chunk       Chunk
 		normalized  bool
 		scaleFactor float64
-		diffMode    string
+		diffMode    DiffMode
 		wantPixel   color.RGBA
 		wantC1      int64
 		wantC2      int64
@@ -189,11 +186,12 @@ func TestComputeDiffChunk(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			diffImg := image.NewRGBA(tt.img1.Bounds())
-			stats1 := calculateImageStats(tt.img1)
-			stats2 := calculateImageStats(tt.img2)
+			stats1 := CalculateImageStats(tt.img1)
+			stats2 := CalculateImageStats(tt.img2)
 
-			c1, c2, c3 := computeDiffChunk(tt.img1, tt.img2, diffImg, tt.chunk, stats1, stats2,
-				tt.normalized, tt.scaleFactor, tt.diffMode, false)
+			opts := Options{Normalized: tt.normalized, Scale: tt.scaleFactor, DiffMode: tt.diffMode}
+			cs := computeDiffChunk(tt.img1, tt.img2, diffImg, nil, tt.chunk, stats1, stats2, opts)
+			c1, c2, c3 := cs.count1, cs.count2, cs.diffCount
 
 			if c1 != tt.wantC1 || c2 != tt.wantC2 || c3 != tt.wantC3 {
 				t.Errorf("%s: Counts got c1:%d c2:%d c3:%d, want %d %d %d",
@@ -278,7 +276,7 @@ func TestCreateCompositeImage(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			composite := createCompositeImage(tt.img1, tt.img2, tt.diffImg)
+			composite := CreateCompositeImage(tt.img1, tt.img2, tt.diffImg)
 			if composite.Bounds() != tt.wantSize {
 				t.Errorf("%s: got bounds %v, want %v", tt.name, composite.Bounds(), tt.wantSize)
 			}
@@ -292,22 +290,208 @@ func TestCreateCompositeImage(t *testing.T) {
 	}
 }
 
-func TestPrintUsageWithExamples(t *testing.T) {
-	// Capture stdout
-	oldStderr := os.Stderr
-	r, w, _ := os.Pipe()
-	os.Stderr = w
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name          string
+		img1          image.Image
+		img2          image.Image
+		opts          Options
+		wantErr       error
+		wantDiffCount int64
+		wantPixel     color.RGBA
+	}{
+		{
+			name:          "Identical",
+			img1:          createTestImage(40, 40, color.RGBA{10, 20, 30, 255}),
+			img2:          createTestImage(40, 40, color.RGBA{10, 20, 30, 255}),
+			wantDiffCount: 0,
+			wantPixel:     color.RGBA{0, 0, 0, 255},
+		},
+		{
+			name:          "Default Scale",
+			img1:          createTestImage(40, 40, color.RGBA{10, 20, 30, 255}),
+			img2:          createTestImage(40, 40, color.RGBA{20, 20, 30, 255}),
+			wantDiffCount: 1600,
+			wantPixel:     color.RGBA{20, 0, 0, 255}, // 10 * DefaultScale
+		},
+		{
+			name:          "BW Mode",
+			img1:          createTestImage(40, 40, color.RGBA{10, 20, 30, 255}),
+			img2:          createTestImage(40, 40, color.RGBA{20, 20, 30, 255}),
+			opts:          Options{DiffMode: DiffModeBW},
+			wantDiffCount: 1600,
+			wantPixel:     color.RGBA{255, 255, 255, 255},
+		},
+		{
+			name:    "Size Mismatch",
+			img1:    createTestImage(4, 4, color.Black),
+			img2:    createTestImage(4, 5, color.Black),
+			wantErr: ErrSizeMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Compare(tt.img1, tt.img2, tt.opts)
+			if err != tt.wantErr {
+				t.Fatalf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if res.DiffCount != tt.wantDiffCount {
+				t.Errorf("%s: DiffCount got %d, want %d", tt.name, res.DiffCount, tt.wantDiffCount)
+			}
+			if gotPixel := res.Image.At(39, 39).(color.RGBA); gotPixel != tt.wantPixel {
+				t.Errorf("%s: Pixel got %v, want %v", tt.name, gotPixel, tt.wantPixel)
+			}
+		})
+	}
+
+	if _, err := Compare(createTestImage(1, 1, color.Black), createTestImage(1, 1, color.Black), Options{DiffMode: "sepia"}); err == nil {
+		t.Errorf("Invalid diff mode: expected error")
+	}
+}
+
+func TestCompareResult(t *testing.T) {
+	img1 := createTestImage(10, 10, color.RGBA{100, 100, 100, 255})
+	img2 := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(img2, img2.Bounds(), img1, image.Point{}, draw.Src)
+	img2.Set(2, 3, color.RGBA{140, 100, 100, 255})
+	img2.Set(6, 7, color.RGBA{100, 90, 100, 255})
+
+	res, err := Compare(img1, img2, Options{})
+	if err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if res.DiffCount != 2 {
+		t.Errorf("DiffCount got %d, want 2", res.DiffCount)
+	}
+	if !approxEqual(res.DiffPercent, 2.0, 0.001) {
+		t.Errorf("DiffPercent got %v, want 2", res.DiffPercent)
+	}
+	if want := (ChannelError{R: 40, G: 10}); res.MaxError != want {
+		t.Errorf("MaxError got %+v, want %+v", res.MaxError, want)
+	}
+	if !approxEqual(res.MeanError.R, 0.4, 0.001) || !approxEqual(res.MeanError.G, 0.1, 0.001) {
+		t.Errorf("MeanError got %+v, want R:0.4 G:0.1", res.MeanError)
+	}
+	if want := image.Rect(2, 3, 7, 8); res.DiffBounds != want {
+		t.Errorf("DiffBounds got %v, want %v", res.DiffBounds, want)
+	}
+	if res.Options.Scale != DefaultScale || res.Options.DiffMode != DiffModeColor {
+		t.Errorf("Options got %+v, want defaults applied", res.Options)
+	}
+}
+
+func TestCompareDifferentOrigins(t *testing.T) {
+	// Left is a sub-image of a larger canvas; right has a negative origin
+	canvas := createPatternImage(40, 40, 0).(*image.RGBA)
+	left := canvas.SubImage(image.Rect(10, 10, 20, 20))
+	right := image.NewRGBA(image.Rect(-5, 3, 5, 13))
+	draw.Draw(right, right.Bounds(), left, left.Bounds().Min, draw.Src)
+	right.Set(-5+2, 3+3, color.RGBA{255, 0, 0, 255}) // Relative position (2, 3)
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "Color", opts: Options{}},
+		{name: "Anti-Aliasing", opts: Options{DetectAntiAliasing: true}},
+		{name: "Intersect", opts: Options{SizePolicy: SizePolicyIntersect}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Compare(left, right, tt.opts)
+			if err != nil {
+				t.Fatalf("%s: Compare: %v", tt.name, err)
+			}
+			if res.Image.Bounds() != left.Bounds() {
+				t.Errorf("%s: diff bounds got %v, want %v", tt.name, res.Image.Bounds(), left.Bounds())
+			}
+			if res.DiffCount != 1 {
+				t.Errorf("%s: DiffCount got %d, want 1", tt.name, res.DiffCount)
+			}
+			if want := image.Rect(12, 13, 13, 14); res.DiffBounds != want {
+				t.Errorf("%s: DiffBounds got %v, want %v", tt.name, res.DiffBounds, want)
+			}
+		})
+	}
+
+	composite := CreateCompositeImage(left, right, createTestImage(10, 10, color.RGBA{0, 0, 100, 255}))
+	if got, want := composite.At(0, 0), canvas.At(10, 10); got != want {
+		t.Errorf("Composite left panel: got %v, want %v", got, want)
+	}
+	if got, want := composite.At(22, 3), right.At(-3, 6); got != want {
+		t.Errorf("Composite right panel: got %v, want %v", got, want)
+	}
+}
+
+func TestTolerance(t *testing.T) {
+	img1 := createTestImage(4, 4, color.RGBA{100, 100, 100, 255})
+	img2 := createTestImage(4, 4, color.RGBA{102, 101, 100, 255})
+	tests := []struct {
+		name          string
+		tolerance     float64
+		metric        ToleranceMetric
+		wantDiffCount int64
+		wantPixel     color.RGBA
+	}{
+		{name: "Zero", tolerance: 0, wantDiffCount: 16, wantPixel: color.RGBA{255, 255, 255, 255}},
+		{name: "Channel Below", tolerance: 1, metric: ToleranceChannel, wantDiffCount: 16, wantPixel: color.RGBA{255, 255, 255, 255}},
+		{name: "Channel At", tolerance: 2, metric: ToleranceChannel, wantDiffCount: 0, wantPixel: color.RGBA{0, 0, 0, 255}},
+		{name: "Euclidean Below", tolerance: 2, metric: ToleranceEuclidean, wantDiffCount: 16, wantPixel: color.RGBA{255, 255, 255, 255}}, // sqrt(5) > 2
+		{name: "Euclidean Above", tolerance: 3, metric: ToleranceEuclidean, wantDiffCount: 0, wantPixel: color.RGBA{0, 0, 0, 255}},
+	}
 
-	printUsageWithExamples()
-	w.Close()
-	os.Stderr = oldStderr
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Compare(img1, img2, Options{DiffMode: DiffModeBW, Tolerance: tt.tolerance, ToleranceMetric: tt.metric})
+			if err != nil {
+				t.Fatalf("%s: Compare: %v", tt.name, err)
+			}
+			if res.DiffCount != tt.wantDiffCount {
+				t.Errorf("%s: DiffCount got %d, want %d", tt.name, res.DiffCount, tt.wantDiffCount)
+			}
+			if gotPixel := res.Image.At(0, 0).(color.RGBA); gotPixel != tt.wantPixel {
+				t.Errorf("%s: Pixel got %v, want %v", tt.name, gotPixel, tt.wantPixel)
+			}
+		})
+	}
+}
 
-	var buf bytes.Buffer
-	io.Copy(&buf, r)
-	output := buf.String()
+func TestThreshold(t *testing.T) {
+	res := &Result{DiffCount: 50, DiffPercent: 0.5}
+	tests := []struct {
+		input       string
+		wantErr     bool
+		wantExceeds bool
+	}{
+		{input: "0", wantExceeds: true},
+		{input: "49", wantExceeds: true},
+		{input: "50", wantExceeds: false},
+		{input: "0.25%", wantExceeds: true},
+		{input: "0.5%", wantExceeds: false},
+		{input: " 1% ", wantExceeds: false},
+		{input: "-1", wantErr: true},
+		{input: "101%", wantErr: true},
+		{input: "abc", wantErr: true},
+	}
 
-	if !strings.Contains(output, "Examples:") || !strings.Contains(output, "imagediff") {
-		t.Errorf("printUsageWithExamples() output missing expected content: %s", output)
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			threshold, err := ParseThreshold(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseThreshold(%q): got error %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := res.Exceeds(threshold); got != tt.wantExceeds {
+				t.Errorf("Exceeds(%v): got %v, want %v", threshold, got, tt.wantExceeds)
+			}
+		})
 	}
 }
 
@@ -315,3 +499,99 @@ func TestPrintUsageWithExamples(t *testing.T) {
 func approxEqual(a, b, tol float64) bool {
 	return math.Abs(a-b) <= tol
 }
+
+func TestCompareDeep(t *testing.T) {
+	// solid16 returns a 4x4 16-bit gray image with the pixel at (1, 1) set to v
+	solid16 := func(v uint16) image.Image {
+		img := image.NewRGBA64(image.Rect(0, 0, 4, 4))
+		for y := range 4 {
+			for x := range 4 {
+				img.SetRGBA64(x, y, color.RGBA64{0x8000, 0x8000, 0x8000, 0xffff})
+			}
+		}
+		img.SetRGBA64(1, 1, color.RGBA64{v, v, v, 0xffff})
+		return img
+	}
+	left := solid16(0x8000)
+	right := solid16(0x8010) // 16/257 of an 8-bit step brighter
+
+	tests := []struct {
+		name     string
+		opts     Options
+		model    color.Model
+		wantDiff int64
+		want     color.Color
+	}{
+		{
+			name:     "8-bit Output Loses Difference",
+			opts:     Options{},
+			model:    color.RGBAModel,
+			wantDiff: 1,
+			want:     color.RGBA{0, 0, 0, 255},
+		},
+		{
+			name:     "Deep Color",
+			opts:     Options{Deep: true},
+			model:    color.RGBA64Model,
+			wantDiff: 1,
+			want:     color.RGBA64{32, 32, 32, 0xffff}, // 16 at scale factor 2
+		},
+		{
+			name:     "Deep Gray Amplified",
+			opts:     Options{Deep: true, DiffMode: DiffModeGray, Scale: 100},
+			model:    color.RGBA64Model,
+			wantDiff: 1,
+			want:     color.RGBA64{1600, 1600, 1600, 0xffff},
+		},
+		{
+			name:     "Deep Within Tolerance",
+			opts:     Options{Deep: true, DiffMode: DiffModeBW, Tolerance: 0.1},
+			model:    color.RGBA64Model,
+			wantDiff: 0,
+			want:     color.RGBA64{0, 0, 0, 0xffff},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Compare(left, right, tt.opts)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			if result.DiffCount != tt.wantDiff || result.SubStepCount != tt.wantDiff {
+				t.Errorf("%s: DiffCount %d, SubStepCount %d, want %d", tt.name, result.DiffCount, result.SubStepCount, tt.wantDiff)
+			}
+			if got := result.Image.ColorModel(); got != tt.model {
+				t.Errorf("%s: image model got %v, want %v", tt.name, got, tt.model)
+			}
+			if got := result.Image.At(1, 1); got != tt.want {
+				t.Errorf("%s: pixel got %v, want %v", tt.name, got, tt.want)
+			}
+			if got := result.Composite().ColorModel(); got != tt.model {
+				t.Errorf("%s: composite model got %v, want %v", tt.name, got, tt.model)
+			}
+		})
+	}
+
+	// Differences of whole 8-bit steps are not sub-step
+	result, err := Compare(createTestImage(2, 2, color.RGBA{100, 100, 100, 255}), createTestImage(2, 2, color.RGBA{101, 100, 100, 255}), Options{Deep: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.DiffCount != 4 || result.SubStepCount != 0 {
+		t.Errorf("8-bit inputs: DiffCount %d, SubStepCount %d, want 4 and 0", result.DiffCount, result.SubStepCount)
+	}
+	if got := result.Image.At(0, 0); got != (color.RGBA64{514, 0, 0, 0xffff}) {
+		t.Errorf("8-bit inputs: pixel got %v, want %v", got, color.RGBA64{514, 0, 0, 0xffff})
+	}
+
+	// The legend keeps the depth of the image
+	result, err = Compare(left, right, Options{Deep: true, DiffMode: DiffModeGray})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	legend := result.WithLegend(result.Image)
+	if legend.ColorModel() != color.RGBA64Model || legend.Bounds().Dy() != 4+legendHeight {
+		t.Errorf("legend got %v model, bounds %v", legend.ColorModel(), legend.Bounds())
+	}
+}
@@ -0,0 +1,140 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+)
+
+// Layout of the legend bar added by WithLegend, in pixels
+const (
+	legendHeight    = 32  // Total height below the image
+	legendMinWidth  = 160 // Narrower images are widened to fit the labels
+	legendPad       = 4   // Margin around the color bar
+	legendBarHeight = 10
+	glyphScale      = 2 // Size of a font pixel
+)
+
+// glyphs is a 3x5 pixel font for the legend labels; each row holds three
+// bits, the most significant on the left.
+var glyphs = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 1, 2, 2},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	'.': {0, 0, 0, 0, 2},
+	'e': {0, 3, 7, 4, 3},
+	'+': {0, 2, 7, 2, 0},
+	'-': {0, 0, 7, 0, 0},
+}
+
+// HasLegend reports whether m renders a single difference magnitude, so that
+// Result.WithLegend can annotate its colors.
+func (m DiffMode) HasLegend() bool {
+	switch m {
+	case DiffModeGray, DiffModeHeatmap, DiffModeDeltaE, DiffModeSSIM:
+		return true
+	}
+	return false
+}
+
+// legendScale returns the colors of the difference image for t in [0, 1]
+// and the difference at which they saturate: the average channel
+// difference for DiffModeGray and DiffModeHeatmap, ΔE2000 for
+// DiffModeDeltaE and 1 - SSIM for DiffModeSSIM. Normalized channel
+// differences are in standard deviations.
+func (r *Result) legendScale() (func(t float64) color.RGBA, float64) {
+	scale := r.Options.Scale
+	grayRamp := func(t float64) color.RGBA {
+		v := uint8(math.Round(max(min(t, 1), 0) * 255))
+		return color.RGBA{v, v, v, 255}
+	}
+	switch r.Options.DiffMode {
+	case DiffModeHeatmap:
+		return r.Options.Colormap.At, 255 / scale
+	case DiffModeDeltaE:
+		return heatColor, 50 / scale
+	case DiffModeSSIM:
+		return grayRamp, 2 / scale
+	}
+	return grayRamp, 255 / scale
+}
+
+// WithLegend returns img, usually the difference image or the composite, with
+// a legend bar below it mapping the colors of the difference image to
+// difference values, from zero to the value at which they saturate. If the
+// DiffMode has no legend (see DiffMode.HasLegend), img is returned unchanged.
+// The result has 16 bits per channel if img has.
+func (r *Result) WithLegend(img image.Image) image.Image {
+	if !r.Options.DiffMode.HasLegend() {
+		return img
+	}
+	ramp, maxValue := r.legendScale()
+	b := img.Bounds()
+	width := max(b.Dx(), legendMinWidth)
+	out := newDiffImage(image.Rect(0, 0, width, b.Dy()+legendHeight), img.ColorModel() == color.RGBA64Model)
+	draw.Draw(out, b.Sub(b.Min), img, b.Min, draw.Src)
+	drawLegend(out, image.Rect(0, b.Dy(), width, b.Dy()+legendHeight), ramp, maxValue)
+	return out
+}
+
+// drawLegend draws a color bar of ramp across area with labeled ticks at
+// zero, half and the full maxValue.
+func drawLegend(img draw.Image, area image.Rectangle, ramp func(t float64) color.RGBA, maxValue float64) {
+	white := color.RGBA{255, 255, 255, 255}
+	draw.Draw(img, area, image.Black, image.Point{}, draw.Src)
+	bar := image.Rect(area.Min.X+legendPad, area.Min.Y+legendPad, area.Max.X-legendPad, area.Min.Y+legendPad+legendBarHeight)
+	for x := bar.Min.X; x < bar.Max.X; x++ {
+		c := ramp(float64(x-bar.Min.X) / float64(max(bar.Dx()-1, 1)))
+		for y := bar.Min.Y; y < bar.Max.Y; y++ {
+			img.Set(x, y, c)
+		}
+	}
+
+	textY := bar.Max.Y + 4
+	for _, frac := range []float64{0, 0.5, 1} {
+		x := bar.Min.X + int(math.Round(frac*float64(bar.Dx()-1)))
+		img.Set(x, bar.Max.Y, white)
+		img.Set(x, bar.Max.Y+1, white)
+
+		label := strconv.FormatFloat(frac*maxValue, 'g', 3, 64)
+		w := textWidth(label)
+		lx := min(max(x-w/2, bar.Min.X), bar.Max.X-w)
+		drawText(img, lx, textY, label, white)
+	}
+}
+
+// textWidth returns the width of s drawn by drawText
+func textWidth(s string) int {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	return n*4*glyphScale - glyphScale
+}
+
+// drawText draws s with its top-left corner at (x, y). Characters without a
+// glyph are left blank.
+func drawText(img draw.Image, x, y int, s string, c color.RGBA) {
+	for _, ch := range s {
+		g := glyphs[ch]
+		for row, bits := range g {
+			for col := range 3 {
+				if bits&(4>>col) == 0 {
+					continue
+				}
+				px := image.Rect(x+col*glyphScale, y+row*glyphScale, x+(col+1)*glyphScale, y+(row+1)*glyphScale)
+				draw.Draw(img, px, image.NewUniform(c), image.Point{}, draw.Src)
+			}
+		}
+		x += 4 * glyphScale
+	}
+}
@@ -0,0 +1,109 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestWithLegend(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+
+	tests := []struct {
+		name     string
+		width    int
+		opts     Options
+		ramp     func(t float64) color.RGBA
+		wantSize image.Point
+	}{
+		{
+			name:     "Heatmap Widened To Fit Labels",
+			width:    20,
+			opts:     Options{DiffMode: DiffModeHeatmap, Colormap: ColormapJet},
+			ramp:     ColormapJet.At,
+			wantSize: image.Pt(legendMinWidth, 20+legendHeight),
+		},
+		{
+			name:     "Delta E Keeps Image Width",
+			width:    300,
+			opts:     Options{DiffMode: DiffModeDeltaE},
+			ramp:     heatColor,
+			wantSize: image.Pt(300, 20+legendHeight),
+		},
+		{
+			name:     "Gray",
+			width:    200,
+			opts:     Options{DiffMode: DiffModeGray},
+			ramp:     func(t float64) color.RGBA { v := uint8(t * 255); return color.RGBA{v, v, v, 255} },
+			wantSize: image.Pt(200, 20+legendHeight),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left := createTestImage(tt.width, 20, color.RGBA{10, 20, 30, 255})
+			result, err := Compare(left, left, tt.opts)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			img := result.WithLegend(result.Image)
+			if got := img.Bounds().Size(); got != tt.wantSize {
+				t.Fatalf("%s: size got %v, want %v", tt.name, got, tt.wantSize)
+			}
+			if got := img.At(0, 0); got != result.Image.At(0, 0) {
+				t.Errorf("%s: image pixel got %v, want %v", tt.name, got, result.Image.At(0, 0))
+			}
+
+			// The bar runs from the color of no difference to the saturated color
+			barY := 20 + legendPad
+			first, last := legendPad, tt.wantSize.X-legendPad-1
+			if got := img.At(first, barY); got != tt.ramp(0) {
+				t.Errorf("%s: bar start got %v, want %v", tt.name, got, tt.ramp(0))
+			}
+			if got := img.At(last, barY); got != tt.ramp(1) {
+				t.Errorf("%s: bar end got %v, want %v", tt.name, got, tt.ramp(1))
+			}
+
+			// Labels are drawn in white on black
+			labels := 0
+			for y := barY + legendBarHeight + 2; y < tt.wantSize.Y; y++ {
+				for x := range tt.wantSize.X {
+					if img.At(x, y) == white {
+						labels++
+					}
+				}
+			}
+			if labels == 0 {
+				t.Errorf("%s: no label pixels", tt.name)
+			}
+		})
+	}
+
+	// Modes without a single magnitude have no legend
+	left := createTestImage(4, 4, color.RGBA{10, 20, 30, 255})
+	for _, mode := range []DiffMode{DiffModeColor, DiffModeBW, DiffModeOverlay} {
+		if mode.HasLegend() {
+			t.Errorf("%s: HasLegend got true", mode)
+		}
+		result, err := Compare(left, left, Options{DiffMode: mode})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", mode, err)
+		}
+		if got := result.WithLegend(result.Image); got != result.Image {
+			t.Errorf("%s: WithLegend changed the image", mode)
+		}
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	for s, want := range map[string]int{"": 0, "0": 6, "1.28e+03": 62} {
+		if got := textWidth(s); got != want {
+			t.Errorf("textWidth(%q): got %d, want %d", s, got, want)
+		}
+	}
+	for _, ch := range "0123456789.e+-" {
+		if _, ok := glyphs[ch]; !ok {
+			t.Errorf("missing glyph %q", ch)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Colors of the diagonal hatching drawn over ignored pixels
+var (
+	hatchLight = color.RGBA{96, 96, 96, 255}
+	hatchDark  = color.RGBA{32, 32, 32, 255}
+)
+
+// buildIgnoreMask combines opts.Ignore and opts.Mask, and the complement of
+// opts.Regions and opts.RegionMask, into an alpha mask over bounds, opaque
+// where pixels are ignored. It returns nil if nothing is ignored.
+func buildIgnoreMask(bounds image.Rectangle, opts Options) *image.Alpha {
+	restricted := len(opts.Regions) > 0 || opts.RegionMask != nil
+	if !restricted && len(opts.Ignore) == 0 && opts.Mask == nil {
+		return nil
+	}
+
+	mask := image.NewAlpha(bounds)
+	if restricted {
+		// Ignore everything, then clear the selected regions
+		draw.Draw(mask, bounds, image.Opaque, image.Point{}, draw.Src)
+		for _, r := range opts.Regions {
+			draw.Draw(mask, r.Rect.Intersect(bounds), image.Transparent, image.Point{}, draw.Src)
+		}
+		if opts.RegionMask != nil {
+			applyMaskImage(mask, opts.RegionMask, color.Alpha{0})
+		}
+	}
+	for _, r := range opts.Ignore {
+		draw.Draw(mask, r.Intersect(bounds), image.Opaque, image.Point{}, draw.Src)
+	}
+	if opts.Mask != nil {
+		applyMaskImage(mask, opts.Mask, color.Alpha{255})
+	}
+	return mask
+}
+
+// applyMaskImage sets the pixels of dst under the masked pixels of src, whose
+// origin is aligned with the origin of dst, to a.
+func applyMaskImage(dst *image.Alpha, src image.Image, a color.Alpha) {
+	bounds, srcBounds := dst.Bounds(), src.Bounds()
+	offset := srcBounds.Min.Sub(bounds.Min)
+	forEachChunk(bounds.Intersect(srcBounds.Sub(offset)), func(c Chunk) {
+		for y := c.startY; y < c.endY; y++ {
+			for x := c.startX; x < c.endX; x++ {
+				if isMasked(src.At(x+offset.X, y+offset.Y)) {
+					dst.SetAlpha(x, y, a)
+				}
+			}
+		}
+	})
+}
+
+// isMasked reports whether a mask pixel marks its pixel as ignored: light,
+// opaque pixels are ignored, dark or transparent ones are compared.
+func isMasked(c color.Color) bool {
+	r, g, b, _ := c.RGBA() // Alpha-premultiplied, so transparent reads as black
+	return (r+g+b)/3 >= 0x8000
+}
+
+// ignored reports whether the pixel at (x, y) is excluded from the comparison.
+func ignored(mask *image.Alpha, x, y int) bool {
+	return mask != nil && mask.AlphaAt(x, y).A != 0
+}
+
+// hatchColor returns the hatching color for ignored pixel (x, y).
+func hatchColor(x, y int) color.RGBA {
+	if (x+y)%8 < 2 {
+		return hatchLight
+	}
+	return hatchDark
+}
+
+// hatchIgnored draws diagonal hatching over the ignored pixels of img.
+func hatchIgnored(img draw.Image, mask *image.Alpha) {
+	if mask == nil {
+		return
+	}
+	forEachChunk(img.Bounds().Intersect(mask.Bounds()), func(c Chunk) {
+		for y := c.startY; y < c.endY; y++ {
+			for x := c.startX; x < c.endX; x++ {
+				if ignored(mask, x, y) {
+					img.Set(x, y, hatchColor(x, y))
+				}
+			}
+		}
+	})
+}
+
+// dimIgnored blends hatching at 50% over the ignored pixels of panel, a
+// region of img whose pixels correspond to the mask starting at origin.
+func dimIgnored(img draw.Image, panel image.Rectangle, mask *image.Alpha, origin image.Point) {
+	rgba, is8bit := img.(*image.RGBA)
+	for y := panel.Min.Y; y < panel.Max.Y; y++ {
+		for x := panel.Min.X; x < panel.Max.X; x++ {
+			mx, my := origin.X+x-panel.Min.X, origin.Y+y-panel.Min.Y
+			if !ignored(mask, mx, my) {
+				continue
+			}
+			h := hatchColor(mx, my)
+			if is8bit {
+				c := rgba.RGBAAt(x, y)
+				rgba.SetRGBA(x, y, color.RGBA{
+					R: uint8((uint16(c.R) + uint16(h.R)) / 2),
+					G: uint8((uint16(c.G) + uint16(h.G)) / 2),
+					B: uint8((uint16(c.B) + uint16(h.B)) / 2),
+					A: 255,
+				})
+				continue
+			}
+			r, g, b, _ := img.At(x, y).RGBA()
+			img.Set(x, y, color.RGBA64{
+				R: uint16((r + uint32(h.R)*257) / 2),
+				G: uint16((g + uint32(h.G)*257) / 2),
+				B: uint16((b + uint32(h.B)*257) / 2),
+				A: 0xffff,
+			})
+		}
+	}
+}
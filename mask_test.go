@@ -0,0 +1,153 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCompareIgnore(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	left := createTestImage(8, 8, gray)
+
+	// Right differs in a 2x2 block at (1, 1) and a single pixel at (6, 6)
+	right := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			right.Set(x, y, gray)
+		}
+	}
+	for _, p := range []image.Point{{1, 1}, {2, 1}, {1, 2}, {2, 2}, {6, 6}} {
+		right.Set(p.X, p.Y, color.RGBA{200, 100, 100, 255})
+	}
+
+	mask := image.NewGray(image.Rect(0, 0, 8, 8))
+	mask.SetGray(6, 6, color.Gray{255})
+	mask.SetGray(0, 0, color.Gray{100}) // Too dark to be ignored
+
+	tests := []struct {
+		name          string
+		opts          Options
+		wantIgnored   int64
+		wantDiffCount int64
+		wantDiffRect  image.Rectangle
+	}{
+		{
+			name:          "No Ignore",
+			wantDiffCount: 5,
+			wantDiffRect:  image.Rect(1, 1, 7, 7),
+		},
+		{
+			name:          "Ignore Rectangle",
+			opts:          Options{Ignore: []image.Rectangle{image.Rect(0, 0, 4, 4)}},
+			wantIgnored:   16,
+			wantDiffCount: 1,
+			wantDiffRect:  image.Rect(6, 6, 7, 7),
+		},
+		{
+			name:          "Ignore Rectangle Clipped",
+			opts:          Options{Ignore: []image.Rectangle{image.Rect(5, 5, 20, 20)}},
+			wantIgnored:   9,
+			wantDiffCount: 4,
+			wantDiffRect:  image.Rect(1, 1, 3, 3),
+		},
+		{
+			name:          "Mask",
+			opts:          Options{Mask: mask},
+			wantIgnored:   1,
+			wantDiffCount: 4,
+			wantDiffRect:  image.Rect(1, 1, 3, 3),
+		},
+		{
+			name: "Rectangle And Mask",
+			opts: Options{
+				Ignore: []image.Rectangle{image.Rect(1, 1, 3, 3)},
+				Mask:   mask,
+			},
+			wantIgnored:   5,
+			wantDiffCount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Compare(left, right, tt.opts)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			if res.Ignored != tt.wantIgnored {
+				t.Errorf("%s: Ignored got %d, want %d", tt.name, res.Ignored, tt.wantIgnored)
+			}
+			if res.DiffCount != tt.wantDiffCount {
+				t.Errorf("%s: DiffCount got %d, want %d", tt.name, res.DiffCount, tt.wantDiffCount)
+			}
+			if res.DiffBounds != tt.wantDiffRect {
+				t.Errorf("%s: DiffBounds got %v, want %v", tt.name, res.DiffBounds, tt.wantDiffRect)
+			}
+			wantPercent := float64(tt.wantDiffCount) * 100 / float64(64-tt.wantIgnored)
+			if !approxEqual(res.DiffPercent, wantPercent, 1e-9) {
+				t.Errorf("%s: DiffPercent got %f, want %f", tt.name, res.DiffPercent, wantPercent)
+			}
+			if (res.IgnoreMask != nil) != (tt.wantIgnored > 0) {
+				t.Errorf("%s: IgnoreMask got %v, want set %v", tt.name, res.IgnoreMask != nil, tt.wantIgnored > 0)
+			}
+		})
+	}
+}
+
+func TestCompareIgnoreRendering(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	left := createTestImage(8, 8, gray)
+	right := createTestImage(8, 8, color.RGBA{200, 100, 100, 255})
+
+	res, err := Compare(left, right, Options{Ignore: []image.Rectangle{image.Rect(0, 0, 4, 8)}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.DiffCount != 32 {
+		t.Errorf("DiffCount got %d, want 32", res.DiffCount)
+	}
+
+	// Ignored pixels are hatched, compared ones carry the scaled difference
+	for _, p := range []image.Point{{0, 0}, {1, 0}, {3, 7}} {
+		if got, want := res.Image.At(p.X, p.Y), hatchColor(p.X, p.Y); got != want {
+			t.Errorf("diff pixel %v got %v, want hatching %v", p, got, want)
+		}
+	}
+	if got, want := res.Image.At(5, 5), (color.RGBA{200, 0, 0, 255}); got != want {
+		t.Errorf("diff pixel (5, 5) got %v, want %v", got, want)
+	}
+
+	// The composite dims the ignored regions of both input panels only
+	composite := res.Composite().(*image.RGBA)
+	h := hatchColor(0, 0)
+	if got, want := composite.RGBAAt(0, 0), (color.RGBA{(100 + h.R) / 2, (100 + h.G) / 2, (100 + h.B) / 2, 255}); got != want {
+		t.Errorf("left panel pixel (0, 0) got %v, want %v", got, want)
+	}
+	if got := composite.RGBAAt(5, 5); got != gray {
+		t.Errorf("left panel pixel (5, 5) got %v, want %v", got, gray)
+	}
+	if got, want := composite.RGBAAt(16, 0).R, uint8((200+uint16(h.R))/2); got != want {
+		t.Errorf("right panel pixel (0, 0) red got %d, want %d", got, want)
+	}
+}
+
+func TestCompareIgnoreIntersect(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	res, err := Compare(createTestImage(4, 6, gray), createTestImage(4, 4, gray), Options{
+		SizePolicy: SizePolicyIntersect,
+		Ignore:     []image.Rectangle{image.Rect(0, 5, 4, 6)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.DiffCount != 4 || res.Ignored != 4 {
+		t.Errorf("got DiffCount %d Ignored %d, want 4 and 4", res.DiffCount, res.Ignored)
+	}
+	if want := image.Rect(0, 4, 4, 5); res.DiffBounds != want {
+		t.Errorf("DiffBounds got %v, want %v", res.DiffBounds, want)
+	}
+	if !approxEqual(res.DiffPercent, 20, 1e-9) {
+		t.Errorf("DiffPercent got %f, want 20", res.DiffPercent)
+	}
+}
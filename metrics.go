@@ -0,0 +1,69 @@
+package imagediff
+
+import "math"
+
+// ErrorMetrics holds error metrics in 8-bit units. PSNR is in decibels
+// relative to a peak value of 255 and is +Inf for identical inputs.
+type ErrorMetrics struct {
+	MSE  float64 // Mean squared error
+	RMSE float64 // Root mean squared error
+	PSNR float64 // Peak signal-to-noise ratio
+	MAE  float64 // Mean absolute error
+}
+
+// relativeEpsilon keeps relative errors finite where the left image is black.
+const relativeEpsilon = 0.01
+
+// RelativeMetrics holds errors relative to the left image over the R, G and
+// B channels, with values in [0, 1] (linear values of a FloatImage). Each
+// difference is divided by the left value plus 0.01, or for RelMSE its
+// square by the squared left value plus 0.01, so that errors in dark areas
+// count as much as those in bright highlights.
+type RelativeMetrics struct {
+	MeanRelError float64 // Mean relative absolute error
+	MaxRelError  float64 // Largest relative absolute error
+	RelMSE       float64 // Relative mean squared error
+}
+
+// Metrics holds error metrics per channel and over the color channels
+// combined. They are computed from the raw pixel values, even when
+// Options.Normalized is set.
+type Metrics struct {
+	R, G, B, A ErrorMetrics
+	Overall    ErrorMetrics    // Over R, G and B
+	Relative   RelativeMetrics // Over R, G and B
+}
+
+func newErrorMetrics(sumAbs, sumSq, n float64) ErrorMetrics {
+	mse := sumSq / n
+	return ErrorMetrics{
+		MSE:  mse,
+		RMSE: math.Sqrt(mse),
+		PSNR: psnr(mse),
+		MAE:  sumAbs / n,
+	}
+}
+
+// psnr converts a mean squared error in 8-bit units to decibels.
+func psnr(mse float64) float64 {
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+func computeMetrics(total chunkStats, numPixels float64) Metrics {
+	sumAbs, sumSq := total.sumAbs, total.sumSq
+	return Metrics{
+		R:       newErrorMetrics(sumAbs.R, sumSq.R, numPixels),
+		G:       newErrorMetrics(sumAbs.G, sumSq.G, numPixels),
+		B:       newErrorMetrics(sumAbs.B, sumSq.B, numPixels),
+		A:       newErrorMetrics(sumAbs.A, sumSq.A, numPixels),
+		Overall: newErrorMetrics(sumAbs.R+sumAbs.G+sumAbs.B, sumSq.R+sumSq.G+sumSq.B, 3*numPixels),
+		Relative: RelativeMetrics{
+			MeanRelError: total.sumRel / (3 * numPixels),
+			MaxRelError:  total.maxRel,
+			RelMSE:       total.sumRelSq / (3 * numPixels),
+		},
+	}
+}
@@ -0,0 +1,52 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	img1 := createTestImage(10, 10, color.RGBA{100, 100, 100, 255})
+	img2 := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(img2, img2.Bounds(), img1, image.Point{}, draw.Src)
+	img2.Set(4, 4, color.RGBA{140, 100, 100, 255})
+
+	tests := []struct {
+		name       string
+		normalized bool
+	}{
+		{name: "Raw", normalized: false},
+		{name: "Normalized", normalized: true}, // Metrics ignore normalization
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Compare(img1, img2, Options{Normalized: tt.normalized})
+			if err != nil {
+				t.Fatalf("%s: Compare: %v", tt.name, err)
+			}
+			m := res.Metrics
+			if !approxEqual(m.R.MSE, 16, 1e-9) || !approxEqual(m.R.RMSE, 4, 1e-9) || !approxEqual(m.R.MAE, 0.4, 1e-9) {
+				t.Errorf("%s: R got %+v, want MSE 16, RMSE 4, MAE 0.4", tt.name, m.R)
+			}
+			if want := 10 * math.Log10(255*255/16.0); !approxEqual(m.R.PSNR, want, 1e-9) {
+				t.Errorf("%s: R.PSNR got %v, want %v", tt.name, m.R.PSNR, want)
+			}
+			if !math.IsInf(m.G.PSNR, 1) || m.G.MSE != 0 {
+				t.Errorf("%s: G got %+v, want MSE 0 and PSNR +Inf", tt.name, m.G)
+			}
+			if !approxEqual(m.Overall.MSE, 1600.0/300, 1e-9) || !approxEqual(m.Overall.MAE, 40.0/300, 1e-9) {
+				t.Errorf("%s: Overall got %+v, want MSE %v, MAE %v", tt.name, m.Overall, 1600.0/300, 40.0/300)
+			}
+			// One red value of 100/255 off by 40/255
+			rel := (40.0 / 255) / (100.0/255 + 0.01)
+			relSq := (40.0 / 255) * (40.0 / 255) / ((100.0/255)*(100.0/255) + 0.01)
+			if !approxEqual(m.Relative.MaxRelError, rel, 1e-9) || !approxEqual(m.Relative.MeanRelError, rel/300, 1e-9) || !approxEqual(m.Relative.RelMSE, relSq/300, 1e-9) {
+				t.Errorf("%s: Relative got %+v, want max %v, mean %v, RelMSE %v", tt.name, m.Relative, rel, rel/300, relSq/300)
+			}
+		})
+	}
+}
@@ -0,0 +1,458 @@
+package imagediff
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// NetpbmFormat selects the Netpbm variant written by EncodeNetpbm.
+type NetpbmFormat string
+
+const (
+	NetpbmPGM NetpbmFormat = "pgm" // Grayscale (P5, or P2 when plain)
+	NetpbmPPM NetpbmFormat = "ppm" // RGB (P6, or P3 when plain)
+	NetpbmPAM NetpbmFormat = "pam" // Grayscale, RGB or RGB with alpha (P7)
+)
+
+// ParseNetpbmFormat converts a Netpbm format name to a NetpbmFormat.
+func ParseNetpbmFormat(s string) (NetpbmFormat, error) {
+	switch format := NetpbmFormat(s); format {
+	case NetpbmPGM, NetpbmPPM, NetpbmPAM:
+		return format, nil
+	}
+	return "", fmt.Errorf("invalid Netpbm format %q", s)
+}
+
+// NetpbmOptions configures EncodeNetpbm.
+type NetpbmOptions struct {
+	// Format is the variant written. Empty selects NetpbmPAM.
+	Format NetpbmFormat
+	// Plain writes ASCII samples (P2 or P3) instead of binary ones. PAM has
+	// no plain variant.
+	Plain bool
+}
+
+// maxNetpbmSamples bounds the raster size accepted by the Netpbm decoder, so
+// that a corrupt header cannot trigger a huge allocation.
+const maxNetpbmSamples = 1 << 30
+
+var errNetpbmFormat = errors.New("imagediff: invalid Netpbm image")
+
+func init() {
+	for _, f := range []struct{ name, magic string }{
+		{"pbm", "P1"}, {"pbm", "P4"},
+		{"pgm", "P2"}, {"pgm", "P5"},
+		{"ppm", "P3"}, {"ppm", "P6"},
+		{"pam", "P7"},
+	} {
+		image.RegisterFormat(f.name, f.magic, DecodeNetpbm, DecodeNetpbmConfig)
+	}
+}
+
+// netpbmHeader describes the raster of a Netpbm image.
+type netpbmHeader struct {
+	magic  byte // Digit after the P: 1-3 plain, 4-6 binary, 7 PAM
+	width  int
+	height int
+	depth  int // Samples per pixel
+	maxval int // Largest sample value; 1 for bitmaps
+}
+
+// plain reports whether the samples are ASCII numbers.
+func (h *netpbmHeader) plain() bool { return h.magic <= '3' }
+
+// deep reports whether the image needs 16 bits per sample.
+func (h *netpbmHeader) deep() bool { return h.maxval > 255 }
+
+// colorModel returns the color model of the decoded image.
+func (h *netpbmHeader) colorModel() color.Model {
+	switch {
+	case h.depth == 1 && h.deep():
+		return color.Gray16Model
+	case h.depth == 1:
+		return color.GrayModel
+	case h.depth == 3 && h.deep():
+		return color.RGBA64Model
+	case h.depth == 3:
+		return color.RGBAModel
+	case h.deep():
+		return color.NRGBA64Model
+	}
+	return color.NRGBAModel // With alpha
+}
+
+// DecodeNetpbm reads a PBM, PGM, PPM or PAM image in the plain or binary
+// variant. Samples are scaled from the image's maxval to the full range: 8-bit
+// images decode to *image.Gray, *image.RGBA or, with alpha, *image.NRGBA, and
+// images with a maxval above 255 to their 16-bit counterparts.
+func DecodeNetpbm(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readNetpbmHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	return readNetpbmRaster(br, h)
+}
+
+// DecodeNetpbmConfig returns the color model and dimensions of a Netpbm
+// image without decoding the raster.
+func DecodeNetpbmConfig(r io.Reader) (image.Config, error) {
+	h, err := readNetpbmHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: h.colorModel(), Width: h.width, Height: h.height}, nil
+}
+
+// readNetpbmHeader parses the header up to and including the single
+// whitespace character that precedes the raster.
+func readNetpbmHeader(br *bufio.Reader) (*netpbmHeader, error) {
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, err
+	}
+	if magic[0] != 'P' || magic[1] < '1' || magic[1] > '7' {
+		return nil, errNetpbmFormat
+	}
+	h := &netpbmHeader{magic: magic[1]}
+	if h.magic == '7' {
+		if err := readPAMHeader(br, h); err != nil {
+			return nil, err
+		}
+	} else {
+		fields := []*int{&h.width, &h.height, &h.maxval}
+		h.maxval, h.depth = 1, 1
+		switch h.magic {
+		case '1', '4':
+			fields = fields[:2] // Bitmaps have no maxval
+		case '3', '6':
+			h.depth = 3
+		}
+		for _, f := range fields {
+			tok, err := readNetpbmToken(br)
+			if err != nil {
+				return nil, err
+			}
+			if *f, err = strconv.Atoi(tok); err != nil {
+				return nil, fmt.Errorf("%w: %q in header", errNetpbmFormat, tok)
+			}
+		}
+	}
+
+	switch {
+	case h.width <= 0 || h.height <= 0:
+		return nil, fmt.Errorf("%w: size %dx%d", errNetpbmFormat, h.width, h.height)
+	case h.depth < 1 || h.depth > 4:
+		return nil, fmt.Errorf("%w: unsupported depth %d", errNetpbmFormat, h.depth)
+	case h.maxval < 1 || h.maxval > 65535:
+		return nil, fmt.Errorf("%w: maxval %d", errNetpbmFormat, h.maxval)
+	case int64(h.width)*int64(h.height)*int64(h.depth) > maxNetpbmSamples:
+		return nil, fmt.Errorf("%w: image too large", errNetpbmFormat)
+	}
+	return h, nil
+}
+
+// readPAMHeader parses the "KEY value" lines of a PAM header up to ENDHDR.
+// The tuple type is not needed to decode the samples and is ignored.
+func readPAMHeader(br *bufio.Reader, h *netpbmHeader) error {
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("%w: unterminated PAM header", errNetpbmFormat)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		var field *int
+		switch fields[0] {
+		case "ENDHDR":
+			return nil
+		case "WIDTH":
+			field = &h.width
+		case "HEIGHT":
+			field = &h.height
+		case "DEPTH":
+			field = &h.depth
+		case "MAXVAL":
+			field = &h.maxval
+		default:
+			continue // TUPLTYPE and unknown keys
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("%w: %q in PAM header", errNetpbmFormat, strings.TrimSpace(line))
+		}
+		if *field, err = strconv.Atoi(fields[1]); err != nil {
+			return fmt.Errorf("%w: %q in PAM header", errNetpbmFormat, strings.TrimSpace(line))
+		}
+	}
+}
+
+// readNetpbmToken returns the next whitespace-separated token, skipping
+// comments from # to the end of the line, and consumes the single whitespace
+// character that ends it.
+func readNetpbmToken(br *bufio.Reader) (string, error) {
+	var tok []byte
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(tok) > 0 {
+				return string(tok), nil
+			}
+			return "", fmt.Errorf("%w: truncated", errNetpbmFormat)
+		}
+		switch {
+		case c == '#' && len(tok) == 0:
+			if _, err := br.ReadString('\n'); err != nil {
+				return "", fmt.Errorf("%w: truncated", errNetpbmFormat)
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f':
+			if len(tok) > 0 {
+				return string(tok), nil
+			}
+		default:
+			tok = append(tok, c)
+		}
+	}
+}
+
+// readNetpbmRaster decodes the samples following the header.
+func readNetpbmRaster(br *bufio.Reader, h *netpbmHeader) (image.Image, error) {
+	rect := image.Rect(0, 0, h.width, h.height)
+	var img draw.Image
+	switch h.colorModel() {
+	case color.Gray16Model:
+		img = image.NewGray16(rect)
+	case color.GrayModel:
+		img = image.NewGray(rect)
+	case color.RGBA64Model:
+		img = image.NewRGBA64(rect)
+	case color.RGBAModel:
+		img = image.NewRGBA(rect)
+	case color.NRGBA64Model:
+		img = image.NewNRGBA64(rect)
+	default:
+		img = image.NewNRGBA(rect)
+	}
+
+	full := 255
+	if h.deep() {
+		full = 65535
+	}
+	row := make([]int, h.width*h.depth)
+	for y := range h.height {
+		if err := readNetpbmRow(br, h, row); err != nil {
+			return nil, err
+		}
+		// Scale from maxval to the full range of the color model
+		for i, v := range row {
+			if v > h.maxval {
+				return nil, fmt.Errorf("%w: sample %d above maxval %d", errNetpbmFormat, v, h.maxval)
+			}
+			row[i] = (v*full + h.maxval/2) / h.maxval
+		}
+		for x := range h.width {
+			s := row[x*h.depth : (x+1)*h.depth]
+			var c color.Color
+			switch {
+			case h.depth == 1 && h.deep():
+				c = color.Gray16{uint16(s[0])}
+			case h.depth == 1:
+				c = color.Gray{uint8(s[0])}
+			case h.depth == 2 && h.deep():
+				c = color.NRGBA64{uint16(s[0]), uint16(s[0]), uint16(s[0]), uint16(s[1])}
+			case h.depth == 2:
+				c = color.NRGBA{uint8(s[0]), uint8(s[0]), uint8(s[0]), uint8(s[1])}
+			case h.depth == 3 && h.deep():
+				c = color.RGBA64{uint16(s[0]), uint16(s[1]), uint16(s[2]), 0xffff}
+			case h.depth == 3:
+				c = color.RGBA{uint8(s[0]), uint8(s[1]), uint8(s[2]), 0xff}
+			case h.deep():
+				c = color.NRGBA64{uint16(s[0]), uint16(s[1]), uint16(s[2]), uint16(s[3])}
+			default:
+				c = color.NRGBA{uint8(s[0]), uint8(s[1]), uint8(s[2]), uint8(s[3])}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img, nil
+}
+
+// readNetpbmRow reads the samples of one row into row.
+func readNetpbmRow(br *bufio.Reader, h *netpbmHeader, row []int) error {
+	truncated := fmt.Errorf("%w: truncated raster", errNetpbmFormat)
+	switch {
+	case h.magic == '1':
+		// Plain bitmap digits need not be separated; 1 is black
+		for i := range row {
+			c, err := br.ReadByte()
+			for err == nil && c != '0' && c != '1' {
+				if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != '\v' && c != '\f' {
+					return fmt.Errorf("%w: %q in bitmap", errNetpbmFormat, c)
+				}
+				c, err = br.ReadByte()
+			}
+			if err != nil {
+				return truncated
+			}
+			row[i] = int('1' - c)
+		}
+	case h.plain():
+		for i := range row {
+			tok, err := readNetpbmToken(br)
+			if err != nil {
+				return truncated
+			}
+			if row[i], err = strconv.Atoi(tok); err != nil || row[i] < 0 {
+				return fmt.Errorf("%w: sample %q", errNetpbmFormat, tok)
+			}
+		}
+	case h.magic == '4':
+		// Packed bits, most significant first, each row padded to a byte
+		buf := make([]byte, (h.width+7)/8)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return truncated
+		}
+		for i := range row {
+			row[i] = 1 - int(buf[i/8]>>(7-i%8)&1)
+		}
+	case h.deep():
+		buf := make([]byte, 2*len(row))
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return truncated
+		}
+		for i := range row {
+			row[i] = int(buf[2*i])<<8 | int(buf[2*i+1])
+		}
+	default:
+		buf := make([]byte, len(row))
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return truncated
+		}
+		for i := range row {
+			row[i] = int(buf[i])
+		}
+	}
+	return nil
+}
+
+// EncodeNetpbm writes img as a PGM, PPM or PAM image. Images with a 16-bit
+// color model are written with a maxval of 65535, others with 255. PGM stores
+// the luminance and PPM the color composited over black; PAM stores
+// grayscale images as GRAYSCALE, opaque images as RGB and others as
+// RGB_ALPHA with straight alpha.
+func EncodeNetpbm(w io.Writer, img image.Image, opts NetpbmOptions) error {
+	format := opts.Format
+	if format == "" {
+		format = NetpbmPAM
+	}
+	if _, err := ParseNetpbmFormat(string(format)); err != nil {
+		return err
+	}
+	if opts.Plain && format == NetpbmPAM {
+		return errors.New("imagediff: PAM has no plain variant")
+	}
+
+	b := img.Bounds()
+	maxval := 255
+	switch img.ColorModel() {
+	case color.Gray16Model, color.RGBA64Model, color.NRGBA64Model:
+		maxval = 65535
+	}
+	gray := img.ColorModel() == color.GrayModel || img.ColorModel() == color.Gray16Model
+
+	// Samples per pixel and the function extracting them as 16-bit values
+	var depth int
+	var samples func(c color.Color, s []uint16)
+	switch {
+	case format == NetpbmPGM || (format == NetpbmPAM && gray):
+		depth = 1
+		samples = func(c color.Color, s []uint16) { s[0] = color.Gray16Model.Convert(c).(color.Gray16).Y }
+	case format == NetpbmPPM || (format == NetpbmPAM && isOpaque(img)):
+		depth = 3
+		samples = func(c color.Color, s []uint16) {
+			r, g, b, _ := c.RGBA()
+			s[0], s[1], s[2] = uint16(r), uint16(g), uint16(b)
+		}
+	default:
+		depth = 4
+		samples = func(c color.Color, s []uint16) {
+			n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+			s[0], s[1], s[2], s[3] = n.R, n.G, n.B, n.A
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	switch {
+	case format == NetpbmPAM:
+		tupleType := map[int]string{1: "GRAYSCALE", 3: "RGB", 4: "RGB_ALPHA"}[depth]
+		fmt.Fprintf(bw, "P7\nWIDTH %d\nHEIGHT %d\nDEPTH %d\nMAXVAL %d\nTUPLTYPE %s\nENDHDR\n", b.Dx(), b.Dy(), depth, maxval, tupleType)
+	default:
+		magic := map[NetpbmFormat]int{NetpbmPGM: 5, NetpbmPPM: 6}[format]
+		if opts.Plain {
+			magic -= 3
+		}
+		fmt.Fprintf(bw, "P%d\n%d %d\n%d\n", magic, b.Dx(), b.Dy(), maxval)
+	}
+
+	s := make([]uint16, depth)
+	lineLen := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			samples(img.At(x, y), s)
+			for _, v := range s {
+				v := int(v)
+				if maxval == 255 {
+					v >>= 8
+				}
+				switch {
+				case opts.Plain:
+					// Plain lines should not exceed 70 characters
+					tok := strconv.Itoa(v)
+					if lineLen > 0 && lineLen+1+len(tok) > 70 {
+						bw.WriteByte('\n')
+						lineLen = 0
+					} else if lineLen > 0 {
+						bw.WriteByte(' ')
+						lineLen++
+					}
+					bw.WriteString(tok)
+					lineLen += len(tok)
+				case maxval == 255:
+					bw.WriteByte(byte(v))
+				default:
+					bw.WriteByte(byte(v >> 8))
+					bw.WriteByte(byte(v))
+				}
+			}
+		}
+		if opts.Plain {
+			bw.WriteByte('\n')
+			lineLen = 0
+		}
+	}
+	return bw.Flush()
+}
+
+// isOpaque reports whether every pixel of img is fully opaque.
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,188 @@
+package imagediff
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestDecodeNetpbm(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format string
+		model  color.Model
+		want   map[image.Point]color.Color
+	}{
+		{
+			name:   "Plain Bitmap Without Separators",
+			data:   "P1\n# comment\n3 2\n010\n1 1 0\n",
+			format: "pbm",
+			model:  color.GrayModel,
+			want:   map[image.Point]color.Color{{0, 0}: color.Gray{255}, {1, 0}: color.Gray{0}, {2, 1}: color.Gray{255}},
+		},
+		{
+			name:   "Binary Bitmap",
+			data:   "P4 10 1\n\x80\x40",
+			format: "pbm",
+			model:  color.GrayModel,
+			want:   map[image.Point]color.Color{{0, 0}: color.Gray{0}, {1, 0}: color.Gray{255}, {9, 0}: color.Gray{0}},
+		},
+		{
+			name:   "Plain Graymap Maxval 15",
+			data:   "P2 2 1 15 # comment\n0 15\n",
+			format: "pgm",
+			model:  color.GrayModel,
+			want:   map[image.Point]color.Color{{0, 0}: color.Gray{0}, {1, 0}: color.Gray{255}},
+		},
+		{
+			name:   "Binary Graymap 16-bit",
+			data:   "P5\n1 1\n65535\n\x12\x34",
+			format: "pgm",
+			model:  color.Gray16Model,
+			want:   map[image.Point]color.Color{{0, 0}: color.Gray16{0x1234}},
+		},
+		{
+			name:   "Plain Pixmap",
+			data:   "P3\n2 1\n255\n255 0 0  0 128 255\n",
+			format: "ppm",
+			model:  color.RGBAModel,
+			want:   map[image.Point]color.Color{{0, 0}: color.RGBA{255, 0, 0, 255}, {1, 0}: color.RGBA{0, 128, 255, 255}},
+		},
+		{
+			name:   "Binary Pixmap 16-bit Maxval 1023",
+			data:   "P6 1 1 1023\n\x03\xff\x00\x00\x02\x00",
+			format: "ppm",
+			model:  color.RGBA64Model,
+			want:   map[image.Point]color.Color{{0, 0}: color.RGBA64{0xffff, 0, 0x8020, 0xffff}},
+		},
+		{
+			name:   "PAM RGB Alpha",
+			data:   "P7\nWIDTH 2\nHEIGHT 1\n# comment\nDEPTH 4\nMAXVAL 255\nTUPLTYPE RGB_ALPHA\nENDHDR\n\x0a\x14\x1e\x80\x01\x02\x03\xff",
+			format: "pam",
+			model:  color.NRGBAModel,
+			want:   map[image.Point]color.Color{{0, 0}: color.NRGBA{10, 20, 30, 128}, {1, 0}: color.NRGBA{1, 2, 3, 255}},
+		},
+		{
+			name:   "PAM Grayscale Alpha 16-bit",
+			data:   "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 2\nMAXVAL 65535\nTUPLTYPE GRAYSCALE_ALPHA\nENDHDR\n\x10\x00\xff\xff",
+			format: "pam",
+			model:  color.NRGBA64Model,
+			want:   map[image.Point]color.Color{{0, 0}: color.NRGBA64{0x1000, 0x1000, 0x1000, 0xffff}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, format, err := image.Decode(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			if format != tt.format || img.ColorModel() != tt.model {
+				t.Errorf("%s: got format %q, model %v, want %q", tt.name, format, img.ColorModel(), tt.format)
+			}
+			for p, want := range tt.want {
+				if got := img.At(p.X, p.Y); got != want {
+					t.Errorf("%s: pixel %v got %v, want %v", tt.name, p, got, want)
+				}
+			}
+			cfg, _, err := image.DecodeConfig(strings.NewReader(tt.data))
+			if err != nil || cfg.Width != img.Bounds().Dx() || cfg.Height != img.Bounds().Dy() || cfg.ColorModel != tt.model {
+				t.Errorf("%s: DecodeConfig got %+v, %v", tt.name, cfg, err)
+			}
+		})
+	}
+
+	for _, data := range []string{
+		"P2 1 1 15\n16\n",                  // Sample above maxval
+		"P6 2 2 255\n\x00\x00\x00",         // Truncated raster
+		"P5 0 1 255\n",                     // Empty image
+		"P5 1 1 70000\n\x00\x00",           // Maxval out of range
+		"P7\nWIDTH 1\nHEIGHT 1\nDEPTH 5\n", // Unterminated header
+		"P7\nWIDTH 1\nHEIGHT 1\nDEPTH 5\nMAXVAL 255\nENDHDR\n\x00\x00\x00\x00\x00", // Unsupported depth
+		"P3 1 1 255\n1 2 x\n", // Malformed sample
+		"P8 1 1 255\n\x00",    // Unknown magic
+	} {
+		if _, err := DecodeNetpbm(strings.NewReader(data)); !errors.Is(err, errNetpbmFormat) {
+			t.Errorf("DecodeNetpbm(%q): got %v, want %v", data, err, errNetpbmFormat)
+		}
+	}
+}
+
+func TestEncodeNetpbm(t *testing.T) {
+	rgba := image.NewRGBA(image.Rect(0, 0, 40, 3))
+	nrgba64 := image.NewNRGBA64(image.Rect(0, 0, 3, 2))
+	gray := image.NewGray(image.Rect(0, 0, 3, 2))
+	for y := range 3 {
+		for x := range 40 {
+			rgba.Set(x, y, color.RGBA{uint8(x * 6), uint8(y * 80), 200, 255})
+		}
+	}
+	for y := range 2 {
+		for x := range 3 {
+			nrgba64.Set(x, y, color.NRGBA64{uint16(x * 20000), 0x1234, uint16(y * 30000), uint16(0x8000 + x)})
+			gray.Set(x, y, color.Gray{uint8(x*100 + y)})
+		}
+	}
+
+	tests := []struct {
+		name   string
+		img    image.Image
+		opts   NetpbmOptions
+		header string
+		model  color.Model
+	}{
+		{"PAM RGB", rgba, NetpbmOptions{}, "P7\nWIDTH 40\nHEIGHT 3\nDEPTH 3\nMAXVAL 255\nTUPLTYPE RGB\n", color.RGBAModel},
+		{"PAM RGB Alpha 16-bit", nrgba64, NetpbmOptions{Format: NetpbmPAM}, "P7\nWIDTH 3\nHEIGHT 2\nDEPTH 4\nMAXVAL 65535\nTUPLTYPE RGB_ALPHA\n", color.NRGBA64Model},
+		{"PAM Grayscale", gray, NetpbmOptions{Format: NetpbmPAM}, "P7\nWIDTH 3\nHEIGHT 2\nDEPTH 1\nMAXVAL 255\nTUPLTYPE GRAYSCALE\n", color.GrayModel},
+		{"Binary PPM", rgba, NetpbmOptions{Format: NetpbmPPM}, "P6\n40 3\n255\n", color.RGBAModel},
+		{"Plain PPM", rgba, NetpbmOptions{Format: NetpbmPPM, Plain: true}, "P3\n40 3\n255\n", color.RGBAModel},
+		{"Binary PGM", gray, NetpbmOptions{Format: NetpbmPGM}, "P5\n3 2\n255\n", color.GrayModel},
+		{"Plain PGM 16-bit", nrgba64, NetpbmOptions{Format: NetpbmPGM, Plain: true}, "P2\n3 2\n65535\n", color.Gray16Model},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := EncodeNetpbm(&buf, tt.img, tt.opts); err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			if !strings.HasPrefix(buf.String(), tt.header) {
+				t.Errorf("%s: header got %q, want %q", tt.name, buf.String()[:min(buf.Len(), len(tt.header))], tt.header)
+			}
+			if tt.opts.Plain {
+				for _, line := range strings.Split(buf.String(), "\n") {
+					if len(line) > 70 {
+						t.Errorf("%s: plain line of %d characters", tt.name, len(line))
+					}
+				}
+			}
+
+			got, err := DecodeNetpbm(&buf)
+			if err != nil {
+				t.Fatalf("%s: decoding: %v", tt.name, err)
+			}
+			if got.ColorModel() != tt.model {
+				t.Errorf("%s: model got %v, want %v", tt.name, got.ColorModel(), tt.model)
+			}
+			b := tt.img.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if want := tt.model.Convert(tt.img.At(x, y)); got.At(x, y) != want {
+						t.Fatalf("%s: pixel (%d, %d) got %v, want %v", tt.name, x, y, got.At(x, y), want)
+					}
+				}
+			}
+		})
+	}
+
+	if err := EncodeNetpbm(&bytes.Buffer{}, gray, NetpbmOptions{Format: NetpbmPAM, Plain: true}); err == nil {
+		t.Error("plain PAM: got no error")
+	}
+	if err := EncodeNetpbm(&bytes.Buffer{}, gray, NetpbmOptions{Format: "pbm"}); err == nil {
+		t.Error("PBM: got no error")
+	}
+}
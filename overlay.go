@@ -0,0 +1,36 @@
+package imagediff
+
+import (
+	"image/color"
+)
+
+// DefaultHighlightColor paints differing pixels in DiffModeOverlay when
+// Options.HighlightColor is nil.
+var DefaultHighlightColor = color.RGBA{255, 0, 0, 255}
+
+const (
+	// overlayFade is the contrast kept from the left image in the faded
+	// background of DiffModeOverlay.
+	overlayFade = 0.3
+	// overlayMinIntensity is the weight of the highlight color on the
+	// smallest difference, so that every differing pixel stands out.
+	overlayMinIntensity = 0.4
+)
+
+// overlayLevels returns the channel levels, in 8-bit units, of a pixel of
+// DiffModeOverlay. The background is the luminance of the left pixel,
+// composited over white and faded toward white; r, g, b and a are its
+// premultiplied 8-bit values. A differing pixel is blended with highlight,
+// more strongly the larger diff*scale.
+func overlayLevels(r, g, b, a float64, differs bool, diff, scale float64, highlight color.NRGBA) (float64, float64, float64) {
+	luma := 0.299*r + 0.587*g + 0.114*b + (255 - a) // Over white
+	bg := 255 - (255-luma)*overlayFade
+	if !differs {
+		return bg, bg, bg
+	}
+	t := overlayMinIntensity + (1-overlayMinIntensity)*min(diff*scale/255, 1)
+	blend := func(h uint8) float64 {
+		return bg*(1-t) + float64(h)*t
+	}
+	return blend(highlight.R), blend(highlight.G), blend(highlight.B)
+}
@@ -0,0 +1,90 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCompareOverlay(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	faded := color.RGBA{208, 208, 208, 255} // 255 - (255-100)*0.3
+
+	// withPixel returns a 4x4 gray image with the pixel at (1, 1) set to c
+	withPixel := func(c color.Color) image.Image {
+		img := createTestImage(4, 4, gray).(*image.RGBA)
+		img.Set(1, 1, c)
+		return img
+	}
+
+	tests := []struct {
+		name  string
+		left  image.Image
+		right image.Image
+		opts  Options
+		want  map[image.Point]color.RGBA
+	}{
+		{
+			name:  "Unchanged Pixels Faded",
+			left:  createTestImage(4, 4, gray),
+			right: createTestImage(4, 4, gray),
+			want:  map[image.Point]color.RGBA{{0, 0}: faded, {3, 3}: faded},
+		},
+		{
+			name:  "Small Difference Highlighted",
+			left:  createTestImage(4, 4, gray),
+			right: withPixel(color.RGBA{101, 100, 100, 255}),
+			// 40% red over the background, plus 0.6% for the difference of 1 at scale 2
+			want: map[image.Point]color.RGBA{{0, 0}: faded, {1, 1}: {227, 124, 124, 255}},
+		},
+		{
+			name:  "Large Difference Saturated",
+			left:  createTestImage(4, 4, gray),
+			right: withPixel(color.RGBA{255, 100, 100, 255}),
+			want:  map[image.Point]color.RGBA{{1, 1}: {255, 0, 0, 255}},
+		},
+		{
+			name:  "Custom Highlight Color",
+			left:  createTestImage(4, 4, gray),
+			right: withPixel(color.RGBA{255, 100, 100, 255}),
+			opts:  Options{HighlightColor: color.RGBA{0, 0, 255, 255}},
+			want:  map[image.Point]color.RGBA{{1, 1}: {0, 0, 255, 255}},
+		},
+		{
+			name:  "Within Tolerance Not Highlighted",
+			left:  createTestImage(4, 4, gray),
+			right: withPixel(color.RGBA{101, 100, 100, 255}),
+			opts:  Options{Tolerance: 1},
+			want:  map[image.Point]color.RGBA{{1, 1}: faded},
+		},
+		{
+			name:  "Transparent Left Is White",
+			left:  createTestImage(4, 4, color.RGBA{}),
+			right: createTestImage(4, 4, color.RGBA{}),
+			want:  map[image.Point]color.RGBA{{2, 2}: {255, 255, 255, 255}},
+		},
+		{
+			name:  "Intersect Strips Highlighted",
+			left:  createTestImage(4, 4, gray),
+			right: createTestImage(4, 3, gray),
+			opts:  Options{SizePolicy: SizePolicyIntersect},
+			want:  map[image.Point]color.RGBA{{0, 0}: faded, {0, 3}: DefaultHighlightColor},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.DiffMode = DiffModeOverlay
+			result, err := Compare(tt.left, tt.right, opts)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			for p, want := range tt.want {
+				if got := result.Image.At(p.X, p.Y); got != want {
+					t.Errorf("%s: pixel %v got %v, want %v", tt.name, p, got, want)
+				}
+			}
+		})
+	}
+}
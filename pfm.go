@@ -0,0 +1,113 @@
+package imagediff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+)
+
+// maxFloatSamples bounds the raster size accepted by the float decoders, so
+// that a corrupt header cannot trigger a huge allocation.
+const maxFloatSamples = 1 << 28
+
+func init() {
+	image.RegisterFormat("pfm", "PF", DecodePFM, DecodePFMConfig)
+	image.RegisterFormat("pfm", "Pf", DecodePFM, DecodePFMConfig)
+}
+
+// pfmHeader describes the raster of a Portable FloatMap.
+type pfmHeader struct {
+	width, height int
+	channels      int // 3 for PF, 1 for Pf
+	order         binary.ByteOrder
+}
+
+// DecodePFM reads a Portable FloatMap (PF for RGB, Pf for grayscale) into an
+// opaque *FloatImage. The byte order follows the sign of the scale in the
+// header; its magnitude is ignored.
+func DecodePFM(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readPFMHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	img := NewFloatImage(image.Rect(0, 0, h.width, h.height))
+	row := make([]byte, 4*h.channels*h.width)
+	sample := func(i int) float32 { return math.Float32frombits(h.order.Uint32(row[4*i:])) }
+	// Rows are stored from the bottom up
+	for y := h.height - 1; y >= 0; y-- {
+		if _, err := io.ReadFull(br, row); err != nil {
+			return nil, fmt.Errorf("%w: truncated raster", errNetpbmFormat)
+		}
+		for x := range h.width {
+			if h.channels == 1 {
+				v := sample(x)
+				img.SetFloat(x, y, v, v, v, 1)
+			} else {
+				img.SetFloat(x, y, sample(3*x), sample(3*x+1), sample(3*x+2), 1)
+			}
+		}
+	}
+	return img, nil
+}
+
+// DecodePFMConfig returns the dimensions of a Portable FloatMap without
+// decoding the raster.
+func DecodePFMConfig(r io.Reader) (image.Config, error) {
+	h, err := readPFMHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.RGBA64Model, Width: h.width, Height: h.height}, nil
+}
+
+// readPFMHeader parses the header up to and including the single whitespace
+// character that precedes the raster.
+func readPFMHeader(br *bufio.Reader) (*pfmHeader, error) {
+	magic, err := readNetpbmToken(br)
+	if err != nil {
+		return nil, err
+	}
+	h := &pfmHeader{}
+	switch magic {
+	case "PF":
+		h.channels = 3
+	case "Pf":
+		h.channels = 1
+	default:
+		return nil, errNetpbmFormat
+	}
+
+	var tokens [3]string
+	for i := range tokens {
+		if tokens[i], err = readNetpbmToken(br); err != nil {
+			return nil, err
+		}
+	}
+	h.width, err = strconv.Atoi(tokens[0])
+	if err == nil {
+		h.height, err = strconv.Atoi(tokens[1])
+	}
+	var scale float64
+	if err == nil {
+		scale, err = strconv.ParseFloat(tokens[2], 64)
+	}
+	switch {
+	case err != nil || scale == 0:
+		return nil, fmt.Errorf("%w: PFM header %q", errNetpbmFormat, tokens)
+	case h.width <= 0 || h.height <= 0:
+		return nil, fmt.Errorf("%w: size %dx%d", errNetpbmFormat, h.width, h.height)
+	case int64(h.width)*int64(h.height)*4 > maxFloatSamples:
+		return nil, fmt.Errorf("%w: image too large", errNetpbmFormat)
+	}
+	h.order = binary.BigEndian
+	if scale < 0 {
+		h.order = binary.LittleEndian
+	}
+	return h, nil
+}
@@ -0,0 +1,72 @@
+package imagediff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"math"
+	"testing"
+)
+
+// pfmData returns a Portable FloatMap with the given header and samples
+func pfmData(header string, order binary.AppendByteOrder, samples ...float32) []byte {
+	data := []byte(header)
+	for _, v := range samples {
+		data = order.AppendUint32(data, math.Float32bits(v))
+	}
+	return data
+}
+
+func TestDecodePFM(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want map[image.Point][4]float32
+	}{
+		{
+			name: "RGB Little-Endian Bottom Up",
+			data: pfmData("PF\n2 2\n-1.0\n", binary.LittleEndian, 1, 2, 3, 4, 5, 6, 0.5, -1, 100, 0, 0, 0),
+			want: map[image.Point][4]float32{{0, 1}: {1, 2, 3, 1}, {1, 1}: {4, 5, 6, 1}, {0, 0}: {0.5, -1, 100, 1}},
+		},
+		{
+			name: "Grayscale Big-Endian",
+			data: pfmData("Pf 3 1 2.5\n", binary.BigEndian, 0.25, 1e6, 7),
+			want: map[image.Point][4]float32{{0, 0}: {0.25, 0.25, 0.25, 1}, {1, 0}: {1e6, 1e6, 1e6, 1}, {2, 0}: {7, 7, 7, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, format, err := image.Decode(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			f, ok := img.(*FloatImage)
+			if format != "pfm" || !ok {
+				t.Fatalf("%s: got format %q, %T", tt.name, format, img)
+			}
+			for p, want := range tt.want {
+				if r, g, b, a := f.FloatAt(p.X, p.Y); [4]float32{r, g, b, a} != want {
+					t.Errorf("%s: pixel %v got %v, want %v", tt.name, p, [4]float32{r, g, b, a}, want)
+				}
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(tt.data))
+			if err != nil || cfg.Width != img.Bounds().Dx() || cfg.Height != img.Bounds().Dy() {
+				t.Errorf("%s: DecodeConfig got %+v, %v", tt.name, cfg, err)
+			}
+		})
+	}
+
+	for _, data := range []string{
+		"PF\n2 2\n-1.0\n\x00\x00", // Truncated raster
+		"PF\n0 2\n-1.0\n",         // Empty image
+		"PF\n1 1\n0\n\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00", // Zero scale
+		"PF\n1 1 x\n", // Malformed scale
+		"PX\n1 1 1\n", // Unknown magic
+	} {
+		if _, err := DecodePFM(bytes.NewReader([]byte(data))); !errors.Is(err, errNetpbmFormat) {
+			t.Errorf("DecodePFM(%q): got %v, want %v", data, err, errNetpbmFormat)
+		}
+	}
+}
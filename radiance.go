@@ -0,0 +1,202 @@
+package imagediff
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var errHDRFormat = errors.New("imagediff: invalid Radiance HDR image")
+
+func init() {
+	image.RegisterFormat("hdr", "#?", DecodeHDR, DecodeHDRConfig)
+}
+
+// hdrHeader describes the raster of a Radiance HDR image.
+type hdrHeader struct {
+	width, height int
+	bottomUp      bool    // +Y: the first scanline is the bottom one
+	exposure      float64 // Product of the EXPOSURE lines, already applied to the pixels
+}
+
+// DecodeHDR reads a Radiance HDR (RGBE) image into an opaque *FloatImage,
+// dividing out the exposure recorded in the header. Flat and run-length
+// encoded scanlines are supported; XYZE images and rotated orientations are
+// not.
+func DecodeHDR(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readHDRHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	img := NewFloatImage(image.Rect(0, 0, h.width, h.height))
+	scanline := make([]byte, 4*h.width)
+	for i := range h.height {
+		if err := readHDRScanline(br, scanline); err != nil {
+			return nil, err
+		}
+		y := i
+		if h.bottomUp {
+			y = h.height - 1 - i
+		}
+		for x := range h.width {
+			p := scanline[4*x:][:4]
+			if p[3] == 0 {
+				img.SetFloat(x, y, 0, 0, 0, 1)
+				continue
+			}
+			// Mantissas are 8-bit fractions of the shared exponent, biased by 128
+			f := math.Ldexp(1/h.exposure, int(p[3])-(128+8))
+			img.SetFloat(x, y, float32(float64(p[0])*f), float32(float64(p[1])*f), float32(float64(p[2])*f), 1)
+		}
+	}
+	return img, nil
+}
+
+// DecodeHDRConfig returns the dimensions of a Radiance HDR image without
+// decoding the raster.
+func DecodeHDRConfig(r io.Reader) (image.Config, error) {
+	h, err := readHDRHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.RGBA64Model, Width: h.width, Height: h.height}, nil
+}
+
+// readHDRHeader parses the header lines up to the blank line and the
+// resolution line that follows.
+func readHDRHeader(br *bufio.Reader) (*hdrHeader, error) {
+	line, err := br.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "#?") {
+		return nil, errHDRFormat
+	}
+	h := &hdrHeader{exposure: 1}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("%w: unterminated header", errHDRFormat)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "FORMAT":
+			if value != "32-bit_rle_rgbe" {
+				return nil, fmt.Errorf("%w: unsupported format %q", errHDRFormat, value)
+			}
+		case "EXPOSURE":
+			e, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || e <= 0 {
+				return nil, fmt.Errorf("%w: %q in header", errHDRFormat, line)
+			}
+			h.exposure *= e
+		}
+	}
+
+	line, err = br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing resolution", errHDRFormat)
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 4 || (fields[0] != "-Y" && fields[0] != "+Y") || fields[2] != "+X" {
+		return nil, fmt.Errorf("%w: unsupported resolution %q", errHDRFormat, strings.TrimSpace(line))
+	}
+	h.bottomUp = fields[0] == "+Y"
+	h.height, err = strconv.Atoi(fields[1])
+	if err == nil {
+		h.width, err = strconv.Atoi(fields[3])
+	}
+	switch {
+	case err != nil || h.width <= 0 || h.height <= 0:
+		return nil, fmt.Errorf("%w: resolution %q", errHDRFormat, strings.TrimSpace(line))
+	case int64(h.width)*int64(h.height)*4 > maxFloatSamples:
+		return nil, fmt.Errorf("%w: image too large", errHDRFormat)
+	}
+	return h, nil
+}
+
+// readHDRScanline reads one scanline of RGBE pixels into scanline. New-style
+// scanlines start with 2, 2 and the width and store each component
+// separately, run-length encoded; anything else is a flat scanline, in which
+// a pixel of 1, 1, 1, n repeats the previous pixel n times, with consecutive
+// repeat counts forming the higher bytes of the count.
+func readHDRScanline(br *bufio.Reader, scanline []byte) error {
+	width := len(scanline) / 4
+	start, err := br.Peek(4)
+	if err != nil {
+		return fmt.Errorf("%w: truncated", errHDRFormat)
+	}
+	if width >= 8 && width < 0x8000 && start[0] == 2 && start[1] == 2 && start[2]&0x80 == 0 {
+		if int(start[2])<<8|int(start[3]) != width {
+			return fmt.Errorf("%w: scanline width mismatch", errHDRFormat)
+		}
+		br.Discard(4)
+		for c := range 4 {
+			for x := 0; x < width; {
+				count, err := br.ReadByte()
+				if err != nil {
+					return fmt.Errorf("%w: truncated", errHDRFormat)
+				}
+				run := count > 128
+				n := int(count)
+				if run {
+					n -= 128
+				}
+				if n == 0 || x+n > width {
+					return fmt.Errorf("%w: bad run length", errHDRFormat)
+				}
+				if run {
+					v, err := br.ReadByte()
+					if err != nil {
+						return fmt.Errorf("%w: truncated", errHDRFormat)
+					}
+					for ; n > 0; n-- {
+						scanline[4*x+c] = v
+						x++
+					}
+					continue
+				}
+				for ; n > 0; n-- {
+					v, err := br.ReadByte()
+					if err != nil {
+						return fmt.Errorf("%w: truncated", errHDRFormat)
+					}
+					scanline[4*x+c] = v
+					x++
+				}
+			}
+		}
+		return nil
+	}
+
+	shift := 0
+	for x := 0; x < width; {
+		p := scanline[4*x:][:4]
+		if _, err := io.ReadFull(br, p); err != nil {
+			return fmt.Errorf("%w: truncated", errHDRFormat)
+		}
+		if p[0] != 1 || p[1] != 1 || p[2] != 1 {
+			shift = 0
+			x++
+			continue
+		}
+		n := int(p[3]) << shift
+		if x == 0 || shift > 16 || x+n > width {
+			return fmt.Errorf("%w: bad run length", errHDRFormat)
+		}
+		for ; n > 0; n-- {
+			copy(scanline[4*x:][:4], scanline[4*(x-1):][:4])
+			x++
+		}
+		shift += 8
+	}
+	return nil
+}
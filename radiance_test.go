@@ -0,0 +1,86 @@
+package imagediff
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestDecodeHDR(t *testing.T) {
+	// Run-length encoded scanline of width 8, then a flat black one
+	rle := "\x02\x02\x00\x08" +
+		"\x88\x80" + // R: run of 8 at 128
+		"\x08\x00\x01\x02\x03\x04\x05\x06\x07" + // G: 8 literal values
+		"\x84\x00\x84\x80" + // B: two runs of 4
+		"\x88\x81" + // Exponent: run of 8 at 129
+		strings.Repeat("\x00", 32)
+
+	tests := []struct {
+		name   string
+		data   string
+		width  int
+		height int
+		want   map[image.Point][3]float32
+	}{
+		{
+			name:   "Flat With Repeat",
+			data:   "#?RADIANCE\n# comment\nFORMAT=32-bit_rle_rgbe\n\n-Y 1 +X 4\n\x80\x40\x00\x81\x01\x01\x01\x02\x80\x80\x80\x80",
+			width:  4,
+			height: 1,
+			want:   map[image.Point][3]float32{{0, 0}: {1, 0.5, 0}, {2, 0}: {1, 0.5, 0}, {3, 0}: {0.5, 0.5, 0.5}},
+		},
+		{
+			name:   "Exposure Divided Out",
+			data:   "#?RGBE\nEXPOSURE=2\nEXPOSURE=2\n\n-Y 1 +X 1\n\x80\x40\x00\x83",
+			width:  1,
+			height: 1,
+			want:   map[image.Point][3]float32{{0, 0}: {1, 0.5, 0}},
+		},
+		{
+			name:   "Run-Length Encoded Bottom Up",
+			data:   "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n+Y 2 +X 8\n" + rle,
+			width:  8,
+			height: 2,
+			want:   map[image.Point][3]float32{{0, 1}: {1, 0, 0}, {3, 1}: {1, 3.0 / 128, 0}, {7, 1}: {1, 7.0 / 128, 1}, {7, 0}: {0, 0, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, format, err := image.Decode(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			f, ok := img.(*FloatImage)
+			if format != "hdr" || !ok || f.Bounds() != image.Rect(0, 0, tt.width, tt.height) {
+				t.Fatalf("%s: got format %q, %T, bounds %v", tt.name, format, img, img.Bounds())
+			}
+			for p, want := range tt.want {
+				if r, g, b, a := f.FloatAt(p.X, p.Y); [3]float32{r, g, b} != want || a != 1 {
+					t.Errorf("%s: pixel %v got %v, want %v", tt.name, p, [4]float32{r, g, b, a}, want)
+				}
+			}
+			cfg, _, err := image.DecodeConfig(strings.NewReader(tt.data))
+			if err != nil || cfg.Width != tt.width || cfg.Height != tt.height {
+				t.Errorf("%s: DecodeConfig got %+v, %v", tt.name, cfg, err)
+			}
+		})
+	}
+
+	for _, data := range []string{
+		"#?RADIANCE\nFORMAT=32-bit_rle_xyze\n\n-Y 1 +X 1\n\x00\x00\x00\x00", // XYZE
+		"#?RADIANCE\n\n+X 1 -Y 1\n\x00\x00\x00\x00",                         // Rotated
+		"#?RADIANCE\n\n-Y 1 +X 2\n\x80\x80\x80\x80",                         // Truncated
+		"#?RADIANCE\n\n-Y 1 +X 1\n\x01\x01\x01\x01",                         // Repeat without a pixel
+		"#?RADIANCE\n\n-Y 1 +X 8\n\x02\x02\x00\x08\x89\x00",                 // Run past the width
+		"#?RADIANCE\n\n-Y 1 +X 8\n\x02\x02\x00\x09",                         // Width mismatch
+		"#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n",                              // Unterminated header
+		"#?RADIANCE\nEXPOSURE=0\n\n-Y 1 +X 1\n\x00\x00\x00\x00",             // Zero exposure
+	} {
+		if _, err := DecodeHDR(bytes.NewReader([]byte(data))); !errors.Is(err, errHDRFormat) {
+			t.Errorf("DecodeHDR(%q): got %v, want %v", data, err, errHDRFormat)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package imagediff
+
+import (
+	"image"
+	"sync"
+)
+
+// Region is a named rectangle, in the coordinate space of the left image,
+// compared by Compare when listed in Options.Regions.
+type Region struct {
+	Name string
+	Rect image.Rectangle
+}
+
+// RegionResult holds the statistics of a single region.
+type RegionResult struct {
+	Name        string
+	Bounds      image.Rectangle // Region clipped to the compared images
+	Pixels      int64           // Number of compared pixels, excluding ignored ones
+	DiffCount   int64           // Number of differing pixels
+	DiffPercent float64         // DiffCount as a percentage of Pixels
+	DiffBounds  image.Rectangle // Bounding box of differing pixels, empty if none
+	MaxError    ChannelError    // Largest per-channel difference
+	MeanError   ChannelError    // Mean per-channel difference over Pixels
+}
+
+// compareRegion runs the diff pass over the part of region within the bounds
+// of left, without rendering, and returns its statistics.
+func compareRegion(left, right image.Image, region Region, stats1, stats2 ImageStats, opts Options) RegionResult {
+	bounds := region.Rect.Intersect(left.Bounds())
+	var total chunkStats
+	if !bounds.Empty() {
+		var mu sync.Mutex
+		forEachChunk(bounds, func(c Chunk) {
+			cs := computeDiffChunk(left, right, nil, nil, c, stats1, stats2, opts)
+			mu.Lock()
+			total.merge(cs)
+			mu.Unlock()
+		})
+	}
+
+	rr := RegionResult{
+		Name:       region.Name,
+		Bounds:     bounds,
+		Pixels:     int64(bounds.Dx()*bounds.Dy()) - total.ignored,
+		DiffCount:  total.diffCount,
+		DiffBounds: total.diffBounds,
+		MaxError:   total.maxErr,
+	}
+	if rr.Pixels > 0 {
+		n := float64(rr.Pixels)
+		rr.DiffPercent = float64(rr.DiffCount) * 100 / n
+		rr.MeanError = ChannelError{total.sumErr.R / n, total.sumErr.G / n, total.sumErr.B / n, total.sumErr.A / n}
+	}
+	return rr
+}
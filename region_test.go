@@ -0,0 +1,128 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCompareRegions(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	left := createTestImage(8, 8, gray)
+
+	// Right differs in a 2x2 block at (1, 1) and a single pixel at (6, 6)
+	right := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			right.Set(x, y, gray)
+		}
+	}
+	for _, p := range []image.Point{{1, 1}, {2, 1}, {1, 2}, {2, 2}, {6, 6}} {
+		right.Set(p.X, p.Y, color.RGBA{200, 100, 100, 255})
+	}
+
+	regionMask := image.NewGray(image.Rect(0, 0, 8, 8))
+	regionMask.SetGray(6, 6, color.Gray{255})
+	regionMask.SetGray(7, 7, color.Gray{255})
+
+	tests := []struct {
+		name          string
+		opts          Options
+		wantIgnored   int64
+		wantDiffCount int64
+		wantRegions   []RegionResult
+	}{
+		{
+			name: "Two Regions",
+			opts: Options{Regions: []Region{
+				{Name: "block", Rect: image.Rect(0, 0, 4, 4)},
+				{Name: "corner", Rect: image.Rect(4, 4, 8, 8)},
+			}},
+			wantIgnored:   32,
+			wantDiffCount: 5,
+			wantRegions: []RegionResult{
+				{Name: "block", Bounds: image.Rect(0, 0, 4, 4), Pixels: 16, DiffCount: 4, DiffPercent: 25, DiffBounds: image.Rect(1, 1, 3, 3)},
+				{Name: "corner", Bounds: image.Rect(4, 4, 8, 8), Pixels: 16, DiffCount: 1, DiffPercent: 6.25, DiffBounds: image.Rect(6, 6, 7, 7)},
+			},
+		},
+		{
+			name: "Overlapping And Clipped",
+			opts: Options{Regions: []Region{
+				{Name: "top", Rect: image.Rect(0, 0, 8, 2)},
+				{Name: "left", Rect: image.Rect(-4, 0, 2, 20)},
+			}},
+			wantIgnored:   64 - 28,
+			wantDiffCount: 3,
+			wantRegions: []RegionResult{
+				{Name: "top", Bounds: image.Rect(0, 0, 8, 2), Pixels: 16, DiffCount: 2, DiffPercent: 12.5, DiffBounds: image.Rect(1, 1, 3, 2)},
+				{Name: "left", Bounds: image.Rect(0, 0, 2, 8), Pixels: 16, DiffCount: 2, DiffPercent: 12.5, DiffBounds: image.Rect(1, 1, 2, 3)},
+			},
+		},
+		{
+			name: "Ignore Inside Region",
+			opts: Options{
+				Regions: []Region{{Name: "block", Rect: image.Rect(0, 0, 4, 4)}},
+				Ignore:  []image.Rectangle{image.Rect(0, 0, 2, 4)},
+			},
+			wantIgnored:   64 - 8,
+			wantDiffCount: 2,
+			wantRegions: []RegionResult{
+				{Name: "block", Bounds: image.Rect(0, 0, 4, 4), Pixels: 8, DiffCount: 2, DiffPercent: 25, DiffBounds: image.Rect(2, 1, 3, 3)},
+			},
+		},
+		{
+			name:          "Region Mask",
+			opts:          Options{RegionMask: regionMask},
+			wantIgnored:   62,
+			wantDiffCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Compare(left, right, tt.opts)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+			if res.Ignored != tt.wantIgnored {
+				t.Errorf("%s: Ignored got %d, want %d", tt.name, res.Ignored, tt.wantIgnored)
+			}
+			if res.DiffCount != tt.wantDiffCount {
+				t.Errorf("%s: DiffCount got %d, want %d", tt.name, res.DiffCount, tt.wantDiffCount)
+			}
+			if len(res.Regions) != len(tt.wantRegions) {
+				t.Fatalf("%s: got %d regions, want %d", tt.name, len(res.Regions), len(tt.wantRegions))
+			}
+			for i, want := range tt.wantRegions {
+				got := res.Regions[i]
+				got.MaxError, got.MeanError = ChannelError{}, ChannelError{}
+				if got != want {
+					t.Errorf("%s: region %d got %+v, want %+v", tt.name, i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareRegionsIntersect(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	res, err := Compare(createTestImage(4, 4, gray), createTestImage(6, 4, gray), Options{
+		SizePolicy: SizePolicyIntersect,
+		Regions:    []Region{{Name: "edge", Rect: image.Rect(2, 0, 6, 2)}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Half of the region lies in the strip missing from the left image
+	want := RegionResult{Name: "edge", Bounds: image.Rect(2, 0, 6, 2), Pixels: 8, DiffCount: 4, DiffPercent: 50, DiffBounds: image.Rect(4, 0, 6, 2)}
+	if len(res.Regions) != 1 {
+		t.Fatalf("got %d regions, want 1", len(res.Regions))
+	}
+	if got := res.Regions[0]; got != want {
+		t.Errorf("region got %+v, want %+v", got, want)
+	}
+	if res.DiffCount != 4 {
+		t.Errorf("DiffCount got %d, want 4", res.DiffCount)
+	}
+}
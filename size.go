@@ -0,0 +1,195 @@
+package imagediff
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+)
+
+// SizePolicy selects how Compare handles images of different dimensions.
+// Images are aligned at their top-left corners.
+type SizePolicy string
+
+const (
+	SizePolicyError     SizePolicy = "error"     // Fail with ErrSizeMismatch
+	SizePolicyIntersect SizePolicy = "intersect" // Compare the overlap, count the rest as different
+	SizePolicyPad       SizePolicy = "pad"       // Pad both images to the larger size with Options.PadColor
+	SizePolicyScale     SizePolicy = "scale"     // Rescale the right image to the size of the left image
+)
+
+// ParseSizePolicy converts a -size-policy flag value to a SizePolicy.
+func ParseSizePolicy(s string) (SizePolicy, error) {
+	switch policy := SizePolicy(s); policy {
+	case SizePolicyError, SizePolicyIntersect, SizePolicyPad, SizePolicyScale:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid size policy %q", s)
+}
+
+// applySizePolicy returns images of equal size for the pad and scale
+// policies. Images of equal size are returned unchanged.
+func applySizePolicy(left, right image.Image, opts Options) (image.Image, image.Image, error) {
+	size1, size2 := left.Bounds().Size(), right.Bounds().Size()
+	if size1 == size2 {
+		return left, right, nil
+	}
+
+	switch opts.SizePolicy {
+	case SizePolicyPad:
+		padded := image.Rectangle{Max: image.Pt(max(size1.X, size2.X), max(size1.Y, size2.Y))}.Add(left.Bounds().Min)
+		if opts.Verbose {
+			log.Printf("Padding %v and %v to %v", size1, size2, padded.Size())
+		}
+		return padImage(left, padded, opts.PadColor), padImage(right, padded, opts.PadColor), nil
+	case SizePolicyScale:
+		if opts.Verbose {
+			log.Printf("Rescaling right image from %v to %v", size2, size1)
+		}
+		return left, resizeBilinear(right, left.Bounds()), nil
+	}
+	return nil, nil, ErrSizeMismatch
+}
+
+// padImage draws img at the top-left corner of a canvas with the given bounds
+// filled with padColor.
+func padImage(img image.Image, bounds image.Rectangle, padColor color.Color) image.Image {
+	canvas := image.NewRGBA64(bounds)
+	draw.Draw(canvas, bounds, image.NewUniform(padColor), image.Point{}, draw.Src)
+	draw.Draw(canvas, image.Rectangle{Min: bounds.Min, Max: bounds.Min.Add(img.Bounds().Size())}, img, img.Bounds().Min, draw.Src)
+	return canvas
+}
+
+// resizeBilinear resamples img to the given bounds with bilinear
+// interpolation.
+func resizeBilinear(img image.Image, bounds image.Rectangle) image.Image {
+	src := img.Bounds()
+	dst := image.NewRGBA64(bounds)
+	scaleX := float64(src.Dx()) / float64(bounds.Dx())
+	scaleY := float64(src.Dy()) / float64(bounds.Dy())
+
+	forEachChunk(bounds, func(c Chunk) {
+		for y := c.startY; y < c.endY; y++ {
+			// Map pixel centers from the destination to the source
+			sy := max((float64(y-bounds.Min.Y)+0.5)*scaleY-0.5, 0)
+			y0 := min(int(sy), src.Dy()-1)
+			y1 := min(y0+1, src.Dy()-1)
+			fy := sy - float64(y0)
+			for x := c.startX; x < c.endX; x++ {
+				sx := max((float64(x-bounds.Min.X)+0.5)*scaleX-0.5, 0)
+				x0 := min(int(sx), src.Dx()-1)
+				x1 := min(x0+1, src.Dx()-1)
+				fx := sx - float64(x0)
+
+				var out [4]float64
+				for _, p := range []struct {
+					x, y int
+					w    float64
+				}{
+					{x0, y0, (1 - fx) * (1 - fy)},
+					{x1, y0, fx * (1 - fy)},
+					{x0, y1, (1 - fx) * fy},
+					{x1, y1, fx * fy},
+				} {
+					r, g, b, a := img.At(src.Min.X+p.x, src.Min.Y+p.y).RGBA()
+					out[0] += p.w * float64(r)
+					out[1] += p.w * float64(g)
+					out[2] += p.w * float64(b)
+					out[3] += p.w * float64(a)
+				}
+				dst.SetRGBA64(x, y, color.RGBA64{
+					R: uint16(out[0] + 0.5),
+					G: uint16(out[1] + 0.5),
+					B: uint16(out[2] + 0.5),
+					A: uint16(out[3] + 0.5),
+				})
+			}
+		}
+	})
+	return dst
+}
+
+// cropImage returns the part of img within r, sharing pixels when img
+// supports SubImage.
+func cropImage(img image.Image, r image.Rectangle) image.Image {
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+	cropped := image.NewRGBA64(r)
+	draw.Draw(cropped, r, img, r.Min, draw.Src)
+	return cropped
+}
+
+// compareIntersection compares the overlapping top-left region of left and
+// right, then extends the result to the union of both sizes with the
+// non-overlapping strips counted as differing and drawn white, or in the
+// highlight color in DiffModeOverlay, unless ignored.
+// Statistics other than the differing-pixel counts, percentages and bounds,
+// overall and per region, cover the overlap only.
+func compareIntersection(left, right image.Image, opts Options) (*Result, error) {
+	size1, size2 := left.Bounds().Size(), right.Bounds().Size()
+	overlapSize := image.Pt(min(size1.X, size2.X), min(size1.Y, size2.Y))
+	origin := left.Bounds().Min
+	overlap := image.Rectangle{Min: origin, Max: origin.Add(overlapSize)}
+	union := image.Rectangle{Min: origin, Max: origin.Add(image.Pt(max(size1.X, size2.X), max(size1.Y, size2.Y)))}
+	if opts.Verbose {
+		log.Printf("Comparing %v overlap of %v and %v", overlapSize, size1, size2)
+	}
+
+	rightOverlap := image.Rectangle{Min: right.Bounds().Min, Max: right.Bounds().Min.Add(overlapSize)}
+	res, err := compareSameSize(cropImage(left, overlap), cropImage(right, rightOverlap), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	diffImg := newDiffImage(union, opts.Deep)
+	var strip image.Image = image.White
+	if opts.DiffMode == DiffModeOverlay {
+		strip = image.NewUniform(opts.HighlightColor)
+	}
+	draw.Draw(diffImg, union, strip, image.Point{}, draw.Src)
+	draw.Draw(diffImg, overlap, res.Image, overlap.Min, draw.Src)
+
+	strips := []image.Rectangle{
+		image.Rect(overlap.Max.X, union.Min.Y, union.Max.X, union.Max.Y),   // Right of the overlap
+		image.Rect(union.Min.X, overlap.Max.Y, overlap.Max.X, union.Max.Y), // Below the overlap
+	}
+	for _, strip := range strips {
+		for y := strip.Min.Y; y < strip.Max.Y; y++ {
+			for x := strip.Min.X; x < strip.Max.X; x++ {
+				if ignored(opts.ignoreMask, x, y) {
+					res.Ignored++
+					continue
+				}
+				pixel := image.Rect(x, y, x+1, y+1)
+				res.DiffCount++
+				res.DiffBounds = res.DiffBounds.Union(pixel)
+				for i, region := range opts.Regions {
+					if pixel.In(region.Rect) {
+						rr := &res.Regions[i]
+						rr.Pixels++
+						rr.DiffCount++
+						rr.DiffBounds = rr.DiffBounds.Union(pixel)
+					}
+				}
+			}
+		}
+	}
+	for i, region := range opts.Regions {
+		rr := &res.Regions[i]
+		rr.Bounds = region.Rect.Intersect(union)
+		if rr.Pixels > 0 {
+			rr.DiffPercent = float64(rr.DiffCount) * 100 / float64(rr.Pixels)
+		}
+	}
+	hatchIgnored(diffImg, opts.ignoreMask)
+	res.Image = diffImg
+	if compared := int64(union.Dx()*union.Dy()) - res.Ignored; compared > 0 {
+		res.DiffPercent = float64(res.DiffCount) * 100 / float64(compared)
+	}
+	res.Left, res.Right = left, right
+	return res, nil
+}
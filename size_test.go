@@ -0,0 +1,135 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSizePolicy(t *testing.T) {
+	gray := color.RGBA{100, 100, 100, 255}
+	tests := []struct {
+		name          string
+		img1          image.Image
+		img2          image.Image
+		opts          Options
+		wantErr       error
+		wantBounds    image.Rectangle
+		wantDiffCount int64
+		wantDiffRect  image.Rectangle
+	}{
+		{
+			name:    "Default Error",
+			img1:    createTestImage(4, 4, gray),
+			img2:    createTestImage(4, 6, gray),
+			wantErr: ErrSizeMismatch,
+		},
+		{
+			name:          "Intersect Taller",
+			img1:          createTestImage(4, 4, gray),
+			img2:          createTestImage(4, 6, gray),
+			opts:          Options{SizePolicy: SizePolicyIntersect},
+			wantBounds:    image.Rect(0, 0, 4, 6),
+			wantDiffCount: 8, // 4x2 strip below the overlap
+			wantDiffRect:  image.Rect(0, 4, 4, 6),
+		},
+		{
+			name:          "Intersect Wider And Shorter",
+			img1:          createTestImage(6, 4, gray),
+			img2:          createTestImage(4, 5, gray),
+			opts:          Options{SizePolicy: SizePolicyIntersect},
+			wantBounds:    image.Rect(0, 0, 6, 5),
+			wantDiffCount: 14,                     // 6x5 union minus 4x4 overlap
+			wantDiffRect:  image.Rect(0, 0, 6, 5), // Right strip 4..6 and bottom strip 4..5
+		},
+		{
+			name:          "Pad Matching Color",
+			img1:          createTestImage(4, 4, gray),
+			img2:          createTestImage(4, 6, gray),
+			opts:          Options{SizePolicy: SizePolicyPad, PadColor: gray},
+			wantBounds:    image.Rect(0, 0, 4, 6),
+			wantDiffCount: 0,
+		},
+		{
+			name:          "Pad Transparent",
+			img1:          createTestImage(4, 4, gray),
+			img2:          createTestImage(4, 6, gray),
+			opts:          Options{SizePolicy: SizePolicyPad},
+			wantBounds:    image.Rect(0, 0, 4, 6),
+			wantDiffCount: 8,
+			wantDiffRect:  image.Rect(0, 4, 4, 6),
+		},
+		{
+			name:          "Scale",
+			img1:          createTestImage(8, 8, gray),
+			img2:          createTestImage(3, 5, gray),
+			opts:          Options{SizePolicy: SizePolicyScale},
+			wantBounds:    image.Rect(0, 0, 8, 8),
+			wantDiffCount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Compare(tt.img1, tt.img2, tt.opts)
+			if err != tt.wantErr {
+				t.Fatalf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if res.Image.Bounds() != tt.wantBounds {
+				t.Errorf("%s: diff bounds got %v, want %v", tt.name, res.Image.Bounds(), tt.wantBounds)
+			}
+			if res.DiffCount != tt.wantDiffCount {
+				t.Errorf("%s: DiffCount got %d, want %d", tt.name, res.DiffCount, tt.wantDiffCount)
+			}
+			if res.DiffBounds != tt.wantDiffRect {
+				t.Errorf("%s: DiffBounds got %v, want %v", tt.name, res.DiffBounds, tt.wantDiffRect)
+			}
+			wantPercent := float64(tt.wantDiffCount) * 100 / float64(tt.wantBounds.Dx()*tt.wantBounds.Dy())
+			if !approxEqual(res.DiffPercent, wantPercent, 1e-9) {
+				t.Errorf("%s: DiffPercent got %v, want %v", tt.name, res.DiffPercent, wantPercent)
+			}
+		})
+	}
+}
+
+func TestResizeBilinear(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.RGBA{0, 0, 0, 255})
+	src.Set(1, 0, color.RGBA{200, 200, 200, 255})
+
+	dst := resizeBilinear(src, image.Rect(0, 0, 4, 1))
+	want := []uint8{0, 50, 150, 200} // Pixel centers at -0.25, 0.25, 0.75, 1.25 in the source
+	for x, w := range want {
+		r, _, _, _ := dst.At(x, 0).RGBA()
+		if got := uint8(r >> 8); got != w {
+			t.Errorf("pixel %d: got %d, want %d", x, got, w)
+		}
+	}
+}
+
+func TestCreateCompositeImageDifferentSizes(t *testing.T) {
+	img1 := createTestImage(2, 3, color.RGBA{100, 0, 0, 255})
+	diffImg := createTestImage(3, 4, color.RGBA{0, 0, 100, 255})
+	img2 := createTestImage(3, 4, color.RGBA{0, 100, 0, 255})
+
+	composite := CreateCompositeImage(img1, img2, diffImg)
+	if want := image.Rect(0, 0, 8, 4); composite.Bounds() != want {
+		t.Fatalf("got bounds %v, want %v", composite.Bounds(), want)
+	}
+	for _, tt := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, color.RGBA{100, 0, 0, 255}},
+		{1, 3, color.RGBA{}}, // Below the shorter left image
+		{2, 3, color.RGBA{0, 0, 100, 255}},
+		{7, 3, color.RGBA{0, 100, 0, 255}},
+	} {
+		if got := composite.At(tt.x, tt.y).(color.RGBA); got != tt.want {
+			t.Errorf("pixel at (%d,%d) got %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package imagediff
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// SSIM parameters from Wang et al., "Image Quality Assessment: From Error
+// Visibility to Structural Similarity" (2004).
+const (
+	ssimRadius = 5   // 11x11 Gaussian window
+	ssimSigma  = 1.5 // Standard deviation of the window
+	ssimK1     = 0.01
+	ssimK2     = 0.03
+	ssimL      = 255.0 // Dynamic range of 8-bit luminance
+)
+
+var (
+	ssimC1 = (ssimK1 * ssimL) * (ssimK1 * ssimL)
+	ssimC2 = (ssimK2 * ssimL) * (ssimK2 * ssimL)
+
+	// Per-scale exponents for MS-SSIM from Wang et al., "Multi-Scale
+	// Structural Similarity for Image Quality Assessment" (2003).
+	msssimWeights = []float64{0.0448, 0.2856, 0.3001, 0.2363, 0.1333}
+)
+
+// lumaImage is the luminance of an image in 8-bit units, indexed from (0, 0).
+type lumaImage struct {
+	w, h int
+	pix  []float64
+}
+
+func newLumaImage(img image.Image) *lumaImage {
+	bounds := img.Bounds()
+	l := &lumaImage{w: bounds.Dx(), h: bounds.Dy(), pix: make([]float64, bounds.Dx()*bounds.Dy())}
+	forEachChunk(image.Rect(0, 0, l.w, l.h), func(c Chunk) {
+		for y := c.startY; y < c.endY; y++ {
+			for x := c.startX; x < c.endX; x++ {
+				r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+				// ITU-R BT.601 luma weights
+				l.pix[y*l.w+x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+			}
+		}
+	})
+	return l
+}
+
+// downsample halves the image in each dimension by averaging 2x2 blocks.
+func (l *lumaImage) downsample() *lumaImage {
+	d := &lumaImage{w: l.w / 2, h: l.h / 2}
+	d.pix = make([]float64, d.w*d.h)
+	for y := range d.h {
+		for x := range d.w {
+			i := 2*y*l.w + 2*x
+			d.pix[y*d.w+x] = (l.pix[i] + l.pix[i+1] + l.pix[i+l.w] + l.pix[i+l.w+1]) / 4
+		}
+	}
+	return d
+}
+
+func gaussianKernel(radius int, sigma float64) []float64 {
+	kernel := make([]float64, 2*radius+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// gaussianBlur filters a w x h image with a separable kernel. Near the
+// borders the kernel is truncated and renormalized.
+func gaussianBlur(src []float64, w, h int, kernel []float64) []float64 {
+	radius := len(kernel) / 2
+	bounds := image.Rect(0, 0, w, h)
+	tmp := make([]float64, len(src))
+	dst := make([]float64, len(src))
+
+	forEachChunk(bounds, func(c Chunk) {
+		for y := c.startY; y < c.endY; y++ {
+			for x := c.startX; x < c.endX; x++ {
+				var sum, weight float64
+				for k := max(-radius, -x); k <= min(radius, w-1-x); k++ {
+					sum += kernel[k+radius] * src[y*w+x+k]
+					weight += kernel[k+radius]
+				}
+				tmp[y*w+x] = sum / weight
+			}
+		}
+	})
+	forEachChunk(bounds, func(c Chunk) {
+		for y := c.startY; y < c.endY; y++ {
+			for x := c.startX; x < c.endX; x++ {
+				var sum, weight float64
+				for k := max(-radius, -y); k <= min(radius, h-1-y); k++ {
+					sum += kernel[k+radius] * tmp[(y+k)*w+x]
+					weight += kernel[k+radius]
+				}
+				dst[y*w+x] = sum / weight
+			}
+		}
+	})
+	return dst
+}
+
+// ssimMap returns the local SSIM of every pixel together with the mean SSIM
+// and the mean contrast-structure term used by MS-SSIM.
+func ssimMap(l1, l2 *lumaImage) ([]float64, float64, float64) {
+	w, h := l1.w, l1.h
+	kernel := gaussianKernel(ssimRadius, ssimSigma)
+
+	xx := make([]float64, len(l1.pix))
+	yy := make([]float64, len(l1.pix))
+	xy := make([]float64, len(l1.pix))
+	for i := range l1.pix {
+		xx[i] = l1.pix[i] * l1.pix[i]
+		yy[i] = l2.pix[i] * l2.pix[i]
+		xy[i] = l1.pix[i] * l2.pix[i]
+	}
+
+	muX := gaussianBlur(l1.pix, w, h, kernel)
+	muY := gaussianBlur(l2.pix, w, h, kernel)
+	sigmaXX := gaussianBlur(xx, w, h, kernel)
+	sigmaYY := gaussianBlur(yy, w, h, kernel)
+	sigmaXY := gaussianBlur(xy, w, h, kernel)
+
+	values := make([]float64, len(l1.pix))
+	var sumSSIM, sumCS float64
+	for i := range values {
+		varX := sigmaXX[i] - muX[i]*muX[i]
+		varY := sigmaYY[i] - muY[i]*muY[i]
+		covXY := sigmaXY[i] - muX[i]*muY[i]
+
+		lum := (2*muX[i]*muY[i] + ssimC1) / (muX[i]*muX[i] + muY[i]*muY[i] + ssimC1)
+		cs := (2*covXY + ssimC2) / (varX + varY + ssimC2)
+		values[i] = lum * cs
+		sumSSIM += values[i]
+		sumCS += cs
+	}
+
+	n := float64(len(values))
+	if n == 0 {
+		return values, 1, 1
+	}
+	return values, sumSSIM / n, sumCS / n
+}
+
+// SSIM returns the mean structural similarity of the luminance of left and
+// right, computed with an 11x11 Gaussian window. Identical images score 1.
+func SSIM(left, right image.Image) (float64, error) {
+	if left.Bounds().Size() != right.Bounds().Size() {
+		return 0, ErrSizeMismatch
+	}
+	_, score, _ := ssimMap(newLumaImage(left), newLumaImage(right))
+	return score, nil
+}
+
+// MSSSIM returns the multi-scale structural similarity of left and right over
+// up to five dyadic scales. Scales smaller than the SSIM window are skipped
+// and the remaining weights renormalized.
+func MSSSIM(left, right image.Image) (float64, error) {
+	if left.Bounds().Size() != right.Bounds().Size() {
+		return 0, ErrSizeMismatch
+	}
+	return msssim(newLumaImage(left), newLumaImage(right)), nil
+}
+
+func msssim(l1, l2 *lumaImage) float64 {
+	window := 2*ssimRadius + 1
+	scales := 1
+	for w, h := l1.w/2, l1.h/2; scales < len(msssimWeights) && min(w, h) >= window; w, h = w/2, h/2 {
+		scales++
+	}
+
+	var weightSum float64
+	for _, w := range msssimWeights[:scales] {
+		weightSum += w
+	}
+
+	score := 1.0
+	for i := range scales {
+		_, meanSSIM, meanCS := ssimMap(l1, l2)
+		weight := msssimWeights[i] / weightSum
+		if i == scales-1 {
+			score *= math.Pow(max(meanSSIM, 0), weight)
+		} else {
+			score *= math.Pow(max(meanCS, 0), weight)
+			l1, l2 = l1.downsample(), l2.downsample()
+		}
+	}
+	return score
+}
+
+// renderSSIMMap draws the local dissimilarity (1 - SSIM) amplified by
+// scaleFactor, so identical regions are black.
+func renderSSIMMap(diffImg draw.Image, values []float64, scaleFactor float64) {
+	bounds := diffImg.Bounds()
+	_, deep := diffImg.(*image.RGBA64)
+	w := bounds.Dx()
+	forEachChunk(bounds, func(c Chunk) {
+		for y := c.startY; y < c.endY; y++ {
+			for x := c.startX; x < c.endX; x++ {
+				v := values[(y-bounds.Min.Y)*w+(x-bounds.Min.X)]
+				gray := (1 - v) * 127.5 * scaleFactor
+				diffImg.Set(x, y, levelColor(gray, gray, gray, deep))
+			}
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package imagediff
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// Helper function to create a deterministic grayscale pattern with structure
+func createPatternImage(width, height int, offset uint8) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			v := uint8((x*37+y*91)%200) + offset
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func TestSSIM(t *testing.T) {
+	pattern := createPatternImage(64, 64, 0)
+	tests := []struct {
+		name string
+		img1 image.Image
+		img2 image.Image
+		want float64
+		tol  float64
+	}{
+		{name: "Identical", img1: pattern, img2: pattern, want: 1.0, tol: 1e-9},
+		{
+			// Constant images: contrast-structure is 1, luminance term is
+			// (2*100*110 + C1) / (100^2 + 110^2 + C1)
+			name: "Constant Luminance Shift",
+			img1: createTestImage(16, 16, color.RGBA{100, 100, 100, 255}),
+			img2: createTestImage(16, 16, color.RGBA{110, 110, 110, 255}),
+			want: (2*100*110 + ssimC1) / (100*100 + 110*110 + ssimC1),
+			tol:  1e-6,
+		},
+		{name: "Structure vs Flat", img1: pattern, img2: createTestImage(64, 64, color.RGBA{100, 100, 100, 255}), want: 0.0, tol: 0.05},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SSIM(tt.img1, tt.img2)
+			if err != nil {
+				t.Fatalf("%s: SSIM: %v", tt.name, err)
+			}
+			if !approxEqual(got, tt.want, tt.tol) {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := SSIM(createTestImage(4, 4, color.Black), createTestImage(5, 4, color.Black)); err != ErrSizeMismatch {
+		t.Errorf("Size Mismatch: got error %v, want %v", err, ErrSizeMismatch)
+	}
+}
+
+func TestMSSSIM(t *testing.T) {
+	pattern := createPatternImage(200, 200, 0)
+
+	got, err := MSSSIM(pattern, pattern)
+	if err != nil {
+		t.Fatalf("MSSSIM: %v", err)
+	}
+	if !approxEqual(got, 1.0, 1e-9) {
+		t.Errorf("Identical: got %v, want 1", got)
+	}
+
+	shifted, _ := MSSSIM(pattern, createPatternImage(200, 200, 20))
+	flat, _ := MSSSIM(pattern, createTestImage(200, 200, color.RGBA{100, 100, 100, 255}))
+	if !(shifted < 1 && flat < shifted) {
+		t.Errorf("Expected 1 > shifted (%v) > flat (%v)", shifted, flat)
+	}
+}
+
+func TestCompareSSIMMode(t *testing.T) {
+	img1 := createPatternImage(32, 32, 0)
+	img2 := image.NewRGBA(img1.Bounds())
+	for y := range 32 {
+		for x := range 32 {
+			img2.Set(x, y, img1.At(x, y))
+		}
+	}
+	img2.Set(20, 20, color.RGBA{255, 0, 0, 255})
+
+	res, err := Compare(img1, img2, Options{DiffMode: DiffModeSSIM})
+	if err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if !res.Options.SSIM || res.SSIM >= 1 || res.SSIM < 0.9 {
+		t.Errorf("SSIM got %v, want slightly below 1", res.SSIM)
+	}
+	if gotPixel := res.Image.At(0, 0).(color.RGBA); gotPixel != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("Unchanged region: got %v, want black", gotPixel)
+	}
+	if gotPixel := res.Image.At(20, 20).(color.RGBA); gotPixel.R == 0 {
+		t.Errorf("Changed pixel: got %v, want non-black", gotPixel)
+	}
+}